@@ -0,0 +1,279 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Feed описывает подписку пользователя на RSS-ленту
+type Feed struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	OwnerId   primitive.ObjectID `bson:"owner_id" json:"-"`
+	Name      string             `bson:"name" json:"name"`
+	URL       string             `bson:"url" json:"url"`
+	Include   []string           `bson:"include,omitempty" json:"include,omitempty"`
+	Exclude   []string           `bson:"exclude,omitempty" json:"exclude,omitempty"`
+	Interval  int                `bson:"interval" json:"interval"` // Период проверки в минутах
+	CheckedAt time.Time          `bson:"checked_at,omitempty" json:"checked_at,omitempty"`
+	Error     string             `bson:"error,omitempty" json:"error,omitempty"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+}
+
+// MatchStatus описывает результат обработки подходящей раздачи
+type MatchStatus string
+
+const (
+	MatchAdded     MatchStatus = "added"     // Раздача добавлена в библиотеку
+	MatchDuplicate MatchStatus = "duplicate" // Серия или торрент уже добавлены
+	MatchFailed    MatchStatus = "failed"    // Добавить раздачу не удалось, она будет добавлена повторно
+)
+
+// FeedMatch описывает раздачу ленты, подошедшую под правила
+type FeedMatch struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	FeedId    primitive.ObjectID `bson:"feed_id" json:"feed_id"`
+	OwnerId   primitive.ObjectID `bson:"owner_id" json:"-"`
+	GUID      string             `bson:"guid" json:"guid"`
+	Title     string             `bson:"title" json:"title"`
+	Episode   string             `bson:"episode,omitempty" json:"episode,omitempty"`
+	Hash      string             `bson:"hash,omitempty" json:"hash,omitempty"`
+	Status    MatchStatus        `bson:"status" json:"status"`
+	Error     string             `bson:"error,omitempty" json:"error,omitempty"`
+	Attempts  int                `bson:"attempts" json:"attempts"` // Число попыток добавления
+	MatchedAt time.Time          `bson:"matched_at" json:"matched_at"`
+}
+
+type FeedStore struct {
+	mongodb *MongoDB
+}
+
+func NewFeedStore(mongodb *MongoDB) *FeedStore {
+	return &FeedStore{
+		mongodb: mongodb,
+	}
+}
+
+// CreateFeed сохраняет подписку и заполняет ее ID
+func (fs *FeedStore) CreateFeed(feed *Feed) error {
+	collection := fs.mongodb.GetCollection("feeds")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	feed.CreatedAt = time.Now()
+	result, err := collection.InsertOne(ctx, feed)
+	if err != nil {
+		return err
+	}
+
+	feed.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+// GetFeeds возвращает подписки пользователя в порядке создания
+func (fs *FeedStore) GetFeeds(ownerId primitive.ObjectID) ([]*Feed, error) {
+	return fs.findFeeds(bson.M{"owner_id": ownerId})
+}
+
+// GetAllFeeds возвращает подписки всех пользователей
+func (fs *FeedStore) GetAllFeeds() ([]*Feed, error) {
+	return fs.findFeeds(bson.M{})
+}
+
+func (fs *FeedStore) findFeeds(filter bson.M) ([]*Feed, error) {
+	collection := fs.mongodb.GetCollection("feeds")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}})
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	feeds := []*Feed{}
+	if err = cursor.All(ctx, &feeds); err != nil {
+		return nil, err
+	}
+
+	return feeds, nil
+}
+
+func (fs *FeedStore) GetFeed(ownerId primitive.ObjectID, id primitive.ObjectID) (*Feed, error) {
+	collection := fs.mongodb.GetCollection("feeds")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var feed Feed
+	err := collection.FindOne(ctx, bson.M{"_id": id, "owner_id": ownerId}).Decode(&feed)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, errors.New("feed not found")
+		}
+		return nil, err
+	}
+
+	return &feed, nil
+}
+
+// UpdateFeed сохраняет название, адрес, правила и период проверки подписки
+func (fs *FeedStore) UpdateFeed(feed *Feed) error {
+	collection := fs.mongodb.GetCollection("feeds")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := collection.UpdateOne(ctx, bson.M{"_id": feed.ID, "owner_id": feed.OwnerId}, bson.M{
+		"$set": bson.M{
+			"name":     feed.Name,
+			"url":      feed.URL,
+			"include":  feed.Include,
+			"exclude":  feed.Exclude,
+			"interval": feed.Interval,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return errors.New("feed not found")
+	}
+
+	return nil
+}
+
+// SetFeedChecked сохраняет время и ошибку последней проверки ленты
+func (fs *FeedStore) SetFeedChecked(id primitive.ObjectID, checkedAt time.Time, message string) error {
+	collection := fs.mongodb.GetCollection("feeds")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{
+		"$set": bson.M{"checked_at": checkedAt, "error": message},
+	})
+	return err
+}
+
+// DeleteFeed удаляет подписку вместе с историей ее совпадений
+func (fs *FeedStore) DeleteFeed(ownerId primitive.ObjectID, id primitive.ObjectID) error {
+	collection := fs.mongodb.GetCollection("feeds")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := collection.DeleteOne(ctx, bson.M{"_id": id, "owner_id": ownerId})
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount == 0 {
+		return errors.New("feed not found")
+	}
+
+	_, err = fs.mongodb.GetCollection("feed_matches").DeleteMany(ctx, bson.M{"feed_id": id})
+	return err
+}
+
+// SaveMatch записывает результат обработки раздачи в историю ленты.
+// Повторная попытка обновляет запись раздачи и увеличивает число попыток.
+func (fs *FeedStore) SaveMatch(match *FeedMatch) error {
+	collection := fs.mongodb.GetCollection("feed_matches")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{"feed_id": match.FeedId, "guid": match.GUID}
+	_, err := collection.UpdateOne(ctx, filter, bson.M{
+		"$set": bson.M{
+			"owner_id":   match.OwnerId,
+			"title":      match.Title,
+			"episode":    match.Episode,
+			"hash":       match.Hash,
+			"status":     match.Status,
+			"error":      match.Error,
+			"matched_at": match.MatchedAt,
+		},
+		"$inc": bson.M{"attempts": 1},
+	}, options.Update().SetUpsert(true))
+	return err
+}
+
+// FailMatches отмечает неудачными раздачи, добавленные из лент, если загрузка
+// метаданных торрента завершилась ошибкой
+func (fs *FeedStore) FailMatches(ownerId primitive.ObjectID, hash string, message string) error {
+	collection := fs.mongodb.GetCollection("feed_matches")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := collection.UpdateMany(ctx, bson.M{"owner_id": ownerId, "hash": hash, "status": MatchAdded}, bson.M{
+		"$set": bson.M{"status": MatchFailed, "error": message},
+	})
+	return err
+}
+
+// HasMatch сообщает, обработана ли уже раздача ленты. Неудачная раздача
+// считается обработанной после maxAttempts попыток.
+func (fs *FeedStore) HasMatch(feedId primitive.ObjectID, guid string, maxAttempts int) bool {
+	return fs.hasMatch(bson.M{
+		"feed_id": feedId,
+		"guid":    guid,
+		"$or": bson.A{
+			bson.M{"status": bson.M{"$ne": MatchFailed}},
+			bson.M{"attempts": bson.M{"$gte": maxAttempts}},
+		},
+	})
+}
+
+// HasEpisode сообщает, добавлялась ли уже серия из ленты
+func (fs *FeedStore) HasEpisode(feedId primitive.ObjectID, episode string) bool {
+	return fs.hasMatch(bson.M{"feed_id": feedId, "episode": episode, "status": MatchAdded})
+}
+
+func (fs *FeedStore) hasMatch(filter bson.M) bool {
+	collection := fs.mongodb.GetCollection("feed_matches")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	count, err := collection.CountDocuments(ctx, filter, options.Count().SetLimit(1))
+	return err == nil && count > 0
+}
+
+// GetMatches возвращает страницу истории совпадений пользователя, недавние первыми,
+// и общее число записей. Если feedId не пустой, выбираются совпадения одной ленты.
+func (fs *FeedStore) GetMatches(ownerId primitive.ObjectID, feedId primitive.ObjectID, offset, limit int64) ([]*FeedMatch, int64, error) {
+	collection := fs.mongodb.GetCollection("feed_matches")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{"owner_id": ownerId}
+	if !feedId.IsZero() {
+		filter["feed_id"] = feedId
+	}
+
+	total, err := collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "matched_at", Value: -1}, {Key: "_id", Value: -1}}).
+		SetSkip(offset).
+		SetLimit(limit)
+
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	matches := []*FeedMatch{}
+	if err = cursor.All(ctx, &matches); err != nil {
+		return nil, 0, err
+	}
+
+	return matches, total, nil
+}
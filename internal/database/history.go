@@ -0,0 +1,150 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// HistoryEntry описывает просмотр файла пользователем. Для каждого файла
+// хранится одна запись с последней позицией и временем просмотра.
+type HistoryEntry struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserId      primitive.ObjectID `bson:"user_id" json:"-"`
+	Hash        string             `bson:"hash" json:"hash"`
+	FileId      string             `bson:"file_id" json:"file_id"`
+	TorrentName string             `bson:"torrent_name,omitempty" json:"torrent_name,omitempty"`
+	FileName    string             `bson:"file_name,omitempty" json:"file_name,omitempty"`
+	Position    float64            `bson:"position" json:"position"`
+	Duration    float64            `bson:"duration" json:"duration"`
+	Watched     bool               `bson:"watched" json:"watched"`
+	WatchedAt   time.Time          `bson:"watched_at" json:"watched_at"`
+}
+
+type HistoryStore struct {
+	mongodb *MongoDB
+}
+
+func NewHistoryStore(mongodb *MongoDB) *HistoryStore {
+	return &HistoryStore{
+		mongodb: mongodb,
+	}
+}
+
+// CreateIndexes создает индексы истории: записи выбираются по пользователю,
+// недавние первыми, а обновляются по файлу
+func (hs *HistoryStore) CreateIndexes() error {
+	collection := hs.mongodb.GetCollection("history")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "watched_at", Value: -1}},
+		},
+		{
+			Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "hash", Value: 1}, {Key: "file_id", Value: 1}},
+		},
+	})
+	return err
+}
+
+// RecordView сохраняет просмотр файла, заменяя предыдущую запись о нем
+func (hs *HistoryStore) RecordView(entry *HistoryEntry) error {
+	collection := hs.mongodb.GetCollection("history")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{"user_id": entry.UserId, "hash": entry.Hash, "file_id": entry.FileId}
+	_, err := collection.UpdateOne(ctx, filter, bson.M{
+		"$set": bson.M{
+			"torrent_name": entry.TorrentName,
+			"file_name":    entry.FileName,
+			"position":     entry.Position,
+			"duration":     entry.Duration,
+			"watched":      entry.Watched,
+			"watched_at":   entry.WatchedAt,
+		},
+	}, options.Update().SetUpsert(true))
+	return err
+}
+
+// GetContinueWatching возвращает начатые и не досмотренные файлы торрентов
+// hashes, недавние первыми
+func (hs *HistoryStore) GetContinueWatching(userId primitive.ObjectID, hashes []string, limit int64) ([]*HistoryEntry, error) {
+	collection := hs.mongodb.GetCollection("history")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{
+		"user_id":  userId,
+		"hash":     bson.M{"$in": hashes},
+		"watched":  false,
+		"position": bson.M{"$gt": 0},
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "watched_at", Value: -1}}).SetLimit(limit)
+
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	entries := []*HistoryEntry{}
+	if err = cursor.All(ctx, &entries); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// GetHistory возвращает страницу истории просмотров, недавние первыми,
+// и общее число записей
+func (hs *HistoryStore) GetHistory(userId primitive.ObjectID, offset, limit int64) ([]*HistoryEntry, int64, error) {
+	collection := hs.mongodb.GetCollection("history")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{"user_id": userId}
+
+	total, err := collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "watched_at", Value: -1}, {Key: "_id", Value: -1}}).
+		SetSkip(offset).
+		SetLimit(limit)
+
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	entries := []*HistoryEntry{}
+	if err = cursor.All(ctx, &entries); err != nil {
+		return nil, 0, err
+	}
+
+	return entries, total, nil
+}
+
+// ClearHistory удаляет историю просмотров пользователя и возвращает число удаленных записей
+func (hs *HistoryStore) ClearHistory(userId primitive.ObjectID) (int64, error) {
+	collection := hs.mongodb.GetCollection("history")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := collection.DeleteMany(ctx, bson.M{"user_id": userId})
+	if err != nil {
+		return 0, err
+	}
+
+	return result.DeletedCount, nil
+}
@@ -3,6 +3,7 @@ package database
 import (
 	"context"
 	"errors"
+	"retreat-backend/internal/probe"
 	"retreat-backend/internal/torrent"
 	"time"
 
@@ -12,15 +13,29 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+var ErrTorrentExists = errors.New("torrent already exists")
+
 type Torrent struct {
-	ID          primitive.ObjectID   `bson:"_id,omitempty" json:"id"`
-	Hash        string               `bson:"hash" json:"hash"`
-	OwnerId     primitive.ObjectID   `bson:"owner_id" json:"owner_id"`
-	TorrentFile string               `bson:"torrent_file" json:"torrent_file"`
-	IsMagnet    bool                 `bson:"is_magnet" json:"is_magnet"`
-	LastFileId  string               `bson:"last_file_id" json:"last_file_id"`
-	CreatedAt   time.Time            `bson:"created_at" json:"created_at"`
-	TorrentInfo *torrent.TorrentInfo `bson:"torrent_info" json:"torrent_info"`
+	ID           primitive.ObjectID                `bson:"_id,omitempty" json:"id"`
+	Hash         string                            `bson:"hash" json:"hash"`
+	OwnerId      primitive.ObjectID                `bson:"owner_id" json:"owner_id"`
+	TorrentFile  string                            `bson:"torrent_file" json:"torrent_file"`
+	IsMagnet     bool                              `bson:"is_magnet" json:"is_magnet"`
+	Metainfo     []byte                            `bson:"metainfo,omitempty" json:"-"`
+	LastFileId   string                            `bson:"last_file_id" json:"last_file_id"`
+	State        torrent.JobState                  `bson:"state,omitempty" json:"state,omitempty"`
+	Error        string                            `bson:"error,omitempty" json:"error,omitempty"`
+	Files        []string                          `bson:"files,omitempty" json:"files,omitempty"` // Файлы, выбранные пользователем; пусто — все файлы
+	PinnedFiles  []string                          `bson:"pinned_files,omitempty" json:"pinned_files,omitempty"`
+	SeedPolicy   *torrent.SeedPolicy               `bson:"seed_policy,omitempty" json:"seed_policy,omitempty"`
+	SeedState    torrent.SeedState                 `bson:"seed_state,omitempty" json:"seed_state,omitempty"`
+	SeedRatio    float64                           `bson:"seed_ratio,omitempty" json:"seed_ratio,omitempty"`
+	SeedStarted  *time.Time                        `bson:"seed_started,omitempty" json:"seed_started,omitempty"`   // Завершение загрузки, с которого отсчитывается раздача
+	SeedUploaded int64                             `bson:"seed_uploaded,omitempty" json:"seed_uploaded,omitempty"` // Отдано данных за все сеансы
+	Media        map[string]*probe.MediaInfo       `bson:"media,omitempty" json:"media,omitempty"`
+	Progress     map[string]*torrent.WatchProgress `bson:"progress,omitempty" json:"progress,omitempty"`
+	CreatedAt    time.Time                         `bson:"created_at" json:"created_at"`
+	TorrentInfo  *torrent.TorrentInfo              `bson:"torrent_info" json:"torrent_info"`
 }
 
 type TorrentStore struct {
@@ -33,34 +48,323 @@ func NewTorrentStore(mongodb *MongoDB) *TorrentStore {
 	}
 }
 
-func (ts *TorrentStore) CreateTorrent(ownerId primitive.ObjectID, torrentInfo *torrent.TorrentInfo, torrentFile string, isMagnet bool) error {
-
+// CreateTorrent добавляет торрент в библиотеку владельца. Запись торрента,
+// метаданные которого не удалось получить, заменяется новой попыткой.
+func (ts *TorrentStore) CreateTorrent(t *Torrent) error {
 	collection := ts.mongodb.GetCollection("torrents")
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	var existingTorrent Torrent
-	err := collection.FindOne(ctx, bson.M{"owner_id": ownerId, "hash": torrentInfo.Id}).Decode(&existingTorrent)
-	if err == nil {
-		return errors.New("torrent already exists")
+	err := collection.FindOne(ctx, bson.M{"owner_id": t.OwnerId, "hash": t.Hash}).Decode(&existingTorrent)
+	switch {
+	case err == nil && existingTorrent.State == torrent.JobFailed:
+		if _, err := collection.DeleteOne(ctx, bson.M{"_id": existingTorrent.ID}); err != nil {
+			return err
+		}
+	case err == nil:
+		return ErrTorrentExists
+	case !errors.Is(err, mongo.ErrNoDocuments):
+		return err
 	}
-	if !errors.Is(err, mongo.ErrNoDocuments) {
+
+	t.CreatedAt = time.Now()
+
+	_, err = collection.InsertOne(ctx, t)
+	return err
+}
+
+// UpdateTorrentInfo сохраняет полученные метаданные во всех записях с данным хэшем
+func (ts *TorrentStore) UpdateTorrentInfo(hash string, torrentInfo *torrent.TorrentInfo, state torrent.JobState) error {
+	collection := ts.mongodb.GetCollection("torrents")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := collection.UpdateMany(ctx, bson.M{"hash": hash}, bson.M{
+		"$set":   bson.M{"torrent_info": torrentInfo, "state": state},
+		"$unset": bson.M{"error": ""},
+	})
+	return err
+}
+
+// UpdateTorrentState сохраняет состояние добавления торрента
+func (ts *TorrentStore) UpdateTorrentState(ownerId primitive.ObjectID, hash string, state torrent.JobState, message string) error {
+	collection := ts.mongodb.GetCollection("torrents")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := collection.UpdateOne(ctx, bson.M{"owner_id": ownerId, "hash": hash}, bson.M{
+		"$set": bson.M{"state": state, "error": message},
+	})
+	return err
+}
+
+// SetPinnedFiles сохраняет файлы, закрепленные пользователем для полной загрузки
+func (ts *TorrentStore) SetPinnedFiles(ownerId primitive.ObjectID, hash string, fileIds []string) error {
+	collection := ts.mongodb.GetCollection("torrents")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := collection.UpdateOne(ctx, bson.M{"owner_id": ownerId, "hash": hash}, bson.M{
+		"$set": bson.M{"pinned_files": fileIds},
+	})
+	if err != nil {
 		return err
 	}
 
-	t := Torrent{
-		OwnerId:     ownerId,
-		Hash:        torrentInfo.Id,
-		TorrentFile: torrentFile,
-		IsMagnet:    isMagnet,
-		CreatedAt:   time.Now(),
-		TorrentInfo: torrentInfo,
+	if result.MatchedCount == 0 {
+		return errors.New("torrent not found")
 	}
 
-	_, err = collection.InsertOne(ctx, t)
+	return nil
+}
+
+// GetPinnedFiles возвращает файлы торрента, закрепленные хотя бы одним пользователем
+func (ts *TorrentStore) GetPinnedFiles(hash string) ([]string, error) {
+	collection := ts.mongodb.GetCollection("torrents")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	values, err := collection.Distinct(ctx, "pinned_files", bson.M{"hash": hash})
+	if err != nil {
+		return nil, err
+	}
+
+	fileIds := make([]string, 0, len(values))
+	for _, v := range values {
+		if fileId, ok := v.(string); ok {
+			fileIds = append(fileIds, fileId)
+		}
+	}
+
+	return fileIds, nil
+}
+
+// SetSelectedFiles сохраняет файлы, выбранные пользователем для библиотеки, nil выбирает все.
+// Закрепление невыбранных файлов снимается.
+func (ts *TorrentStore) SetSelectedFiles(ownerId primitive.ObjectID, hash string, fileIds []string, pinned []string) error {
+	collection := ts.mongodb.GetCollection("torrents")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	update := bson.M{"$set": bson.M{"files": fileIds, "pinned_files": pinned}}
+	if fileIds == nil {
+		update = bson.M{"$unset": bson.M{"files": ""}}
+	}
+
+	result, err := collection.UpdateOne(ctx, bson.M{"owner_id": ownerId, "hash": hash}, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return errors.New("torrent not found")
+	}
+
+	return nil
+}
+
+// GetSelectedFiles возвращает файлы торрента, выбранные хотя бы одним пользователем.
+// Возвращает nil, если кто-то из пользователей выбрал все файлы.
+func (ts *TorrentStore) GetSelectedFiles(hash string) ([]string, error) {
+	collection := ts.mongodb.GetCollection("torrents")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	all, err := collection.CountDocuments(ctx, bson.M{"hash": hash, "files": bson.M{"$exists": false}})
+	if err != nil {
+		return nil, err
+	}
+	if all > 0 {
+		return nil, nil
+	}
+
+	values, err := collection.Distinct(ctx, "files", bson.M{"hash": hash})
+	if err != nil {
+		return nil, err
+	}
+	if len(values) == 0 {
+		return nil, nil
+	}
+
+	fileIds := make([]string, 0, len(values))
+	for _, v := range values {
+		if fileId, ok := v.(string); ok {
+			fileIds = append(fileIds, fileId)
+		}
+	}
+
+	return fileIds, nil
+}
+
+// GetOwners возвращает пользователей, в библиотеке которых есть торрент
+func (ts *TorrentStore) GetOwners(hash string) ([]primitive.ObjectID, error) {
+	collection := ts.mongodb.GetCollection("torrents")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	values, err := collection.Distinct(ctx, "owner_id", bson.M{"hash": hash})
+	if err != nil {
+		return nil, err
+	}
+
+	owners := make([]primitive.ObjectID, 0, len(values))
+	for _, v := range values {
+		if id, ok := v.(primitive.ObjectID); ok {
+			owners = append(owners, id)
+		}
+	}
+
+	return owners, nil
+}
+
+// SetSeedPolicy сохраняет политику раздачи торрента, nil удаляет ее. Итог раздачи
+// сбрасывается во всех записях, так как действующая политика общая для торрента.
+func (ts *TorrentStore) SetSeedPolicy(ownerId primitive.ObjectID, hash string, policy *torrent.SeedPolicy) error {
+	collection := ts.mongodb.GetCollection("torrents")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	update := bson.M{"$set": bson.M{"seed_policy": policy}}
+	if policy == nil {
+		update = bson.M{"$unset": bson.M{"seed_policy": ""}}
+	}
+
+	result, err := collection.UpdateOne(ctx, bson.M{"owner_id": ownerId, "hash": hash}, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return errors.New("torrent not found")
+	}
+
+	_, err = collection.UpdateMany(ctx, bson.M{"hash": hash}, bson.M{
+		"$unset": bson.M{"seed_state": "", "seed_ratio": ""},
+	})
 	return err
 }
 
+// GetSeedPolicies возвращает политики раздачи всех пользователей торрента,
+// nil означает общую политику
+func (ts *TorrentStore) GetSeedPolicies(hash string) ([]*torrent.SeedPolicy, error) {
+	collection := ts.mongodb.GetCollection("torrents")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetProjection(bson.M{"seed_policy": 1})
+	cursor, err := collection.Find(ctx, bson.M{"hash": hash}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var torrents []Torrent
+	if err := cursor.All(ctx, &torrents); err != nil {
+		return nil, err
+	}
+
+	policies := make([]*torrent.SeedPolicy, 0, len(torrents))
+	for _, t := range torrents {
+		policies = append(policies, t.SeedPolicy)
+	}
+
+	return policies, nil
+}
+
+// GetSeedProgress возвращает сохраненное время завершения загрузки торрента
+// (nil - загрузка еще не завершалась) и объем данных, отданных за все сеансы
+func (ts *TorrentStore) GetSeedProgress(hash string) (*time.Time, int64, error) {
+	collection := ts.mongodb.GetCollection("torrents")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{"hash": hash, "$or": bson.A{
+		bson.M{"seed_started": bson.M{"$exists": true}},
+		bson.M{"seed_uploaded": bson.M{"$exists": true}},
+	}}
+
+	var t Torrent
+	err := collection.FindOne(ctx, filter).Decode(&t)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return t.SeedStarted, t.SeedUploaded, nil
+}
+
+// SetSeedStarted сохраняет время завершения загрузки во всех записях с данным хэшем
+func (ts *TorrentStore) SetSeedStarted(hash string, started time.Time) error {
+	collection := ts.mongodb.GetCollection("torrents")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := collection.UpdateMany(ctx, bson.M{"hash": hash}, bson.M{
+		"$set": bson.M{"seed_started": started},
+	})
+	return err
+}
+
+// SetSeedUploaded сохраняет объем отданных данных во всех записях с данным хэшем.
+// Сохраненный объем не уменьшается.
+func (ts *TorrentStore) SetSeedUploaded(hash string, uploaded int64) error {
+	collection := ts.mongodb.GetCollection("torrents")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := collection.UpdateMany(ctx, bson.M{"hash": hash}, bson.M{
+		"$max": bson.M{"seed_uploaded": uploaded},
+	})
+	return err
+}
+
+// UpdateSeedState сохраняет итог раздачи во всех записях с данным хэшем
+func (ts *TorrentStore) UpdateSeedState(hash string, state torrent.SeedState, ratio float64) error {
+	collection := ts.mongodb.GetCollection("torrents")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := collection.UpdateMany(ctx, bson.M{"hash": hash}, bson.M{
+		"$set": bson.M{"seed_state": state, "seed_ratio": ratio},
+	})
+	return err
+}
+
+// SetMediaInfo сохраняет сведения о медиафайле во всех записях с данным хэшем
+func (ts *TorrentStore) SetMediaInfo(hash string, fileId string, info *probe.MediaInfo) error {
+	collection := ts.mongodb.GetCollection("torrents")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := collection.UpdateMany(ctx, bson.M{"hash": hash}, bson.M{
+		"$set": bson.M{"media." + fileId: info},
+	})
+	return err
+}
+
+// SetProgress сохраняет позицию просмотра файла и отмечает его последним просмотренным
+func (ts *TorrentStore) SetProgress(ownerId primitive.ObjectID, hash string, fileId string, progress *torrent.WatchProgress) error {
+	collection := ts.mongodb.GetCollection("torrents")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := collection.UpdateOne(ctx, bson.M{"owner_id": ownerId, "hash": hash}, bson.M{
+		"$set": bson.M{"last_file_id": fileId, "progress." + fileId: progress},
+	})
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return errors.New("torrent not found")
+	}
+
+	return nil
+}
+
 func (ts *TorrentStore) DeleteTorrent(ownerId primitive.ObjectID, hash string) error {
 	collection := ts.mongodb.GetCollection("torrents")
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -99,6 +403,26 @@ func (ts *TorrentStore) GetTorrents(ownerId primitive.ObjectID) ([]*Torrent, err
 	return torrents, nil
 }
 
+// GetAllTorrents возвращает торренты всех пользователей
+func (ts *TorrentStore) GetAllTorrents() ([]*Torrent, error) {
+	collection := ts.mongodb.GetCollection("torrents")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cursor, err := collection.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var torrents []*Torrent
+	if err = cursor.All(ctx, &torrents); err != nil {
+		return nil, err
+	}
+
+	return torrents, nil
+}
+
 func (ts *TorrentStore) GetTorrent(ownerId primitive.ObjectID, hash string) (*Torrent, error) {
 	collection := ts.mongodb.GetCollection("torrents")
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
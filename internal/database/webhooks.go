@@ -0,0 +1,195 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"retreat-backend/internal/torrent"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// deliveryRetention определяет, сколько хранится журнал доставок вебхуков
+const deliveryRetention = 30 * 24 * time.Hour
+
+// Webhook описывает адрес, на который отправляются события библиотеки пользователя
+type Webhook struct {
+	ID        primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	OwnerId   primitive.ObjectID  `bson:"owner_id" json:"-"`
+	URL       string              `bson:"url" json:"url"`
+	Secret    string              `bson:"secret" json:"secret,omitempty"`
+	Events    []torrent.EventType `bson:"events" json:"events"`
+	CreatedAt time.Time           `bson:"created_at" json:"created_at"`
+}
+
+// WebhookDelivery описывает одну попытку доставки события
+type WebhookDelivery struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	WebhookId  primitive.ObjectID `bson:"webhook_id" json:"webhook_id"`
+	OwnerId    primitive.ObjectID `bson:"owner_id" json:"-"`
+	Delivery   string             `bson:"delivery" json:"delivery"`
+	Event      torrent.EventType  `bson:"event" json:"event"`
+	Hash       string             `bson:"hash" json:"hash"`
+	URL        string             `bson:"url" json:"url"`
+	Attempt    int                `bson:"attempt" json:"attempt"`
+	Status     int                `bson:"status,omitempty" json:"status,omitempty"`
+	Error      string             `bson:"error,omitempty" json:"error,omitempty"`
+	Success    bool               `bson:"success" json:"success"`
+	DurationMs int64              `bson:"duration_ms" json:"duration_ms"`
+	CreatedAt  time.Time          `bson:"created_at" json:"created_at"`
+}
+
+type WebhookStore struct {
+	mongodb *MongoDB
+}
+
+func NewWebhookStore(mongodb *MongoDB) *WebhookStore {
+	return &WebhookStore{
+		mongodb: mongodb,
+	}
+}
+
+// CreateIndexes создает индексы журнала доставок. Записи старше deliveryRetention
+// удаляются MongoDB по TTL-индексу.
+func (ws *WebhookStore) CreateIndexes() error {
+	collection := ws.mongodb.GetCollection("webhook_deliveries")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "created_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(int32(deliveryRetention.Seconds())),
+		},
+		{
+			Keys: bson.D{{Key: "owner_id", Value: 1}, {Key: "created_at", Value: -1}},
+		},
+	})
+	return err
+}
+
+// CreateWebhook сохраняет вебхук и заполняет его ID
+func (ws *WebhookStore) CreateWebhook(hook *Webhook) error {
+	collection := ws.mongodb.GetCollection("webhooks")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	hook.CreatedAt = time.Now()
+	result, err := collection.InsertOne(ctx, hook)
+	if err != nil {
+		return err
+	}
+
+	hook.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+// GetWebhooks возвращает вебхуки пользователя в порядке создания
+func (ws *WebhookStore) GetWebhooks(ownerId primitive.ObjectID) ([]*Webhook, error) {
+	collection := ws.mongodb.GetCollection("webhooks")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}})
+	cursor, err := collection.Find(ctx, bson.M{"owner_id": ownerId}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	hooks := []*Webhook{}
+	if err = cursor.All(ctx, &hooks); err != nil {
+		return nil, err
+	}
+
+	return hooks, nil
+}
+
+// GetSubscribedWebhooks возвращает вебхуки пользователей, подписанные на событие
+func (ws *WebhookStore) GetSubscribedWebhooks(ownerIds []primitive.ObjectID, event torrent.EventType) ([]*Webhook, error) {
+	collection := ws.mongodb.GetCollection("webhooks")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cursor, err := collection.Find(ctx, bson.M{"owner_id": bson.M{"$in": ownerIds}, "events": event})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var hooks []*Webhook
+	if err = cursor.All(ctx, &hooks); err != nil {
+		return nil, err
+	}
+
+	return hooks, nil
+}
+
+// DeleteWebhook удаляет вебхук вместе с журналом его доставок
+func (ws *WebhookStore) DeleteWebhook(ownerId primitive.ObjectID, id primitive.ObjectID) error {
+	collection := ws.mongodb.GetCollection("webhooks")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := collection.DeleteOne(ctx, bson.M{"_id": id, "owner_id": ownerId})
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount == 0 {
+		return errors.New("webhook not found")
+	}
+
+	_, err = ws.mongodb.GetCollection("webhook_deliveries").DeleteMany(ctx, bson.M{"webhook_id": id})
+	return err
+}
+
+// AddDelivery записывает попытку доставки в журнал
+func (ws *WebhookStore) AddDelivery(delivery *WebhookDelivery) error {
+	collection := ws.mongodb.GetCollection("webhook_deliveries")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := collection.InsertOne(ctx, delivery)
+	return err
+}
+
+// GetDeliveries возвращает страницу журнала доставок пользователя, недавние первыми,
+// и общее число записей. Если webhookId не пустой, выбираются доставки одного вебхука.
+func (ws *WebhookStore) GetDeliveries(ownerId primitive.ObjectID, webhookId primitive.ObjectID, offset, limit int64) ([]*WebhookDelivery, int64, error) {
+	collection := ws.mongodb.GetCollection("webhook_deliveries")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{"owner_id": ownerId}
+	if !webhookId.IsZero() {
+		filter["webhook_id"] = webhookId
+	}
+
+	total, err := collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}).
+		SetSkip(offset).
+		SetLimit(limit)
+
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	deliveries := []*WebhookDelivery{}
+	if err = cursor.All(ctx, &deliveries); err != nil {
+		return nil, 0, err
+	}
+
+	return deliveries, total, nil
+}
@@ -0,0 +1,198 @@
+package feed
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+const (
+	// maxFeedSize ограничивает размер загружаемой ленты
+	maxFeedSize = 4 << 20
+	// fetchTimeout ограничивает загрузку ленты
+	fetchTimeout = 30 * time.Second
+)
+
+var ErrInvalidFeed = errors.New("invalid feed")
+
+// Item описывает раздачу из ленты
+type Item struct {
+	GUID      string
+	Title     string
+	Magnet    string // Магнет-ссылка, если лента ее содержит или указывает info hash
+	Link      string // Ссылка на .torrent файл
+	Published time.Time
+}
+
+// Key возвращает идентификатор раздачи внутри ленты
+func (i *Item) Key() string {
+	switch {
+	case i.GUID != "":
+		return i.GUID
+	case i.Link != "":
+		return i.Link
+	case i.Magnet != "":
+		return i.Magnet
+	}
+	return i.Title
+}
+
+type rss struct {
+	XMLName xml.Name
+	Items   []rssItem  `xml:"channel>item"` // RSS 2.0
+	Entries []atomItem `xml:"entry"`        // Atom
+}
+
+type rssItem struct {
+	Title     string `xml:"title"`
+	Link      string `xml:"link"`
+	GUID      string `xml:"guid"`
+	PubDate   string `xml:"pubDate"`
+	Enclosure struct {
+		URL string `xml:"url,attr"`
+	} `xml:"enclosure"`
+	MagnetURI string `xml:"magnetURI"` // Пространство имен torrent (ezRSS)
+	InfoHash  string `xml:"infoHash"`
+	Attrs     []struct {
+		Name  string `xml:"name,attr"`
+		Value string `xml:"value,attr"`
+	} `xml:"attr"` // torznab:attr
+}
+
+type atomItem struct {
+	ID      string `xml:"id"`
+	Title   string `xml:"title"`
+	Updated string `xml:"updated"`
+	Links   []struct {
+		Href string `xml:"href,attr"`
+		Rel  string `xml:"rel,attr"`
+		Type string `xml:"type,attr"`
+	} `xml:"link"`
+}
+
+// Fetch загружает и разбирает ленту по подготовленному запросу
+func Fetch(client *http.Client, req *http.Request) ([]Item, error) {
+	ctx, cancel := context.WithTimeout(req.Context(), fetchTimeout)
+	defer cancel()
+
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("feed returned %s", resp.Status)
+	}
+
+	return Parse(io.LimitReader(resp.Body, maxFeedSize))
+}
+
+// Parse разбирает ленту RSS 2.0 или Atom
+func Parse(r io.Reader) ([]Item, error) {
+	var doc rss
+	decoder := xml.NewDecoder(r)
+	decoder.Strict = false
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidFeed, err)
+	}
+	if doc.XMLName.Local != "rss" && doc.XMLName.Local != "feed" {
+		return nil, ErrInvalidFeed
+	}
+
+	items := make([]Item, 0, len(doc.Items)+len(doc.Entries))
+	for _, ri := range doc.Items {
+		items = append(items, ri.item())
+	}
+	for _, ai := range doc.Entries {
+		items = append(items, ai.item())
+	}
+
+	return items, nil
+}
+
+func (ri *rssItem) item() Item {
+	item := Item{
+		GUID:   strings.TrimSpace(ri.GUID),
+		Title:  strings.TrimSpace(ri.Title),
+		Magnet: strings.TrimSpace(ri.MagnetURI),
+	}
+	for _, layout := range []string{time.RFC1123Z, time.RFC1123} {
+		if published, err := time.Parse(layout, strings.TrimSpace(ri.PubDate)); err == nil {
+			item.Published = published
+			break
+		}
+	}
+
+	hash := strings.TrimSpace(ri.InfoHash)
+	for _, attr := range ri.Attrs {
+		switch attr.Name {
+		case "magneturl":
+			item.Magnet = attr.Value
+		case "infohash":
+			hash = attr.Value
+		}
+	}
+
+	item.addLink(ri.Enclosure.URL)
+	item.addLink(ri.Link)
+	item.addHash(hash)
+
+	return item
+}
+
+func (ai *atomItem) item() Item {
+	item := Item{
+		GUID:  strings.TrimSpace(ai.ID),
+		Title: strings.TrimSpace(ai.Title),
+	}
+	if published, err := time.Parse(time.RFC3339, strings.TrimSpace(ai.Updated)); err == nil {
+		item.Published = published
+	}
+
+	// Ссылка на .torrent предпочтительнее ссылки на страницу раздачи
+	for _, link := range ai.Links {
+		if link.Rel == "enclosure" || link.Type == "application/x-bittorrent" {
+			item.addLink(link.Href)
+		}
+	}
+	for _, link := range ai.Links {
+		item.addLink(link.Href)
+	}
+
+	return item
+}
+
+// addLink запоминает ссылку, если такой еще нет
+func (i *Item) addLink(link string) {
+	link = strings.TrimSpace(link)
+	switch {
+	case link == "":
+	case strings.HasPrefix(link, "magnet:"):
+		if i.Magnet == "" {
+			i.Magnet = link
+		}
+	case i.Link == "":
+		i.Link = link
+	}
+}
+
+// addHash собирает магнет-ссылку по info hash, если ее нет в ленте
+func (i *Item) addHash(hex string) {
+	if i.Magnet != "" || hex == "" {
+		return
+	}
+
+	var hash metainfo.Hash
+	if err := hash.FromHexString(hex); err != nil {
+		return
+	}
+	i.Magnet = metainfo.Magnet{InfoHash: hash, DisplayName: i.Title}.String()
+}
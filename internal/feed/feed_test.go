@@ -0,0 +1,150 @@
+package feed
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testHash = "0123456789abcdef0123456789abcdef01234567"
+
+const rssFeed = `<?xml version="1.0"?>
+<rss version="2.0" xmlns:torrent="http://xmlns.ezrss.it/0.1/" xmlns:torznab="http://torznab.com/schemas/2015/feed">
+<channel>
+  <item>
+    <title>Show S01E01 1080p</title>
+    <guid>https://tracker.example/1</guid>
+    <link>https://tracker.example/download/1.torrent</link>
+    <pubDate>Wed, 01 May 2024 12:00:00 +0000</pubDate>
+  </item>
+  <item>
+    <title> Show S01E02 1080p </title>
+    <link>magnet:?xt=urn:btih:` + testHash + `</link>
+    <enclosure url="https://tracker.example/download/2.torrent" type="application/x-bittorrent"/>
+  </item>
+  <item>
+    <title>Show S01E03 1080p</title>
+    <torrent:infoHash>` + testHash + `</torrent:infoHash>
+  </item>
+  <item>
+    <title>Show S01E04 1080p</title>
+    <torznab:attr name="magneturl" value="magnet:?xt=urn:btih:` + testHash + `&amp;dn=torznab"/>
+  </item>
+</channel>
+</rss>`
+
+const atomFeed = `<?xml version="1.0" encoding="utf-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+  <entry>
+    <id>urn:uuid:1</id>
+    <title>Show S02E01</title>
+    <updated>2024-05-02T10:00:00Z</updated>
+    <link rel="alternate" href="https://tracker.example/details/1"/>
+    <link rel="enclosure" type="application/x-bittorrent" href="https://tracker.example/download/3.torrent"/>
+  </entry>
+</feed>`
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		feed string
+		want []Item
+	}{
+		{
+			name: "rss",
+			feed: rssFeed,
+			want: []Item{
+				{GUID: "https://tracker.example/1", Title: "Show S01E01 1080p", Link: "https://tracker.example/download/1.torrent",
+					Published: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)},
+				{Title: "Show S01E02 1080p", Link: "https://tracker.example/download/2.torrent", Magnet: "magnet:?xt=urn:btih:" + testHash},
+				{Title: "Show S01E03 1080p", Magnet: "magnet:?xt=urn:btih:" + testHash + "&dn=Show+S01E03+1080p"},
+				{Title: "Show S01E04 1080p", Magnet: "magnet:?xt=urn:btih:" + testHash + "&dn=torznab"},
+			},
+		},
+		{
+			name: "atom",
+			feed: atomFeed,
+			want: []Item{
+				{GUID: "urn:uuid:1", Title: "Show S02E01", Link: "https://tracker.example/download/3.torrent",
+					Published: time.Date(2024, 5, 2, 10, 0, 0, 0, time.UTC)},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(strings.NewReader(tt.feed))
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("Parse() = %d items, want %d", len(got), len(tt.want))
+			}
+			for i := range got {
+				if !got[i].Published.Equal(tt.want[i].Published) {
+					t.Errorf("item %d published = %s, want %s", i, got[i].Published, tt.want[i].Published)
+				}
+				got[i].Published, tt.want[i].Published = time.Time{}, time.Time{}
+				if !reflect.DeepEqual(got[i], tt.want[i]) {
+					t.Errorf("item %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+
+	for _, invalid := range []string{"", "<html><body>not a feed</body></html>"} {
+		if _, err := Parse(strings.NewReader(invalid)); !errors.Is(err, ErrInvalidFeed) {
+			t.Errorf("Parse(%q) error = %v, want %v", invalid, err, ErrInvalidFeed)
+		}
+	}
+}
+
+func TestItemKey(t *testing.T) {
+	tests := []struct {
+		item Item
+		want string
+	}{
+		{Item{GUID: "guid", Link: "link", Magnet: "magnet", Title: "title"}, "guid"},
+		{Item{Link: "link", Magnet: "magnet", Title: "title"}, "link"},
+		{Item{Magnet: "magnet", Title: "title"}, "magnet"},
+		{Item{Title: "title"}, "title"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.item.Key(); got != tt.want {
+			t.Errorf("Key() = %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestFetch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/rss" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(atomFeed))
+	}))
+	defer srv.Close()
+
+	request := func(path string) *http.Request {
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, srv.URL+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return req
+	}
+
+	items, err := Fetch(srv.Client(), request("/rss"))
+	if err != nil || len(items) != 1 {
+		t.Errorf("Fetch() = %+v, %v", items, err)
+	}
+	if _, err := Fetch(srv.Client(), request("/missing")); err == nil || err.Error() != "feed returned 404 Not Found" {
+		t.Errorf("Fetch() error = %v", err)
+	}
+}
@@ -0,0 +1,90 @@
+package feed
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	// episodePatterns распознают номер серии: S01E02 и 1x02
+	episodePatterns = []*regexp.Regexp{
+		regexp.MustCompile(`(?i)\bS(\d{1,2})[ ._-]?E(\d{1,4})\b`),
+		regexp.MustCompile(`(?i)\b(\d{1,2})x(\d{2,4})\b`),
+	}
+	nonAlnum = regexp.MustCompile(`[^\p{L}\p{N}]+`)
+)
+
+// Rules отбирает раздачи по названию. Раздача подходит, если совпадает
+// хотя бы с одним правилом включения (или их нет) и ни с одним правилом
+// исключения. Регистр букв не учитывается.
+type Rules struct {
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+}
+
+func CompileRules(include, exclude []string) (*Rules, error) {
+	rules := &Rules{}
+
+	var err error
+	if rules.include, err = compile(include); err != nil {
+		return nil, err
+	}
+	if rules.exclude, err = compile(exclude); err != nil {
+		return nil, err
+	}
+
+	return rules, nil
+}
+
+func compile(patterns []string) ([]*regexp.Regexp, error) {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, p := range patterns {
+		re, err := regexp.Compile("(?i)" + p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rule %q: %w", p, err)
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+// Match сообщает, подходит ли название под правила
+func (r *Rules) Match(title string) bool {
+	for _, re := range r.exclude {
+		if re.MatchString(title) {
+			return false
+		}
+	}
+
+	if len(r.include) == 0 {
+		return true
+	}
+	for _, re := range r.include {
+		if re.MatchString(title) {
+			return true
+		}
+	}
+	return false
+}
+
+// Episode возвращает ключ серии вида "show name s01e02", одинаковый для
+// раздач одной серии в разном качестве, или пустую строку, если название
+// не содержит номера серии
+func Episode(title string) string {
+	for _, re := range episodePatterns {
+		m := re.FindStringSubmatchIndex(title)
+		if m == nil {
+			continue
+		}
+
+		var season, episode int
+		fmt.Sscan(title[m[2]:m[3]], &season)
+		fmt.Sscan(title[m[4]:m[5]], &episode)
+
+		show := strings.TrimSpace(nonAlnum.ReplaceAllString(strings.ToLower(title[:m[0]]), " "))
+		return fmt.Sprintf("%s s%02de%02d", show, season, episode)
+	}
+
+	return ""
+}
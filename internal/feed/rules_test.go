@@ -0,0 +1,61 @@
+package feed
+
+import "testing"
+
+func TestEpisode(t *testing.T) {
+	tests := []struct {
+		title string
+		want  string
+	}{
+		{"Show.Name.S01E02.1080p.WEB-DL", "show name s01e02"},
+		{"Show Name S01E02 720p HDTV", "show name s01e02"},
+		{"[Group] Show Name - 1x02 [720p]", "group show name s01e02"},
+		{"Show.Name.s2.e105", "show name s02e105"},
+		{"Шоу (2024) S03E04", "шоу 2024 s03e04"},
+		{"Movie 2024 1920x1080", ""},
+		{"Movie 2024 1080p", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			if got := Episode(tt.title); got != tt.want {
+				t.Errorf("Episode() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		include []string
+		exclude []string
+		title   string
+		want    bool
+	}{
+		{"no rules", nil, nil, "Anything", true},
+		{"include matches", []string{"1080p", "2160p"}, nil, "Show S01E01 2160P WEB", true},
+		{"include does not match", []string{"1080p"}, nil, "Show S01E01 720p", false},
+		{"exclude wins", []string{"1080p"}, []string{`\bcam\b`}, "Movie 1080p CAM", false},
+		{"exclude only", nil, []string{"x265"}, "Show S01E01 x264", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := CompileRules(tt.include, tt.exclude)
+			if err != nil {
+				t.Fatalf("CompileRules() error = %v", err)
+			}
+			if got := rules.Match(tt.title); got != tt.want {
+				t.Errorf("Match(%q) = %v, want %v", tt.title, got, tt.want)
+			}
+		})
+	}
+
+	if _, err := CompileRules([]string{"("}, nil); err == nil {
+		t.Error("CompileRules() accepted an invalid pattern")
+	}
+	if _, err := CompileRules(nil, []string{"[a-"}); err == nil {
+		t.Error("CompileRules() accepted an invalid exclude pattern")
+	}
+}
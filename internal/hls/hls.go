@@ -0,0 +1,90 @@
+package hls
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+)
+
+// TargetDuration задает желаемую длительность сегмента
+const TargetDuration = 6 * time.Second
+
+var ErrUnsupported = errors.New("container is not supported for HLS")
+
+// Segment описывает сегмент потока HLS
+type Segment struct {
+	Start    time.Duration
+	Duration time.Duration
+	Keyframe int // Индекс ключевого кадра, с которого начинается сегмент
+}
+
+// Source формирует сегменты фрагментированного MP4 из файла-контейнера.
+// Источник хранит только индекс, а данные читает из переданного reader,
+// поэтому может использоваться одновременно несколькими запросами.
+type Source interface {
+	Segments() []Segment
+	WriteInit(w io.Writer) error
+	WriteSegment(w io.Writer, r io.ReadSeeker, index int) error
+}
+
+// Plan объединяет интервалы между ключевыми кадрами в сегменты не короче
+// TargetDuration. keyframes должны быть упорядочены по возрастанию.
+func Plan(keyframes []time.Duration, total time.Duration) []Segment {
+	var segments []Segment
+
+	for i, kf := range keyframes {
+		if n := len(segments); n > 0 && kf-segments[n-1].Start < TargetDuration {
+			continue
+		}
+		if n := len(segments); n > 0 {
+			segments[n-1].Duration = kf - segments[n-1].Start
+		}
+		segments = append(segments, Segment{Start: kf, Keyframe: i})
+	}
+
+	if n := len(segments); n > 0 {
+		segments[n-1].Duration = max(total-segments[n-1].Start, 0)
+
+		// Слишком короткий последний сегмент присоединяется к предыдущему
+		if n > 1 && segments[n-1].Duration < TargetDuration/3 {
+			segments[n-2].Duration += segments[n-1].Duration
+			segments = segments[:n-1]
+		}
+	}
+
+	return segments
+}
+
+// WritePlaylist записывает медиаплейлист VOD. query добавляется к адресам
+// сегментов, чтобы передать токен и выбранную дорожку.
+func WritePlaylist(w io.Writer, segments []Segment, query string) error {
+	if query != "" {
+		query = "?" + query
+	}
+
+	var target time.Duration
+	for _, s := range segments {
+		target = max(target, s.Duration)
+	}
+
+	var sb strings.Builder
+	sb.WriteString("#EXTM3U\n")
+	sb.WriteString("#EXT-X-VERSION:7\n")
+	fmt.Fprintf(&sb, "#EXT-X-TARGETDURATION:%d\n", int(math.Ceil(target.Seconds())))
+	sb.WriteString("#EXT-X-PLAYLIST-TYPE:VOD\n")
+	sb.WriteString("#EXT-X-MEDIA-SEQUENCE:0\n")
+	sb.WriteString("#EXT-X-INDEPENDENT-SEGMENTS\n")
+	fmt.Fprintf(&sb, "#EXT-X-MAP:URI=\"init.mp4%s\"\n", query)
+
+	for i, s := range segments {
+		fmt.Fprintf(&sb, "#EXTINF:%.3f,\n", s.Duration.Seconds())
+		fmt.Fprintf(&sb, "%d.m4s%s\n", i, query)
+	}
+	sb.WriteString("#EXT-X-ENDLIST\n")
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
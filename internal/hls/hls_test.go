@@ -0,0 +1,98 @@
+package hls
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func seconds(values ...float64) []time.Duration {
+	result := make([]time.Duration, len(values))
+	for i, v := range values {
+		result[i] = time.Duration(v * float64(time.Second))
+	}
+	return result
+}
+
+func TestPlan(t *testing.T) {
+	s := time.Second
+
+	tests := []struct {
+		name      string
+		keyframes []time.Duration
+		total     time.Duration
+		want      []Segment
+	}{
+		{"no keyframes", nil, 10 * s, nil},
+		{"single keyframe", seconds(0), 10 * s, []Segment{{Start: 0, Duration: 10 * s, Keyframe: 0}}},
+		{
+			"regular keyframes", seconds(0, 2, 4, 6, 8, 10, 12, 14, 16, 18), 20 * s,
+			[]Segment{
+				{Start: 0, Duration: 6 * s, Keyframe: 0},
+				{Start: 6 * s, Duration: 6 * s, Keyframe: 3},
+				{Start: 12 * s, Duration: 6 * s, Keyframe: 6},
+				{Start: 18 * s, Duration: 2 * s, Keyframe: 9},
+			},
+		},
+		{
+			"short tail merged", seconds(0, 6, 12), 13 * s,
+			[]Segment{
+				{Start: 0, Duration: 6 * s, Keyframe: 0},
+				{Start: 6 * s, Duration: 7 * s, Keyframe: 1},
+			},
+		},
+		{
+			"long gop", seconds(0, 10, 11, 17), 25 * s,
+			[]Segment{
+				{Start: 0, Duration: 10 * s, Keyframe: 0},
+				{Start: 10 * s, Duration: 7 * s, Keyframe: 1},
+				{Start: 17 * s, Duration: 8 * s, Keyframe: 3},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Plan(tt.keyframes, tt.total); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Plan() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWritePlaylist(t *testing.T) {
+	segments := []Segment{
+		{Start: 0, Duration: 6 * time.Second},
+		{Start: 6 * time.Second, Duration: 6500 * time.Millisecond},
+	}
+
+	want := "#EXTM3U\n" +
+		"#EXT-X-VERSION:7\n" +
+		"#EXT-X-TARGETDURATION:7\n" +
+		"#EXT-X-PLAYLIST-TYPE:VOD\n" +
+		"#EXT-X-MEDIA-SEQUENCE:0\n" +
+		"#EXT-X-INDEPENDENT-SEGMENTS\n" +
+		"#EXT-X-MAP:URI=\"init.mp4?token=t&audio=1\"\n" +
+		"#EXTINF:6.000,\n" +
+		"0.m4s?token=t&audio=1\n" +
+		"#EXTINF:6.500,\n" +
+		"1.m4s?token=t&audio=1\n" +
+		"#EXT-X-ENDLIST\n"
+
+	var buf bytes.Buffer
+	if err := WritePlaylist(&buf, segments, "token=t&audio=1"); err != nil {
+		t.Fatalf("WritePlaylist() error = %v", err)
+	}
+	if got := buf.String(); got != want {
+		t.Errorf("WritePlaylist() =\n%s\nwant\n%s", got, want)
+	}
+
+	buf.Reset()
+	if err := WritePlaylist(&buf, segments, ""); err != nil {
+		t.Fatalf("WritePlaylist() error = %v", err)
+	}
+	if !bytes.Contains(buf.Bytes(), []byte("\n0.m4s\n")) || !bytes.Contains(buf.Bytes(), []byte("URI=\"init.mp4\"")) {
+		t.Errorf("WritePlaylist() without query =\n%s", buf.String())
+	}
+}
@@ -0,0 +1,247 @@
+package hls
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"retreat-backend/internal/mp4"
+)
+
+const (
+	// maxSegmentSize ограничивает объем сэмплов одного сегмента, читаемых в память
+	maxSegmentSize = 256 << 20
+	// maxSpan ограничивает диапазон, читаемый одним запросом при сборке сегмента
+	maxSpan = 64 << 20
+)
+
+var ErrTrackNotFound = errors.New("track not found")
+
+// mp4Source нарезает нефрагментированный MP4 на сегменты по таблицам сэмплов
+type mp4Source struct {
+	tracks   []*mp4.Track // Видео (если есть) и выбранное аудио
+	main     *mp4.Track   // Дорожка, по ключевым кадрам которой режутся сегменты
+	syncs    []int        // Индексы ключевых сэмплов main
+	segments []Segment
+	duration time.Duration
+}
+
+// NewMP4Source читает moov и строит сегменты по ключевым кадрам видео.
+// audio задает номер аудиодорожки среди аудиодорожек файла, -1 выбирает первую.
+func NewMP4Source(r io.ReadSeeker, size int64, audio int) (Source, error) {
+	boxes, err := mp4.ReadBoxes(r, 0, size)
+	if err != nil {
+		return nil, err
+	}
+
+	var moov []byte
+	for _, b := range boxes {
+		if b.Type != "moov" {
+			continue
+		}
+		if moov, err = mp4.ReadBox(r, b); err != nil {
+			return nil, err
+		}
+		moov = moov[b.HeaderSize:]
+		break
+	}
+	if moov == nil {
+		return nil, fmt.Errorf("%w: moov not found", mp4.ErrInvalidBox)
+	}
+
+	tracks, err := mp4.ReadTracks(moov)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &mp4Source{}
+	var audioTracks []*mp4.Track
+	for _, t := range tracks {
+		if len(t.Samples) == 0 {
+			continue
+		}
+		switch t.Handler {
+		case "vide":
+			if s.main == nil {
+				s.main = t
+				s.tracks = append(s.tracks, t)
+			}
+		case "soun":
+			audioTracks = append(audioTracks, t)
+		}
+	}
+
+	if len(audioTracks) > 0 {
+		if audio >= len(audioTracks) {
+			return nil, fmt.Errorf("%w: audio %d", ErrTrackNotFound, audio)
+		}
+		selected := audioTracks[max(audio, 0)]
+		s.tracks = append(s.tracks, selected)
+		if s.main == nil {
+			s.main = selected
+		}
+	}
+	if s.main == nil {
+		return nil, fmt.Errorf("%w: no audio or video", ErrTrackNotFound)
+	}
+
+	for _, t := range s.tracks {
+		last := t.Samples[len(t.Samples)-1]
+		s.duration = max(s.duration, ticksToDuration(last.Time+int64(last.Duration), t.Timescale))
+	}
+
+	var keyframes []time.Duration
+	for i, sample := range s.main.Samples {
+		if sample.Sync {
+			s.syncs = append(s.syncs, i)
+			keyframes = append(keyframes, ticksToDuration(sample.Time, s.main.Timescale))
+		}
+	}
+	s.segments = Plan(keyframes, s.duration)
+
+	return s, nil
+}
+
+func (s *mp4Source) Segments() []Segment {
+	return s.segments
+}
+
+func (s *mp4Source) WriteInit(w io.Writer) error {
+	configs := make([]mp4.TrackConfig, 0, len(s.tracks))
+	for _, t := range s.tracks {
+		configs = append(configs, t.Config())
+	}
+
+	return mp4.WriteInit(w, configs, uint64(s.duration.Milliseconds()), 1000)
+}
+
+func (s *mp4Source) WriteSegment(w io.Writer, r io.ReadSeeker, index int) error {
+	if index < 0 || index >= len(s.segments) {
+		return fmt.Errorf("segment not found: %d", index)
+	}
+
+	// Границы сегмента задаются временем декодирования ключевых кадров main
+	start := s.main.Samples[s.syncs[s.segments[index].Keyframe]].Time
+	end := int64(-1)
+	if index+1 < len(s.segments) {
+		end = s.main.Samples[s.syncs[s.segments[index+1].Keyframe]].Time
+	}
+
+	var fragments []mp4.TrackFragment
+	var samples []*mp4.SampleInfo
+	for _, t := range s.tracks {
+		from, to := sampleRange(t, start, end, s.main.Timescale)
+		if from >= to {
+			continue
+		}
+
+		fragment := mp4.TrackFragment{
+			TrackId:  t.Id,
+			BaseTime: uint64(t.Samples[from].Time),
+			Samples:  make([]mp4.Sample, 0, to-from),
+		}
+		for i := from; i < to; i++ {
+			info := &t.Samples[i]
+			fragment.Samples = append(fragment.Samples, mp4.Sample{
+				Duration:          info.Duration,
+				CompositionOffset: info.CompositionOffset,
+				Keyframe:          info.Sync,
+			})
+			samples = append(samples, info)
+		}
+		fragments = append(fragments, fragment)
+	}
+
+	data, err := readSamples(r, samples)
+	if err != nil {
+		return err
+	}
+
+	i := 0
+	for f := range fragments {
+		for j := range fragments[f].Samples {
+			fragments[f].Samples[j].Data = data[i]
+			i++
+		}
+	}
+
+	return mp4.WriteFragment(w, uint32(index+1), fragments)
+}
+
+// sampleRange возвращает сэмплы дорожки, время декодирования которых попадает
+// в [start, end) (в единицах timescale main); end = -1 означает конец файла
+func sampleRange(t *mp4.Track, start, end int64, timescale uint32) (int, int) {
+	convert := func(ts int64) int64 {
+		return ts * int64(t.Timescale) / int64(timescale)
+	}
+
+	find := func(ts int64) int {
+		return sort.Search(len(t.Samples), func(i int) bool {
+			return t.Samples[i].Time >= ts
+		})
+	}
+
+	from := find(convert(start))
+	to := len(t.Samples)
+	if end >= 0 {
+		to = find(convert(end))
+	}
+
+	return from, to
+}
+
+// readSamples читает данные сэмплов. Сэмплы сегмента обычно лежат рядом,
+// поэтому их диапазон читается одним запросом, если он не слишком велик.
+func readSamples(r io.ReadSeeker, samples []*mp4.SampleInfo) ([][]byte, error) {
+	if len(samples) == 0 {
+		return nil, nil
+	}
+
+	low, high := samples[0].Offset, int64(0)
+	var total int64
+	for _, s := range samples {
+		low = min(low, s.Offset)
+		high = max(high, s.Offset+int64(s.Size))
+		total += int64(s.Size)
+	}
+	// Размеры сэмплов заданы в файле и не должны приводить к выделению произвольного объема памяти
+	if total > maxSegmentSize {
+		return nil, fmt.Errorf("segment is too large: %d bytes", total)
+	}
+
+	result := make([][]byte, len(samples))
+
+	if high-low <= max(maxSpan, 2*total) {
+		span := make([]byte, high-low)
+		if err := readAt(r, span, low); err != nil {
+			return nil, err
+		}
+		for i, s := range samples {
+			result[i] = span[s.Offset-low : s.Offset-low+int64(s.Size)]
+		}
+		return result, nil
+	}
+
+	for i, s := range samples {
+		result[i] = make([]byte, s.Size)
+		if err := readAt(r, result[i], s.Offset); err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+func readAt(r io.ReadSeeker, p []byte, offset int64) error {
+	if _, err := r.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	_, err := io.ReadFull(r, p)
+	return err
+}
+
+func ticksToDuration(ticks int64, timescale uint32) time.Duration {
+	return time.Duration(float64(ticks) / float64(timescale) * float64(time.Second))
+}
@@ -0,0 +1,196 @@
+package hls
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"retreat-backend/internal/mp4"
+)
+
+func u32(v uint32) []byte {
+	return binary.BigEndian.AppendUint32(nil, v)
+}
+
+func box(boxType string, parts ...[]byte) []byte {
+	data := bytes.Join(parts, nil)
+	return bytes.Join([][]byte{u32(uint32(len(data) + 8)), []byte(boxType), data}, nil)
+}
+
+func fullBox(boxType string, parts ...[]byte) []byte {
+	return box(boxType, append([][]byte{u32(0)}, parts...)...)
+}
+
+// testTrack описывает дорожку тестового файла: все сэмплы одной длительности
+// лежат одним чанком, syncs — номера ключевых сэмплов с единицы
+type testTrack struct {
+	id        uint32
+	handler   string
+	timescale uint32
+	delta     uint32
+	samples   []string
+	syncs     []uint32
+}
+
+func (tt testTrack) trak(offset uint32) []byte {
+	stsz := [][]byte{u32(0), u32(uint32(len(tt.samples)))}
+	for _, s := range tt.samples {
+		stsz = append(stsz, u32(uint32(len(s))))
+	}
+
+	stbl := [][]byte{
+		fullBox("stsd", u32(1), box("avc1", make([]byte, 8))),
+		fullBox("stsz", stsz...),
+		fullBox("stts", u32(1), u32(uint32(len(tt.samples))), u32(tt.delta)),
+		fullBox("stsc", u32(1), u32(1), u32(uint32(len(tt.samples))), u32(1)),
+		fullBox("stco", u32(1), u32(offset)),
+	}
+	if tt.syncs != nil {
+		stss := [][]byte{u32(uint32(len(tt.syncs)))}
+		for _, s := range tt.syncs {
+			stss = append(stss, u32(s))
+		}
+		stbl = append(stbl, fullBox("stss", stss...))
+	}
+
+	return box("trak",
+		fullBox("tkhd", u32(0), u32(0), u32(tt.id), make([]byte, 64)),
+		box("mdia",
+			fullBox("mdhd", u32(0), u32(0), u32(tt.timescale), u32(0), u32(0x55c40000)),
+			fullBox("hdlr", u32(0), []byte(tt.handler), make([]byte, 12)),
+			box("minf", box("stbl", stbl...)),
+		),
+	)
+}
+
+// testFile собирает ftyp + mdat + moov с данными дорожек внутри mdat
+func testFile(tracks ...testTrack) []byte {
+	ftyp := box("ftyp", []byte("isom"), u32(0))
+
+	var payload []byte
+	var traks [][]byte
+	for _, tt := range tracks {
+		offset := uint32(len(ftyp) + 8 + len(payload))
+		for _, s := range tt.samples {
+			payload = append(payload, s...)
+		}
+		traks = append(traks, tt.trak(offset))
+	}
+
+	return bytes.Join([][]byte{ftyp, box("mdat", payload), box("moov", traks...)}, nil)
+}
+
+func samples(prefix string, n int) []string {
+	result := make([]string, n)
+	for i := range result {
+		result[i] = fmt.Sprintf("%s%d", prefix, i)
+	}
+	return result
+}
+
+func TestMP4Source(t *testing.T) {
+	// Видео: 6 сэмплов по 3 с, ключевые 1, 3 и 5. Аудио: 3 сэмпла по 6 с.
+	video := testTrack{id: 1, handler: "vide", timescale: 1000, delta: 3000, samples: samples("v", 6), syncs: []uint32{1, 3, 5}}
+	audio := testTrack{id: 2, handler: "soun", timescale: 100, delta: 600, samples: samples("a", 3)}
+	data := testFile(video, audio)
+
+	source, err := NewMP4Source(bytes.NewReader(data), int64(len(data)), -1)
+	if err != nil {
+		t.Fatalf("NewMP4Source() error = %v", err)
+	}
+
+	want := []Segment{
+		{Start: 0, Duration: 6 * time.Second, Keyframe: 0},
+		{Start: 6 * time.Second, Duration: 6 * time.Second, Keyframe: 1},
+		{Start: 12 * time.Second, Duration: 6 * time.Second, Keyframe: 2},
+	}
+	if got := source.Segments(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Segments() = %+v, want %+v", got, want)
+	}
+
+	var init bytes.Buffer
+	if err := source.WriteInit(&init); err != nil {
+		t.Fatalf("WriteInit() error = %v", err)
+	}
+	moov, _ := mp4.FindBox(init.Bytes(), "moov")
+	if traks := mp4.FindBoxes(moov, "trak"); len(traks) != 2 {
+		t.Errorf("init tracks = %d, want 2", len(traks))
+	}
+
+	tests := []struct {
+		index int
+		mdat  string
+		base  []uint64 // Время начала фрагментов видео и аудио
+	}{
+		{0, "v0v1a0", []uint64{0, 0}},
+		{1, "v2v3a1", []uint64{6000, 600}},
+		{2, "v4v5a2", []uint64{12000, 1200}},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.index), func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := source.WriteSegment(&buf, bytes.NewReader(data), tt.index); err != nil {
+				t.Fatalf("WriteSegment() error = %v", err)
+			}
+
+			boxes, err := mp4.ParseBoxes(buf.Bytes())
+			if err != nil || len(boxes) != 2 {
+				t.Fatalf("boxes = %+v, %v", boxes, err)
+			}
+			if got := string(buf.Bytes()[boxes[1].DataOffset():]); got != tt.mdat {
+				t.Errorf("mdat = %q, want %q", got, tt.mdat)
+			}
+
+			moof := buf.Bytes()[boxes[0].DataOffset():boxes[0].End()]
+			for i, traf := range mp4.FindBoxes(moof, "traf") {
+				tfdt, _ := mp4.FindBox(traf, "tfdt")
+				if base := binary.BigEndian.Uint64(tfdt[4:]); base != tt.base[i] {
+					t.Errorf("traf %d base time = %d, want %d", i, base, tt.base[i])
+				}
+			}
+		})
+	}
+
+	if err := source.WriteSegment(&bytes.Buffer{}, bytes.NewReader(data), len(want)); err == nil {
+		t.Error("WriteSegment() out of range: want error")
+	}
+}
+
+func TestMP4SourceTracks(t *testing.T) {
+	video := testTrack{id: 1, handler: "vide", timescale: 1000, delta: 3000, samples: samples("v", 2)}
+	audio := testTrack{id: 2, handler: "soun", timescale: 100, delta: 600, samples: samples("a", 1)}
+
+	tests := []struct {
+		name   string
+		tracks []testTrack
+		audio  int
+		err    error
+	}{
+		{"video and audio", []testTrack{video, audio}, 0, nil},
+		{"audio only", []testTrack{audio}, -1, nil},
+		{"missing audio", []testTrack{video, audio}, 1, ErrTrackNotFound},
+		{"no tracks", nil, -1, ErrTrackNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := testFile(tt.tracks...)
+			_, err := NewMP4Source(bytes.NewReader(data), int64(len(data)), tt.audio)
+			if !errors.Is(err, tt.err) {
+				t.Errorf("NewMP4Source() error = %v, want %v", err, tt.err)
+			}
+		})
+	}
+
+	// Файл без moov (например, обрезанный) отклоняется
+	data := testFile(video)
+	data = data[:bytes.Index(data, []byte("moov"))-4]
+	if _, err := NewMP4Source(bytes.NewReader(data), int64(len(data)), -1); !errors.Is(err, mp4.ErrInvalidBox) {
+		t.Errorf("NewMP4Source() without moov error = %v, want %v", err, mp4.ErrInvalidBox)
+	}
+}
@@ -0,0 +1,346 @@
+package mkv
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+)
+
+// maxBlockSize ограничивает размер блока, читаемого в память
+const maxBlockSize = 32 << 20
+
+// Frame описывает кадр (пакет) дорожки
+type Frame struct {
+	Track    int
+	Time     time.Duration // Время отображения
+	Duration time.Duration // Длительность, если известна
+	Keyframe bool
+	Data     []byte
+}
+
+// Demuxer последовательно читает кадры из кластеров Matroska
+type Demuxer struct {
+	*Header
+
+	r   io.ReadSeeker
+	br  *bufio.Reader
+	pos int64
+
+	clusterTime int64
+	limit       int64 // Смещение, на котором чтение кадров прекращается
+	pending     []*Frame
+	cues        []CuePoint
+	cuesLoaded  bool
+}
+
+// NewDemuxer читает заголовки и устанавливает позицию на первый кластер
+func NewDemuxer(r io.ReadSeeker, size int64) (*Demuxer, error) {
+	header, err := ReadHeader(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	return OpenDemuxer(r, header)
+}
+
+// OpenDemuxer создает Demuxer по уже прочитанным заголовкам
+func OpenDemuxer(r io.ReadSeeker, header *Header) (*Demuxer, error) {
+	d := &Demuxer{
+		Header: header,
+		r:      r,
+		br:     bufio.NewReaderSize(r, 64<<10),
+		limit:  header.SegmentEnd,
+	}
+
+	start := header.FirstCluster
+	if start == 0 {
+		if pos, ok := header.seeks[IdCluster]; ok {
+			start = header.SegmentStart + pos
+		} else {
+			return nil, fmt.Errorf("%w: cluster not found", ErrInvalidElement)
+		}
+	}
+	if err := d.seek(start); err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
+
+// SeekTime переходит к кластеру ближайшей точки индекса не позже t и возвращает
+// ее время. Если индекса нет, позиция не меняется и возвращается false.
+func (d *Demuxer) SeekTime(t time.Duration, track int) (time.Duration, bool, error) {
+	if !d.cuesLoaded {
+		d.cues, _ = d.ReadCues(d.r)
+		d.cuesLoaded = true
+	}
+
+	target := FindCue(d.cues, t, track)
+	if target == nil {
+		// Чтение индекса сдвинуло позицию reader, возвращаемся к текущему элементу
+		return 0, false, d.seek(d.pos)
+	}
+
+	if err := d.seek(target.Cluster); err != nil {
+		return 0, false, err
+	}
+
+	return target.Time, true, nil
+}
+
+// ReadFrame возвращает следующий кадр. В конце сегмента возвращается io.EOF.
+func (d *Demuxer) ReadFrame() (*Frame, error) {
+	for len(d.pending) == 0 {
+		if d.pos >= d.limit {
+			return nil, io.EOF
+		}
+
+		e, err := readElementHeader(d.br, d.pos)
+		if err != nil {
+			if err == io.ErrUnexpectedEOF {
+				err = io.EOF
+			}
+			return nil, err
+		}
+		d.pos += e.HeaderSize
+
+		// В кластер входим, чтобы читать его дочерние элементы как элементы верхнего уровня
+		if e.Id == IdCluster {
+			continue
+		}
+		if e.Size == UnknownSize {
+			return nil, fmt.Errorf("%w: %x has unknown size", ErrInvalidElement, e.Id)
+		}
+
+		switch e.Id {
+		case IdTimestamp, IdSimpleBlock, IdBlockGroup:
+			if e.Size > maxBlockSize {
+				return nil, fmt.Errorf("block is too large: %d bytes", e.Size)
+			}
+			data := make([]byte, e.Size)
+			if _, err := io.ReadFull(d.br, data); err != nil {
+				return nil, err
+			}
+			d.pos += e.Size
+
+			switch e.Id {
+			case IdTimestamp:
+				d.clusterTime = int64(Uint(data))
+			case IdSimpleBlock:
+				d.pending, err = d.parseBlock(data, true, 0)
+			case IdBlockGroup:
+				d.pending, err = d.parseBlockGroup(data)
+			}
+			if err != nil {
+				return nil, err
+			}
+		default:
+			if err := d.skip(e.Size); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	frame := d.pending[0]
+	d.pending = d.pending[1:]
+	return frame, nil
+}
+
+// SeekRange ограничивает чтение кластерами в диапазоне [start, end).
+// Границы должны совпадать с началами кластеров, например из индекса.
+func (d *Demuxer) SeekRange(start, end int64) error {
+	if err := d.seek(start); err != nil {
+		return err
+	}
+
+	d.limit = min(end, d.SegmentEnd)
+	return nil
+}
+
+func (d *Demuxer) seek(pos int64) error {
+	if _, err := d.r.Seek(pos, io.SeekStart); err != nil {
+		return err
+	}
+
+	d.br.Reset(d.r)
+	d.pos = pos
+	d.pending = nil
+	return nil
+}
+
+// skip пропускает содержимое элемента: небольшие элементы дочитываются,
+// крупные (например, Cues или вложения) пропускаются перемоткой
+func (d *Demuxer) skip(size int64) error {
+	if size <= int64(d.br.Buffered()) || size < 16<<10 {
+		if _, err := d.br.Discard(int(size)); err != nil {
+			return err
+		}
+		d.pos += size
+		return nil
+	}
+
+	return d.seek(d.pos + size)
+}
+
+func (d *Demuxer) parseBlockGroup(data []byte) ([]*Frame, error) {
+	elements, err := ParseElements(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var block []byte
+	var duration int64
+	keyframe := true
+	for _, e := range elements {
+		value := data[e.DataOffset():e.End()]
+		switch e.Id {
+		case IdBlock:
+			block = value
+		case IdBlockDuration:
+			duration = int64(Uint(value))
+		case IdReferenceBlock:
+			keyframe = false
+		}
+	}
+	if block == nil {
+		return nil, nil
+	}
+
+	frames, err := d.parseBlock(block, false, duration)
+	for _, f := range frames {
+		f.Keyframe = keyframe
+	}
+
+	return frames, err
+}
+
+// parseBlock разбирает Block или SimpleBlock, включая лейсинг
+func (d *Demuxer) parseBlock(data []byte, simple bool, duration int64) ([]*Frame, error) {
+	number, n := readBlockVint(data)
+	if n == 0 || len(data) < n+3 {
+		return nil, ErrInvalidElement
+	}
+
+	relative := int16(binary.BigEndian.Uint16(data[n:]))
+	flags := data[n+2]
+	payload := data[n+3:]
+
+	track, ok := d.Track(int(number))
+	if !ok {
+		return nil, nil
+	}
+
+	sizes, payload, err := lacing(flags>>1&3, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	start := d.toDuration(d.clusterTime + int64(relative))
+	frameDuration := track.DefaultDuration
+	if duration > 0 {
+		frameDuration = d.toDuration(duration) / time.Duration(len(sizes))
+	}
+
+	frames := make([]*Frame, 0, len(sizes))
+	for i, size := range sizes {
+		frames = append(frames, &Frame{
+			Track:    track.Number,
+			Time:     start + time.Duration(i)*frameDuration,
+			Duration: frameDuration,
+			Keyframe: simple && flags&0x80 != 0,
+			Data:     payload[:size],
+		})
+		payload = payload[size:]
+	}
+
+	return frames, nil
+}
+
+// readBlockVint читает номер дорожки блока
+func readBlockVint(data []byte) (int64, int) {
+	if len(data) == 0 {
+		return 0, 0
+	}
+
+	length := vintLength(data[0])
+	if length == 0 || length > len(data) {
+		return 0, 0
+	}
+
+	value, _ := decodeVint(data[:length], false)
+	return value, length
+}
+
+// lacing возвращает размеры кадров блока и данные после заголовка лейсинга
+func lacing(kind byte, data []byte) ([]int, []byte, error) {
+	if kind == 0 {
+		return []int{len(data)}, data, nil
+	}
+	if len(data) == 0 {
+		return nil, nil, ErrInvalidElement
+	}
+
+	count := int(data[0]) + 1
+	data = data[1:]
+	sizes := make([]int, count)
+
+	switch kind {
+	case 1: // Xiph
+		for i := 0; i < count-1; i++ {
+			for {
+				if len(data) == 0 {
+					return nil, nil, ErrInvalidElement
+				}
+				b := data[0]
+				data = data[1:]
+				sizes[i] += int(b)
+				if b != 0xff {
+					break
+				}
+			}
+		}
+	case 2: // Фиксированный
+		if len(data)%count != 0 {
+			return nil, nil, ErrInvalidElement
+		}
+		for i := range sizes {
+			sizes[i] = len(data) / count
+		}
+		return sizes, data, nil
+	case 3: // EBML
+		if count == 1 {
+			break
+		}
+		size, n := readBlockVint(data)
+		if n == 0 {
+			return nil, nil, ErrInvalidElement
+		}
+		sizes[0] = int(size)
+		data = data[n:]
+
+		for i := 1; i < count-1; i++ {
+			raw, n := readBlockVint(data)
+			if n == 0 {
+				return nil, nil, ErrInvalidElement
+			}
+			// Разница размеров хранится со смещением, чтобы быть знаковой
+			diff := raw - (int64(1)<<(7*n-1) - 1)
+			sizes[i] = sizes[i-1] + int(diff)
+			data = data[n:]
+		}
+	}
+
+	// Размеры сравниваются с остатком данных, чтобы их сумма не переполнилась
+	total := 0
+	for _, size := range sizes[:count-1] {
+		if size < 0 || size > len(data)-total {
+			return nil, nil, ErrInvalidElement
+		}
+		total += size
+	}
+	sizes[count-1] = len(data) - total
+
+	return sizes, data, nil
+}
@@ -0,0 +1,265 @@
+package mkv
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Идентификаторы элементов Matroska, используемые при разборе
+const (
+	IdEBML    = 0x1A45DFA3
+	IdDocType = 0x4282
+
+	IdSegment  = 0x18538067
+	IdSeekHead = 0x114D9B74
+	IdSeek     = 0x4DBB
+	IdSeekID   = 0x53AB
+	IdSeekPos  = 0x53AC
+	IdInfo     = 0x1549A966
+	IdTracks   = 0x1654AE6B
+	IdCues     = 0x1C53BB6B
+	IdCluster  = 0x1F43B675
+
+	IdTimestampScale = 0x2AD7B1
+	IdDuration       = 0x4489
+
+	IdTrackEntry    = 0xAE
+	IdTrackNumber   = 0xD7
+	IdTrackType     = 0x83
+	IdCodecID       = 0x86
+	IdCodecPrivate  = 0x63A2
+	IdDefaultDur    = 0x23E383
+	IdLanguage      = 0x22B59C
+	IdLanguageBCP47 = 0x22B59D
+	IdName          = 0x536E
+	IdFlagDefault   = 0x88
+	IdFlagForced    = 0x55AA
+	IdVideo         = 0xE0
+	IdPixelWidth    = 0xB0
+	IdPixelHeight   = 0xBA
+	IdAudio         = 0xE1
+	IdSampleRate    = 0xB5
+	IdOutputRate    = 0x78B5
+	IdChannels      = 0x9F
+
+	IdCuePoint     = 0xBB
+	IdCueTime      = 0xB3
+	IdCuePositions = 0xB7
+	IdCueTrack     = 0xF7
+	IdCueCluster   = 0xF1
+
+	IdTimestamp      = 0xE7
+	IdSimpleBlock    = 0xA3
+	IdBlockGroup     = 0xA0
+	IdBlock          = 0xA1
+	IdBlockDuration  = 0x9B
+	IdReferenceBlock = 0xFB
+)
+
+// Типы дорожек Matroska
+const (
+	TrackVideo    = 1
+	TrackAudio    = 2
+	TrackSubtitle = 17
+)
+
+// UnknownSize обозначает элемент неизвестного размера (продолжается до конца родителя)
+const UnknownSize = -1
+
+// Element описывает заголовок элемента EBML
+type Element struct {
+	Id         uint32
+	Offset     int64 // Смещение начала элемента, включая заголовок
+	Size       int64 // Размер содержимого или UnknownSize
+	HeaderSize int64
+}
+
+// DataOffset возвращает смещение содержимого элемента
+func (e Element) DataOffset() int64 {
+	return e.Offset + e.HeaderSize
+}
+
+// End возвращает смещение конца элемента
+func (e Element) End() int64 {
+	return e.DataOffset() + e.Size
+}
+
+// maxElementSize ограничивает размер элементов, читаемых в память целиком
+const maxElementSize = 64 << 20
+
+var ErrInvalidElement = errors.New("invalid ebml element")
+
+// ReadElementHeader читает заголовок элемента по смещению offset
+func ReadElementHeader(r io.ReadSeeker, offset int64) (Element, error) {
+	if _, err := r.Seek(offset, io.SeekStart); err != nil {
+		return Element{}, err
+	}
+
+	return readElementHeader(r, offset)
+}
+
+// readElementHeader читает заголовок элемента с текущей позиции r
+func readElementHeader(r io.Reader, offset int64) (Element, error) {
+	id, idLen, err := readVint(r, true)
+	if err != nil {
+		return Element{}, err
+	}
+	size, sizeLen, err := readVint(r, false)
+	if err != nil {
+		return Element{}, err
+	}
+
+	return Element{
+		Id:         uint32(id),
+		Offset:     offset,
+		Size:       size,
+		HeaderSize: int64(idLen + sizeLen),
+	}, nil
+}
+
+// ReadElement читает содержимое элемента известного размера
+func ReadElement(r io.ReadSeeker, e Element) ([]byte, error) {
+	if e.Size == UnknownSize {
+		return nil, fmt.Errorf("%w: %x has unknown size", ErrInvalidElement, e.Id)
+	}
+	// Размер задан в файле и не должен приводить к выделению произвольного объема памяти
+	if e.Size > maxElementSize {
+		return nil, fmt.Errorf("element %x is too large: %d bytes", e.Id, e.Size)
+	}
+
+	if _, err := r.Seek(e.DataOffset(), io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, e.Size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// readVint читает целое переменной длины. Для идентификаторов маркер длины
+// сохраняется, для размеров удаляется.
+func readVint(r io.Reader, keepMarker bool) (int64, int, error) {
+	var buf [8]byte
+	if _, err := io.ReadFull(r, buf[:1]); err != nil {
+		return 0, 0, err
+	}
+
+	length := vintLength(buf[0])
+	if length == 0 || (keepMarker && length > 4) {
+		return 0, 0, ErrInvalidElement
+	}
+	if _, err := io.ReadFull(r, buf[1:length]); err != nil {
+		return 0, 0, err
+	}
+
+	value, ok := decodeVint(buf[:length], keepMarker)
+	if !ok {
+		return UnknownSize, length, nil
+	}
+
+	return value, length, nil
+}
+
+func vintLength(first byte) int {
+	for i := 0; i < 8; i++ {
+		if first&(0x80>>i) != 0 {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// decodeVint декодирует vint. Возвращает false для размера из одних единиц.
+func decodeVint(b []byte, keepMarker bool) (int64, bool) {
+	value := int64(b[0])
+	if !keepMarker {
+		value &= int64(0xff >> len(b))
+	}
+	allOnes := value == int64(0xff>>len(b))
+
+	for _, c := range b[1:] {
+		value = value<<8 | int64(c)
+		allOnes = allOnes && c == 0xff
+	}
+
+	return value, keepMarker || !allOnes
+}
+
+// ParseElements разбирает элементы, уже прочитанные в память.
+// Смещения в результате отсчитываются от начала data.
+func ParseElements(data []byte) ([]Element, error) {
+	var elements []Element
+
+	for offset := 0; offset < len(data); {
+		idLen := vintLength(data[offset])
+		if idLen == 0 || idLen > 4 || offset+idLen >= len(data) {
+			return nil, ErrInvalidElement
+		}
+		id, _ := decodeVint(data[offset:offset+idLen], true)
+
+		sizeLen := vintLength(data[offset+idLen])
+		if sizeLen == 0 || offset+idLen+sizeLen > len(data) {
+			return nil, ErrInvalidElement
+		}
+		size, ok := decodeVint(data[offset+idLen:offset+idLen+sizeLen], false)
+
+		e := Element{
+			Id:         uint32(id),
+			Offset:     int64(offset),
+			Size:       size,
+			HeaderSize: int64(idLen + sizeLen),
+		}
+		if !ok {
+			e.Size = int64(len(data)) - e.DataOffset()
+		}
+		if e.End() > int64(len(data)) {
+			return nil, fmt.Errorf("%w: %x at %d", ErrInvalidElement, e.Id, offset)
+		}
+
+		elements = append(elements, e)
+		offset = int(e.End())
+	}
+
+	return elements, nil
+}
+
+// Children возвращает дочерние элементы e, содержимое которых лежит в data
+func Children(data []byte, e Element) ([]Element, []byte, error) {
+	content := data[e.DataOffset():e.End()]
+	children, err := ParseElements(content)
+	return children, content, err
+}
+
+// Uint декодирует беззнаковое целое EBML
+func Uint(data []byte) uint64 {
+	var value uint64
+	for _, c := range data {
+		value = value<<8 | uint64(c)
+	}
+	return value
+}
+
+// Float декодирует число с плавающей точкой EBML (4 или 8 байт)
+func Float(data []byte) float64 {
+	switch len(data) {
+	case 4:
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(data)))
+	case 8:
+		return math.Float64frombits(binary.BigEndian.Uint64(data))
+	}
+	return 0
+}
+
+// String декодирует строку EBML, отбрасывая завершающие нули
+func String(data []byte) string {
+	for len(data) > 0 && data[len(data)-1] == 0 {
+		data = data[:len(data)-1]
+	}
+	return string(data)
+}
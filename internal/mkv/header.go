@@ -0,0 +1,455 @@
+package mkv
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// Track описывает дорожку из элемента Tracks
+type Track struct {
+	Number          int
+	Type            int
+	CodecID         string
+	CodecPrivate    []byte
+	Language        string
+	Name            string
+	Default         bool
+	Forced          bool
+	DefaultDuration time.Duration
+
+	// Видео
+	Width  int
+	Height int
+
+	// Аудио
+	SampleRate       float64
+	OutputSampleRate float64
+	Channels         int
+}
+
+// Header содержит сведения из заголовков сегмента Matroska
+type Header struct {
+	DocType        string
+	Duration       time.Duration
+	TimestampScale int64 // Длительность единицы времени в наносекундах
+	Tracks         []*Track
+
+	SegmentStart int64 // Смещение содержимого сегмента, от которого отсчитывается SeekHead
+	SegmentEnd   int64
+	FirstCluster int64 // Смещение первого кластера или 0, если он не найден
+
+	seeks map[uint32]int64
+}
+
+// CuePoint описывает точку индекса для перемотки
+type CuePoint struct {
+	Time    time.Duration
+	Track   int
+	Cluster int64 // Смещение кластера от начала файла
+}
+
+// ReadHeader читает заголовок EBML, информацию о сегменте и дорожки.
+// Читаются только заголовки перед первым кластером и элементы, на которые
+// ссылается SeekHead.
+func ReadHeader(r io.ReadSeeker, size int64) (*Header, error) {
+	ebml, err := ReadElementHeader(r, 0)
+	if err != nil {
+		return nil, err
+	}
+	if ebml.Id != IdEBML {
+		return nil, fmt.Errorf("%w: ebml header not found", ErrInvalidElement)
+	}
+	data, err := ReadElement(r, ebml)
+	if err != nil {
+		return nil, err
+	}
+
+	h := &Header{
+		DocType:        "matroska",
+		TimestampScale: 1000000,
+		seeks:          make(map[uint32]int64),
+	}
+	if elements, err := ParseElements(data); err == nil {
+		for _, e := range elements {
+			if e.Id == IdDocType {
+				h.DocType = String(data[e.DataOffset():e.End()])
+			}
+		}
+	}
+
+	segment, err := ReadElementHeader(r, ebml.End())
+	if err != nil {
+		return nil, err
+	}
+	if segment.Id != IdSegment {
+		return nil, fmt.Errorf("%w: segment not found", ErrInvalidElement)
+	}
+
+	h.SegmentStart = segment.DataOffset()
+	h.SegmentEnd = segment.End()
+	if segment.Size == UnknownSize || h.SegmentEnd > size {
+		h.SegmentEnd = size
+	}
+
+	var infoData, tracksData []byte
+
+	// Заголовки обычно лежат перед первым кластером; если нет, их находит SeekHead
+	for offset := h.SegmentStart; offset < h.SegmentEnd; {
+		e, err := ReadElementHeader(r, offset)
+		if err != nil {
+			break
+		}
+		if e.Id == IdCluster {
+			h.FirstCluster = offset
+			break
+		}
+		if e.Size == UnknownSize {
+			break
+		}
+
+		switch e.Id {
+		case IdSeekHead, IdInfo, IdTracks:
+			content, err := ReadElement(r, e)
+			if err != nil {
+				return nil, err
+			}
+
+			switch e.Id {
+			case IdSeekHead:
+				h.parseSeekHead(content)
+			case IdInfo:
+				infoData = content
+			case IdTracks:
+				tracksData = content
+			}
+		}
+
+		offset = e.End()
+	}
+
+	if infoData == nil {
+		infoData, _ = h.readSeekTarget(r, IdInfo)
+	}
+	if tracksData == nil {
+		tracksData, _ = h.readSeekTarget(r, IdTracks)
+	}
+	if tracksData == nil {
+		return nil, fmt.Errorf("%w: tracks not found", ErrInvalidElement)
+	}
+
+	h.parseInfo(infoData)
+	if err := h.parseTracks(tracksData); err != nil {
+		return nil, err
+	}
+
+	return h, nil
+}
+
+// ReadCues читает индекс перемотки, на который ссылается SeekHead.
+// Точки возвращаются в порядке возрастания времени.
+func (h *Header) ReadCues(r io.ReadSeeker) ([]CuePoint, error) {
+	data, err := h.readSeekTarget(r, IdCues)
+	if err != nil {
+		return nil, err
+	}
+
+	points, err := ParseElements(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var cues []CuePoint
+	for _, p := range points {
+		if p.Id != IdCuePoint {
+			continue
+		}
+		children, content, err := Children(data, p)
+		if err != nil {
+			continue
+		}
+
+		var cueTime time.Duration
+		var positions []CuePoint
+		for _, c := range children {
+			value := content[c.DataOffset():c.End()]
+			switch c.Id {
+			case IdCueTime:
+				cueTime = h.toDuration(int64(Uint(value)))
+			case IdCuePositions:
+				if cue, ok := h.parseCuePosition(value); ok {
+					positions = append(positions, cue)
+				}
+			}
+		}
+
+		for _, cue := range positions {
+			cue.Time = cueTime
+			cues = append(cues, cue)
+		}
+	}
+
+	sort.SliceStable(cues, func(i, j int) bool {
+		return cues[i].Time < cues[j].Time
+	})
+
+	return cues, nil
+}
+
+// FindCue возвращает ближайшую точку индекса дорожки не позже t (track 0 - любой
+// дорожки) или nil, если такой точки нет
+func FindCue(cues []CuePoint, t time.Duration, track int) *CuePoint {
+	var target *CuePoint
+	for i := range cues {
+		cue := &cues[i]
+		if cue.Time > t {
+			break
+		}
+		if track == 0 || cue.Track == track {
+			target = cue
+		}
+	}
+	return target
+}
+
+// StreamFrom возвращает последовательный поток файла, в котором за заголовками
+// до первого кластера сразу следует кластер по смещению cluster. Программы, читающие
+// Matroska без перемотки, воспринимают его как файл, начинающийся с этого кластера.
+func (h *Header) StreamFrom(r io.ReadSeeker, cluster int64) (io.Reader, error) {
+	if h.FirstCluster == 0 || cluster < h.FirstCluster {
+		return nil, fmt.Errorf("%w: cluster %d is not after the headers", ErrInvalidElement, cluster)
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	return io.MultiReader(io.LimitReader(r, h.FirstCluster), &seekingReader{r: r, pos: cluster}), nil
+}
+
+// seekingReader переходит к смещению pos при первом чтении
+type seekingReader struct {
+	r      io.ReadSeeker
+	pos    int64
+	seeked bool
+}
+
+func (s *seekingReader) Read(p []byte) (int, error) {
+	if !s.seeked {
+		if _, err := s.r.Seek(s.pos, io.SeekStart); err != nil {
+			return 0, err
+		}
+		s.seeked = true
+	}
+	return s.r.Read(p)
+}
+
+func (h *Header) parseCuePosition(data []byte) (CuePoint, bool) {
+	elements, err := ParseElements(data)
+	if err != nil {
+		return CuePoint{}, false
+	}
+
+	cue := CuePoint{Cluster: -1}
+	for _, e := range elements {
+		value := data[e.DataOffset():e.End()]
+		switch e.Id {
+		case IdCueTrack:
+			cue.Track = int(Uint(value))
+		case IdCueCluster:
+			cue.Cluster = h.SegmentStart + int64(Uint(value))
+		}
+	}
+
+	return cue, cue.Cluster >= 0
+}
+
+// Track возвращает дорожку по номеру
+func (h *Header) Track(number int) (*Track, bool) {
+	for _, t := range h.Tracks {
+		if t.Number == number {
+			return t, true
+		}
+	}
+	return nil, false
+}
+
+// toDuration переводит время в единицах TimestampScale в time.Duration
+func (h *Header) toDuration(ts int64) time.Duration {
+	return time.Duration(ts * h.TimestampScale)
+}
+
+// parseSeekHead собирает смещения элементов относительно начала сегмента
+func (h *Header) parseSeekHead(data []byte) {
+	elements, err := ParseElements(data)
+	if err != nil {
+		return
+	}
+
+	for _, e := range elements {
+		if e.Id != IdSeek {
+			continue
+		}
+		children, content, err := Children(data, e)
+		if err != nil {
+			continue
+		}
+
+		var id uint32
+		var pos int64 = -1
+		for _, c := range children {
+			value := content[c.DataOffset():c.End()]
+			switch c.Id {
+			case IdSeekID:
+				id = uint32(Uint(value))
+			case IdSeekPos:
+				pos = int64(Uint(value))
+			}
+		}
+		if id != 0 && pos >= 0 {
+			// Используется первая ссылка: следующие обычно указывают на дубликаты
+			if _, ok := h.seeks[id]; !ok {
+				h.seeks[id] = pos
+			}
+		}
+	}
+}
+
+// readSeekTarget читает содержимое элемента по смещению из SeekHead
+func (h *Header) readSeekTarget(r io.ReadSeeker, id uint32) ([]byte, error) {
+	pos, ok := h.seeks[id]
+	if !ok {
+		return nil, fmt.Errorf("element %x is not indexed", id)
+	}
+
+	e, err := ReadElementHeader(r, h.SegmentStart+pos)
+	if err != nil {
+		return nil, err
+	}
+	if e.Id != id || e.Size == UnknownSize {
+		return nil, fmt.Errorf("%w: %x expected at %d", ErrInvalidElement, id, e.Offset)
+	}
+
+	return ReadElement(r, e)
+}
+
+// parseInfo извлекает масштаб времени и длительность из элемента Info
+func (h *Header) parseInfo(data []byte) {
+	elements, err := ParseElements(data)
+	if err != nil {
+		return
+	}
+
+	var duration float64
+	for _, e := range elements {
+		value := data[e.DataOffset():e.End()]
+		switch e.Id {
+		case IdTimestampScale:
+			if scale := int64(Uint(value)); scale > 0 {
+				h.TimestampScale = scale
+			}
+		case IdDuration:
+			duration = Float(value)
+		}
+	}
+
+	h.Duration = time.Duration(duration * float64(h.TimestampScale))
+}
+
+// parseTracks разбирает элементы TrackEntry
+func (h *Header) parseTracks(data []byte) error {
+	entries, err := ParseElements(data)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if entry.Id != IdTrackEntry {
+			continue
+		}
+		children, content, err := Children(data, entry)
+		if err != nil {
+			continue
+		}
+
+		// Язык по умолчанию в Matroska английский
+		track := &Track{Default: true, Language: "eng"}
+		var languageBCP47 string
+
+		for _, c := range children {
+			value := content[c.DataOffset():c.End()]
+			switch c.Id {
+			case IdTrackNumber:
+				track.Number = int(Uint(value))
+			case IdTrackType:
+				track.Type = int(Uint(value))
+			case IdCodecID:
+				track.CodecID = String(value)
+			case IdCodecPrivate:
+				track.CodecPrivate = value
+			case IdDefaultDur:
+				track.DefaultDuration = time.Duration(Uint(value))
+			case IdLanguage:
+				track.Language = String(value)
+			case IdLanguageBCP47:
+				languageBCP47 = String(value)
+			case IdName:
+				track.Name = String(value)
+			case IdFlagDefault:
+				track.Default = Uint(value) != 0
+			case IdFlagForced:
+				track.Forced = Uint(value) != 0
+			case IdVideo:
+				track.parseVideo(value)
+			case IdAudio:
+				track.parseAudio(value)
+			}
+		}
+
+		if languageBCP47 != "" {
+			track.Language = languageBCP47
+		}
+
+		h.Tracks = append(h.Tracks, track)
+	}
+
+	return nil
+}
+
+func (t *Track) parseVideo(data []byte) {
+	elements, err := ParseElements(data)
+	if err != nil {
+		return
+	}
+
+	for _, e := range elements {
+		value := data[e.DataOffset():e.End()]
+		switch e.Id {
+		case IdPixelWidth:
+			t.Width = int(Uint(value))
+		case IdPixelHeight:
+			t.Height = int(Uint(value))
+		}
+	}
+}
+
+func (t *Track) parseAudio(data []byte) {
+	elements, err := ParseElements(data)
+	if err != nil {
+		return
+	}
+
+	t.SampleRate = 8000
+	t.Channels = 1
+	for _, e := range elements {
+		value := data[e.DataOffset():e.End()]
+		switch e.Id {
+		case IdSampleRate:
+			t.SampleRate = Float(value)
+		case IdOutputRate:
+			t.OutputSampleRate = Float(value)
+		case IdChannels:
+			t.Channels = int(Uint(value))
+		}
+	}
+}
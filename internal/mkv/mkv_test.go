@@ -0,0 +1,223 @@
+package mkv
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// element собирает элемент EBML с размером в восьмибайтовом vint
+func element(id uint32, children ...[]byte) []byte {
+	var buf bytes.Buffer
+	idBytes := binary.BigEndian.AppendUint32(nil, id)
+	for len(idBytes) > 1 && idBytes[0] == 0 {
+		idBytes = idBytes[1:]
+	}
+	buf.Write(idBytes)
+
+	size := 0
+	for _, c := range children {
+		size += len(c)
+	}
+	buf.Write(binary.BigEndian.AppendUint64(nil, uint64(size)|1<<56))
+
+	for _, c := range children {
+		buf.Write(c)
+	}
+	return buf.Bytes()
+}
+
+func uintElement(id uint32, v uint64) []byte {
+	return element(id, binary.BigEndian.AppendUint64(nil, v))
+}
+
+func floatElement(id uint32, v float64) []byte {
+	return element(id, binary.BigEndian.AppendUint64(nil, math.Float64bits(v)))
+}
+
+func stringElement(id uint32, s string) []byte {
+	return element(id, []byte(s))
+}
+
+// testCluster собирает кластер с одним ключевым кадром дорожки 1
+func testCluster(timestamp uint64, payload string) []byte {
+	block := append([]byte{0x81, 0, 0, 0x80}, payload...)
+	return element(IdCluster, uintElement(IdTimestamp, timestamp), element(IdSimpleBlock, block))
+}
+
+// testFile собирает Matroska с дорожкой H.264, кластерами на 0, 5 и 10 секундах
+// и индексом Cues после кластеров
+func testFile() []byte {
+	clusters := [][]byte{testCluster(0, "first"), testCluster(5000, "second"), testCluster(10000, "third")}
+
+	seekHead := func(cuesPos uint64) []byte {
+		return element(IdSeekHead, element(IdSeek,
+			element(IdSeekID, binary.BigEndian.AppendUint32(nil, IdCues)),
+			uintElement(IdSeekPos, cuesPos),
+		))
+	}
+	info := element(IdInfo, uintElement(IdTimestampScale, 1000000), floatElement(IdDuration, 15000))
+	tracks := element(IdTracks, element(IdTrackEntry,
+		uintElement(IdTrackNumber, 1),
+		uintElement(IdTrackType, TrackVideo),
+		stringElement(IdCodecID, "V_MPEG4/ISO/AVC"),
+		element(IdVideo, uintElement(IdPixelWidth, 1920), uintElement(IdPixelHeight, 1080)),
+	))
+
+	headers := len(seekHead(0)) + len(info) + len(tracks)
+	var cuePoints [][]byte
+	pos := headers
+	for i, c := range clusters {
+		cuePoints = append(cuePoints, element(IdCuePoint,
+			uintElement(IdCueTime, uint64(i*5000)),
+			element(IdCuePositions, uintElement(IdCueTrack, 1), uintElement(IdCueCluster, uint64(pos))),
+		))
+		pos += len(c)
+	}
+
+	content := [][]byte{seekHead(uint64(pos)), info, tracks}
+	content = append(content, clusters...)
+	content = append(content, element(IdCues, cuePoints...))
+
+	return append(element(IdEBML, stringElement(IdDocType, "matroska")), element(IdSegment, content...)...)
+}
+
+func TestFindCue(t *testing.T) {
+	cues := []CuePoint{
+		{Time: 0, Track: 1, Cluster: 100},
+		{Time: 5 * time.Second, Track: 2, Cluster: 200},
+		{Time: 5 * time.Second, Track: 1, Cluster: 300},
+		{Time: 10 * time.Second, Track: 1, Cluster: 400},
+	}
+
+	tests := []struct {
+		name  string
+		cues  []CuePoint
+		t     time.Duration
+		track int
+		want  int64 // Смещение кластера, -1 - точка не найдена
+	}{
+		{"start", cues, 0, 0, 100},
+		{"between points", cues, 7 * time.Second, 0, 300},
+		{"track filter", cues, 7 * time.Second, 2, 200},
+		{"after last", cues, time.Hour, 1, 400},
+		{"unknown track", cues, time.Hour, 3, -1},
+		{"no cues", nil, time.Second, 0, -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cue := FindCue(tt.cues, tt.t, tt.track)
+			got := int64(-1)
+			if cue != nil {
+				got = cue.Cluster
+			}
+			if got != tt.want {
+				t.Errorf("FindCue() cluster = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStreamFrom(t *testing.T) {
+	data := testFile()
+	r := bytes.NewReader(data)
+
+	header, err := ReadHeader(r, int64(len(data)))
+	if err != nil {
+		t.Fatalf("ReadHeader() error = %v", err)
+	}
+	cues, err := header.ReadCues(r)
+	if err != nil {
+		t.Fatalf("ReadCues() error = %v", err)
+	}
+
+	cue := FindCue(cues, 7*time.Second, 0)
+	if cue == nil || cue.Time != 5*time.Second {
+		t.Fatalf("FindCue() = %+v, want the point at 5s", cue)
+	}
+
+	stream, err := header.StreamFrom(r, cue.Cluster)
+	if err != nil {
+		t.Fatalf("StreamFrom() error = %v", err)
+	}
+	rebased, err := io.ReadAll(stream)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := append(data[:header.FirstCluster:header.FirstCluster], data[cue.Cluster:]...)
+	if !bytes.Equal(rebased, want) {
+		t.Fatal("stream is not the headers followed by the cue cluster")
+	}
+
+	// Поток читается как файл, первый кадр которого лежит в найденном кластере
+	d, err := NewDemuxer(bytes.NewReader(rebased), int64(len(rebased)))
+	if err != nil {
+		t.Fatalf("NewDemuxer() error = %v", err)
+	}
+	frame, err := d.ReadFrame()
+	if err != nil {
+		t.Fatalf("ReadFrame() error = %v", err)
+	}
+	if frame.Time != 5*time.Second || string(frame.Data) != "second" {
+		t.Errorf("first frame = %s %q, want 5s %q", frame.Time, frame.Data, "second")
+	}
+
+	if _, err := header.StreamFrom(r, header.FirstCluster-1); err == nil {
+		t.Error("StreamFrom() accepted a cluster inside the headers")
+	}
+}
+
+func TestLacing(t *testing.T) {
+	// Первый размер EBML-лейсинга близок к 2^56, остальные равны ему: сумма переполняет int
+	overflow := append([]byte{254, 0x01, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xfe}, bytes.Repeat([]byte{0xbf}, 253)...)
+	overflow = append(overflow, "payload"...)
+
+	tests := []struct {
+		name  string
+		kind  byte
+		data  []byte
+		sizes []int // nil - ошибка разбора
+	}{
+		{"no lacing", 0, []byte("frame"), []int{5}},
+		{"xiph", 1, []byte("\x02\x02\x03aabbbc"), []int{2, 3, 1}},
+		{"fixed", 2, []byte("\x02aabbcc"), []int{2, 2, 2}},
+		{"ebml", 3, []byte("\x02\x82\xc0aabbbc"), []int{2, 3, 1}},
+		{"xiph beyond data", 1, []byte("\x01\x09abc"), nil},
+		{"fixed uneven", 2, []byte("\x01abc"), nil},
+		{"ebml negative size", 3, []byte("\x02\x82\x80aabbbc"), nil},
+		{"ebml size overflow", 3, overflow, nil},
+		{"empty", 1, nil, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sizes, payload, err := lacing(tt.kind, tt.data)
+			if tt.sizes == nil {
+				if err == nil {
+					t.Errorf("lacing() = %v, want error", sizes)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("lacing() error = %v", err)
+			}
+			if !reflect.DeepEqual(sizes, tt.sizes) {
+				t.Errorf("lacing() sizes = %v, want %v", sizes, tt.sizes)
+			}
+
+			total := 0
+			for _, size := range sizes {
+				total += size
+			}
+			if total != len(payload) {
+				t.Errorf("sizes cover %d bytes, payload has %d", total, len(payload))
+			}
+		})
+	}
+}
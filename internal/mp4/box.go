@@ -0,0 +1,185 @@
+package mp4
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Box описывает заголовок атома (box) MP4
+type Box struct {
+	Type       string
+	Offset     int64 // Смещение начала атома, включая заголовок
+	Size       int64 // Полный размер атома, включая заголовок
+	HeaderSize int64
+}
+
+// DataOffset возвращает смещение содержимого атома
+func (b Box) DataOffset() int64 {
+	return b.Offset + b.HeaderSize
+}
+
+// DataSize возвращает размер содержимого атома
+func (b Box) DataSize() int64 {
+	return b.Size - b.HeaderSize
+}
+
+// End возвращает смещение конца атома
+func (b Box) End() int64 {
+	return b.Offset + b.Size
+}
+
+// maxBoxSize ограничивает размер атомов, читаемых в память целиком
+const maxBoxSize = 64 << 20
+
+var ErrInvalidBox = errors.New("invalid mp4 box")
+
+// ReadBoxes читает заголовки атомов в диапазоне [start, end) без чтения содержимого
+func ReadBoxes(r io.ReadSeeker, start, end int64) ([]Box, error) {
+	var boxes []Box
+
+	for offset := start; offset+8 <= end; {
+		box, err := readBoxHeader(r, offset, end)
+		if err != nil {
+			return nil, err
+		}
+
+		boxes = append(boxes, box)
+		offset = box.End()
+	}
+
+	return boxes, nil
+}
+
+func readBoxHeader(r io.ReadSeeker, offset, end int64) (Box, error) {
+	if _, err := r.Seek(offset, io.SeekStart); err != nil {
+		return Box{}, err
+	}
+
+	var header [16]byte
+	if _, err := io.ReadFull(r, header[:8]); err != nil {
+		return Box{}, err
+	}
+
+	box := Box{
+		Type:       string(header[4:8]),
+		Offset:     offset,
+		Size:       int64(binary.BigEndian.Uint32(header[:4])),
+		HeaderSize: 8,
+	}
+
+	switch box.Size {
+	case 0:
+		// Атом продолжается до конца файла
+		box.Size = end - offset
+	case 1:
+		if _, err := io.ReadFull(r, header[8:16]); err != nil {
+			return Box{}, err
+		}
+		box.Size = int64(binary.BigEndian.Uint64(header[8:16]))
+		box.HeaderSize = 16
+	}
+
+	// Размер сравнивается с остатком диапазона, чтобы сумма со смещением не переполнилась
+	if box.Size < box.HeaderSize || box.Size > end-offset {
+		return Box{}, fmt.Errorf("%w: %q at %d", ErrInvalidBox, box.Type, offset)
+	}
+
+	return box, nil
+}
+
+// ParseBoxes разбирает заголовки атомов, уже прочитанных в память.
+// Смещения в результате отсчитываются от начала data.
+func ParseBoxes(data []byte) ([]Box, error) {
+	var boxes []Box
+
+	for offset := int64(0); offset+8 <= int64(len(data)); {
+		box := Box{
+			Type:       string(data[offset+4 : offset+8]),
+			Offset:     offset,
+			Size:       int64(binary.BigEndian.Uint32(data[offset:])),
+			HeaderSize: 8,
+		}
+
+		switch box.Size {
+		case 0:
+			box.Size = int64(len(data)) - offset
+		case 1:
+			if offset+16 > int64(len(data)) {
+				return nil, fmt.Errorf("%w: %q at %d", ErrInvalidBox, box.Type, offset)
+			}
+			box.Size = int64(binary.BigEndian.Uint64(data[offset+8:]))
+			box.HeaderSize = 16
+		}
+
+		if box.Size < box.HeaderSize || box.Size > int64(len(data))-offset {
+			return nil, fmt.Errorf("%w: %q at %d", ErrInvalidBox, box.Type, offset)
+		}
+
+		boxes = append(boxes, box)
+		offset = box.End()
+	}
+
+	return boxes, nil
+}
+
+// FindBox ищет атом по пути типов внутри данных, например "trak", "mdia", "mdhd".
+// Возвращает содержимое найденного атома.
+func FindBox(data []byte, path ...string) ([]byte, bool) {
+	if len(path) == 0 {
+		return data, true
+	}
+
+	boxes, err := ParseBoxes(data)
+	if err != nil {
+		return nil, false
+	}
+
+	for _, b := range boxes {
+		if b.Type != path[0] {
+			continue
+		}
+		if found, ok := FindBox(data[b.DataOffset():b.End()], path[1:]...); ok {
+			return found, true
+		}
+	}
+
+	return nil, false
+}
+
+// FindBoxes возвращает содержимое всех атомов данного типа на верхнем уровне data
+func FindBoxes(data []byte, boxType string) [][]byte {
+	boxes, err := ParseBoxes(data)
+	if err != nil {
+		return nil
+	}
+
+	var result [][]byte
+	for _, b := range boxes {
+		if b.Type == boxType {
+			result = append(result, data[b.DataOffset():b.End()])
+		}
+	}
+
+	return result
+}
+
+// ReadBox читает атом целиком, включая заголовок
+func ReadBox(r io.ReadSeeker, box Box) ([]byte, error) {
+	// Размер задан в файле и не должен приводить к выделению произвольного объема памяти
+	if box.Size > maxBoxSize {
+		return nil, fmt.Errorf("%q is too large: %d bytes", box.Type, box.Size)
+	}
+
+	if _, err := r.Seek(box.Offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, box.Size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
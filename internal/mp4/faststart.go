@@ -0,0 +1,143 @@
+package mp4
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+
+	"retreat-backend/internal/reader"
+)
+
+var ErrOffsetOverflow = errors.New("chunk offset does not fit into stco")
+
+// Faststart строит сегменты "виртуального" файла, в котором атом moov перенесен
+// перед первым атомом mdat, а смещения чанков в stco/co64 исправлены.
+// Возвращает false, если moov уже находится перед данными.
+func Faststart(r io.ReadSeeker, size int64) ([]reader.Segment, bool, error) {
+	boxes, err := ReadBoxes(r, 0, size)
+	if err != nil {
+		return nil, false, err
+	}
+
+	moovIdx, mdatIdx := -1, -1
+	for i, b := range boxes {
+		switch {
+		case b.Type == "moov" && moovIdx < 0:
+			moovIdx = i
+		case b.Type == "mdat" && mdatIdx < 0:
+			mdatIdx = i
+		}
+	}
+
+	if moovIdx < 0 || mdatIdx < 0 || moovIdx < mdatIdx {
+		return nil, false, nil
+	}
+
+	moov := boxes[moovIdx]
+	moovData, err := ReadBox(r, moov)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// Все, что лежит между новым и старым положением moov, сдвигается на его размер
+	insertAt := boxes[mdatIdx].Offset
+	shift := func(offset uint64) uint64 {
+		if offset >= uint64(insertAt) && offset < uint64(moov.Offset) {
+			return offset + uint64(moov.Size)
+		}
+		return offset
+	}
+
+	if err := patchChunkOffsets(moovData[moov.HeaderSize:], shift); err != nil {
+		return nil, false, err
+	}
+
+	segments := make([]reader.Segment, 0, len(boxes))
+	for i, b := range boxes {
+		if i == moovIdx {
+			continue
+		}
+		if i == mdatIdx {
+			segments = append(segments, reader.Segment{Data: moovData})
+		}
+
+		// Соседние диапазоны оригинала объединяются в один сегмент
+		if n := len(segments); n > 0 && segments[n-1].Data == nil &&
+			segments[n-1].Offset+segments[n-1].Length == b.Offset {
+			segments[n-1].Length += b.Size
+			continue
+		}
+
+		segments = append(segments, reader.Segment{Offset: b.Offset, Length: b.Size})
+	}
+
+	return segments, true, nil
+}
+
+// chunkOffsetPath содержит контейнеры на пути к таблицам смещений чанков
+var chunkOffsetPath = map[string]bool{
+	"moov": true,
+	"trak": true,
+	"mdia": true,
+	"minf": true,
+	"stbl": true,
+}
+
+// patchChunkOffsets исправляет смещения в атомах stco и co64 внутри контейнера
+func patchChunkOffsets(data []byte, shift func(uint64) uint64) error {
+	boxes, err := ParseBoxes(data)
+	if err != nil {
+		return err
+	}
+
+	for _, b := range boxes {
+		content := data[b.DataOffset():b.End()]
+
+		switch {
+		case chunkOffsetPath[b.Type]:
+			if err := patchChunkOffsets(content, shift); err != nil {
+				return err
+			}
+		case b.Type == "stco":
+			count, err := tableEntries(content, 4)
+			if err != nil {
+				return err
+			}
+			for i := 0; i < count; i++ {
+				pos := 8 + i*4
+				offset := shift(uint64(binary.BigEndian.Uint32(content[pos:])))
+				if offset > math.MaxUint32 {
+					return ErrOffsetOverflow
+				}
+				binary.BigEndian.PutUint32(content[pos:], uint32(offset))
+			}
+		case b.Type == "co64":
+			count, err := tableEntries(content, 8)
+			if err != nil {
+				return err
+			}
+			for i := 0; i < count; i++ {
+				pos := 8 + i*8
+				binary.BigEndian.PutUint64(content[pos:], shift(binary.BigEndian.Uint64(content[pos:])))
+			}
+		}
+	}
+
+	return nil
+}
+
+// tableEntries проверяет размер таблицы полного атома (версия, флаги, число записей)
+// и возвращает число записей
+func tableEntries(content []byte, entrySize int) (int, error) {
+	if len(content) < 8 {
+		return 0, ErrInvalidBox
+	}
+
+	count := int(binary.BigEndian.Uint32(content[4:8]))
+	if 8+count*entrySize > len(content) {
+		return 0, ErrInvalidBox
+	}
+
+	return count, nil
+}
@@ -0,0 +1,143 @@
+package mp4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"testing"
+
+	"retreat-backend/internal/reader"
+)
+
+// testMovie собирает файл ftyp + mdat + moov, в котором таблицы stco и co64
+// указывают на кадры внутри mdat
+func testMovie(payload []byte, stco []uint32, co64 []uint64) []byte {
+	stcoData := u32(uint32(len(stco)))
+	for _, offset := range stco {
+		stcoData = append(stcoData, u32(offset)...)
+	}
+	co64Data := u32(uint32(len(co64)))
+	for _, offset := range co64 {
+		co64Data = append(co64Data, u64(offset)...)
+	}
+
+	trak := func(table []byte) []byte {
+		return makeBox("trak", makeBox("mdia", makeBox("minf", makeBox("stbl", table))))
+	}
+
+	return concat(
+		makeBox("ftyp", []byte("isom"), u32(0)),
+		makeBox("mdat", payload),
+		makeBox("moov",
+			trak(makeFullBox("stco", 0, 0, stcoData)),
+			trak(makeFullBox("co64", 0, 0, co64Data)),
+		),
+	)
+}
+
+func TestFaststart(t *testing.T) {
+	payload := []byte("frame-one|frame-two|frame-three")
+	// mdat начинается после ftyp (16 байт), данные - после его заголовка
+	const dataStart = 16 + 8
+	file := testMovie(payload, []uint32{dataStart, dataStart + 10}, []uint64{dataStart + 20})
+
+	segments, moved, err := Faststart(bytes.NewReader(file), int64(len(file)))
+	if err != nil {
+		t.Fatalf("Faststart() error = %v", err)
+	}
+	if !moved {
+		t.Fatal("Faststart() did not move moov")
+	}
+
+	out, err := io.ReadAll(reader.NewSegmentReader(bytes.NewReader(file), segments))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != len(file) {
+		t.Fatalf("virtual file has %d bytes, want %d", len(out), len(file))
+	}
+
+	boxes, err := ParseBoxes(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var types []string
+	for _, b := range boxes {
+		types = append(types, b.Type)
+	}
+	if len(types) != 3 || types[0] != "ftyp" || types[1] != "moov" || types[2] != "mdat" {
+		t.Fatalf("boxes = %v, want [ftyp moov mdat]", types)
+	}
+
+	// Исправленные смещения указывают на те же кадры в новом положении mdat
+	want := []string{"frame-one", "frame-two", "frame-three"}
+	var offsets []uint64
+	moov := out[boxes[1].DataOffset():boxes[1].End()]
+	for _, trak := range FindBoxes(moov, "trak") {
+		if stco, ok := FindBox(trak, "mdia", "minf", "stbl", "stco"); ok {
+			for i := 0; i < int(binary.BigEndian.Uint32(stco[4:])); i++ {
+				offsets = append(offsets, uint64(binary.BigEndian.Uint32(stco[8+i*4:])))
+			}
+		}
+		if co64, ok := FindBox(trak, "mdia", "minf", "stbl", "co64"); ok {
+			for i := 0; i < int(binary.BigEndian.Uint32(co64[4:])); i++ {
+				offsets = append(offsets, binary.BigEndian.Uint64(co64[8+i*8:]))
+			}
+		}
+	}
+	if len(offsets) != len(want) {
+		t.Fatalf("offsets = %v", offsets)
+	}
+	for i, offset := range offsets {
+		if got := string(out[offset : offset+uint64(len(want[i]))]); got != want[i] {
+			t.Errorf("chunk %d at %d = %q, want %q", i, offset, got, want[i])
+		}
+	}
+}
+
+func TestFaststartNotNeeded(t *testing.T) {
+	file := concat(
+		makeBox("ftyp", []byte("isom"), u32(0)),
+		makeBox("moov", makeBox("mvhd")),
+		makeBox("mdat", []byte("data")),
+	)
+
+	segments, moved, err := Faststart(bytes.NewReader(file), int64(len(file)))
+	if err != nil || moved || segments != nil {
+		t.Errorf("Faststart() = %v, %v, %v; want nothing to move", segments, moved, err)
+	}
+}
+
+func TestFaststartInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		file []byte
+	}{
+		{"truncated box", makeBox("ftyp", []byte("isom"), u32(0))[:12]},
+		{"box larger than file", concat(u32(1000), []byte("mdat"), []byte("data"))},
+		// Смещение следующего атома переполняет int64
+		{"box size overflow", concat(
+			makeBox("ftyp", []byte("isom"), u32(0)),
+			u32(1), []byte("free"), u64(math.MaxInt64),
+		)},
+		{"nested box size overflow", concat(
+			makeBox("mdat", []byte("data")),
+			makeBox("moov", makeBox("free"), u32(1), []byte("trak"), u64(math.MaxInt64)),
+		)},
+		{"truncated stco", concat(
+			makeBox("mdat", []byte("data")),
+			makeBox("moov", makeBox("trak", makeBox("mdia", makeBox("minf", makeBox("stbl", makeFullBox("stco", 0, 0, u32(5))))))),
+		)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := Faststart(bytes.NewReader(tt.file), int64(len(tt.file)))
+			if !errors.Is(err, ErrInvalidBox) && !errors.Is(err, io.ErrUnexpectedEOF) {
+				t.Errorf("Faststart() error = %v, want invalid box", err)
+			}
+		})
+	}
+}
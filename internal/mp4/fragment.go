@@ -0,0 +1,302 @@
+package mp4
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// TrackConfig описывает дорожку фрагментированного MP4
+type TrackConfig struct {
+	Id          uint32
+	Handler     string // "vide" или "soun"
+	Timescale   uint32
+	Language    string // Код ISO 639-2
+	Width       int
+	Height      int
+	SampleEntry []byte // Атом описания сэмплов (avc1, mp4a, ...)
+}
+
+// Sample описывает сэмпл фрагмента
+type Sample struct {
+	Duration          uint32
+	CompositionOffset int32 // Разница между временем отображения и декодирования
+	Keyframe          bool
+	Data              []byte
+}
+
+// TrackFragment содержит сэмплы одной дорожки во фрагменте
+type TrackFragment struct {
+	TrackId  uint32
+	BaseTime uint64 // Время декодирования первого сэмпла
+	Samples  []Sample
+}
+
+const (
+	sampleFlagsSync    = 0x02000000
+	sampleFlagsNonSync = 0x01010000
+)
+
+// WriteInit записывает сегмент инициализации: ftyp и moov без сэмплов, с mvex.
+// duration задается в единицах movieTimescale и может быть 0, если неизвестна.
+func WriteInit(w io.Writer, tracks []TrackConfig, duration uint64, movieTimescale uint32) error {
+	ftyp := makeBox("ftyp", []byte("isom"), u32(0x200), []byte("isom"), []byte("iso6"), []byte("mp41"))
+
+	var nextId uint32
+	traks := make([][]byte, 0, len(tracks))
+	trexs := make([][]byte, 0, len(tracks))
+	for _, t := range tracks {
+		traks = append(traks, makeTrak(t))
+		trexs = append(trexs, makeFullBox("trex", 0, 0, u32(t.Id), u32(1), u32(0), u32(0), u32(0)))
+		nextId = max(nextId, t.Id+1)
+	}
+
+	mvhd := makeFullBox("mvhd", 0, 0,
+		u32(0), u32(0), u32(movieTimescale), u32(uint32(duration)),
+		u32(0x00010000), u16(0x0100), make([]byte, 10),
+		matrix(), make([]byte, 24), u32(nextId),
+	)
+	mvex := makeBox("mvex", append([][]byte{makeFullBox("mehd", 0, 0, u32(uint32(duration)))}, trexs...)...)
+	moov := makeBox("moov", append(append([][]byte{mvhd}, traks...), mvex)...)
+
+	_, err := w.Write(append(ftyp, moov...))
+	return err
+}
+
+func makeTrak(t TrackConfig) []byte {
+	volume := uint16(0)
+	var header []byte
+	handlerName := "VideoHandler"
+	if t.Handler == "soun" {
+		volume = 0x0100
+		header = makeFullBox("smhd", 0, 0, u16(0), u16(0))
+		handlerName = "SoundHandler"
+	} else {
+		header = makeFullBox("vmhd", 0, 1, make([]byte, 8))
+	}
+
+	tkhd := makeFullBox("tkhd", 0, 3,
+		u32(0), u32(0), u32(t.Id), u32(0), u32(0),
+		make([]byte, 8), u16(0), u16(0), u16(volume), u16(0),
+		matrix(), u32(uint32(t.Width)<<16), u32(uint32(t.Height)<<16),
+	)
+
+	mdhd := makeFullBox("mdhd", 0, 0, u32(0), u32(0), u32(t.Timescale), u32(0), u16(packLanguage(t.Language)), u16(0))
+	hdlr := makeFullBox("hdlr", 0, 0, u32(0), []byte(t.Handler), make([]byte, 12), []byte(handlerName+"\x00"))
+
+	dinf := makeBox("dinf", makeFullBox("dref", 0, 0, u32(1), makeFullBox("url ", 0, 1)))
+	stbl := makeBox("stbl",
+		makeFullBox("stsd", 0, 0, u32(1), t.SampleEntry),
+		makeFullBox("stts", 0, 0, u32(0)),
+		makeFullBox("stsc", 0, 0, u32(0)),
+		makeFullBox("stsz", 0, 0, u32(0), u32(0)),
+		makeFullBox("stco", 0, 0, u32(0)),
+	)
+
+	return makeBox("trak", tkhd, makeBox("mdia", mdhd, hdlr, makeBox("minf", header, dinf, stbl)))
+}
+
+// WriteFragment записывает фрагмент: moof с описанием сэмплов и mdat с их данными
+func WriteFragment(w io.Writer, sequence uint32, fragments []TrackFragment) error {
+	// Смещения данных зависят от размера moof, который не зависит от самих смещений
+	moof := makeMoof(sequence, fragments, 0)
+	moof = makeMoof(sequence, fragments, len(moof)+8)
+
+	var size int
+	for _, f := range fragments {
+		for _, s := range f.Samples {
+			size += len(s.Data)
+		}
+	}
+
+	if _, err := w.Write(append(moof, u32(uint32(size+8))...)); err != nil {
+		return err
+	}
+	if _, err := w.Write([]byte("mdat")); err != nil {
+		return err
+	}
+	for _, f := range fragments {
+		for _, s := range f.Samples {
+			if _, err := w.Write(s.Data); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func makeMoof(sequence uint32, fragments []TrackFragment, dataOffset int) []byte {
+	trafs := [][]byte{makeFullBox("mfhd", 0, 0, u32(sequence))}
+
+	for _, f := range fragments {
+		// default-base-is-moof: смещения отсчитываются от начала moof
+		tfhd := makeFullBox("tfhd", 0, 0x020000, u32(f.TrackId))
+		tfdt := makeFullBox("tfdt", 1, 0, u64(f.BaseTime))
+
+		// Данные дорожки начинаются в mdat после данных предыдущих дорожек
+		offset := dataOffset
+
+		entries := make([]byte, 0, len(f.Samples)*16)
+		for _, s := range f.Samples {
+			flags := uint32(sampleFlagsNonSync)
+			if s.Keyframe {
+				flags = sampleFlagsSync
+			}
+			entries = append(entries, u32(s.Duration)...)
+			entries = append(entries, u32(uint32(len(s.Data)))...)
+			entries = append(entries, u32(flags)...)
+			entries = append(entries, u32(uint32(s.CompositionOffset))...)
+			dataOffset += len(s.Data)
+		}
+
+		trun := makeFullBox("trun", 1, 0x000001|0x000100|0x000200|0x000400|0x000800,
+			u32(uint32(len(f.Samples))), u32(uint32(offset)), entries)
+
+		trafs = append(trafs, makeBox("traf", tfhd, tfdt, trun))
+	}
+
+	return makeBox("moof", trafs...)
+}
+
+// AVCSampleEntry создает описание видеосэмплов H.264 (avc1/avcC) или HEVC (hvc1/hvcC)
+// из записи конфигурации декодера
+func AVCSampleEntry(format string, configType string, config []byte, width, height int) []byte {
+	return makeBox(format,
+		make([]byte, 6), u16(1),
+		u16(0), u16(0), make([]byte, 12),
+		u16(uint16(width)), u16(uint16(height)),
+		u32(0x00480000), u32(0x00480000), u32(0), u16(1),
+		make([]byte, 32), u16(0x0018), u16(0xffff),
+		makeBox(configType, config),
+	)
+}
+
+// Типы объектов MPEG-4 для esds
+const (
+	ObjectTypeAAC = 0x40
+	ObjectTypeMP3 = 0x6B
+)
+
+// AudioSampleEntry создает описание аудиосэмплов mp4a с дескриптором esds
+func AudioSampleEntry(objectType byte, config []byte, channels, sampleRate int) []byte {
+	decoderConfig := [][]byte{{objectType, 0x15}, make([]byte, 3), u32(0), u32(0)}
+	if len(config) > 0 {
+		decoderConfig = append(decoderConfig, descriptor(5, config))
+	}
+
+	esds := makeFullBox("esds", 0, 0, descriptor(3,
+		u16(0), []byte{0},
+		descriptor(4, decoderConfig...),
+		descriptor(6, []byte{2}),
+	))
+
+	return makeBox("mp4a", audioEntryFields(channels, sampleRate), esds)
+}
+
+var ErrInvalidOpusHead = errors.New("invalid OpusHead")
+
+// OpusSampleEntry создает описание аудиосэмплов Opus из заголовка OpusHead
+func OpusSampleEntry(head []byte) ([]byte, error) {
+	if len(head) < 19 || string(head[:8]) != "OpusHead" {
+		return nil, ErrInvalidOpusHead
+	}
+
+	channels := head[9]
+	family := head[18]
+
+	// dOps хранит те же поля, что и OpusHead, но в big-endian
+	dops := []byte{0, channels}
+	dops = append(dops, u16(binary.LittleEndian.Uint16(head[10:]))...)
+	dops = append(dops, u32(binary.LittleEndian.Uint32(head[12:]))...)
+	dops = append(dops, u16(binary.LittleEndian.Uint16(head[16:]))...)
+	dops = append(dops, family)
+	if family != 0 {
+		if len(head) < 21+int(channels) {
+			return nil, ErrInvalidOpusHead
+		}
+		dops = append(dops, head[19:21+int(channels)]...)
+	}
+
+	return makeBox("Opus", audioEntryFields(int(channels), 48000), makeBox("dOps", dops)), nil
+}
+
+func audioEntryFields(channels, sampleRate int) []byte {
+	// Частота хранится в формате 16.16 и не помещается в него выше 65535 Гц
+	rate := uint32(sampleRate) << 16
+	if sampleRate > 0xffff {
+		rate = 0
+	}
+
+	return concat(
+		make([]byte, 6), u16(1),
+		make([]byte, 8),
+		u16(uint16(channels)), u16(16), u16(0), u16(0),
+		u32(rate),
+	)
+}
+
+// descriptor создает дескриптор MPEG-4 с размером в четырехбайтовой форме
+func descriptor(tag byte, parts ...[]byte) []byte {
+	data := concat(parts...)
+	n := len(data)
+	header := []byte{tag, byte(n>>21&0x7f | 0x80), byte(n>>14&0x7f | 0x80), byte(n>>7&0x7f | 0x80), byte(n & 0x7f)}
+	return append(header, data...)
+}
+
+// packLanguage упаковывает код ISO 639-2 в 15 бит, как в mdhd
+func packLanguage(language string) uint16 {
+	if len(language) != 3 {
+		language = "und"
+	}
+
+	var packed uint16
+	for _, c := range []byte(language) {
+		if c < 'a' || c > 'z' {
+			return packLanguage("und")
+		}
+		packed = packed<<5 | uint16(c-0x60)
+	}
+
+	return packed
+}
+
+func matrix() []byte {
+	return concat(u32(0x00010000), u32(0), u32(0), u32(0), u32(0x00010000), u32(0), u32(0), u32(0), u32(0x40000000))
+}
+
+func makeBox(boxType string, parts ...[]byte) []byte {
+	data := concat(parts...)
+	return concat(u32(uint32(len(data)+8)), []byte(boxType), data)
+}
+
+func makeFullBox(boxType string, version byte, flags uint32, parts ...[]byte) []byte {
+	header := u32(uint32(version)<<24 | flags&0xffffff)
+	return makeBox(boxType, append([][]byte{header}, parts...)...)
+}
+
+func concat(parts ...[]byte) []byte {
+	var size int
+	for _, p := range parts {
+		size += len(p)
+	}
+
+	data := make([]byte, 0, size)
+	for _, p := range parts {
+		data = append(data, p...)
+	}
+
+	return data
+}
+
+func u16(v uint16) []byte {
+	return binary.BigEndian.AppendUint16(nil, v)
+}
+
+func u32(v uint32) []byte {
+	return binary.BigEndian.AppendUint32(nil, v)
+}
+
+func u64(v uint64) []byte {
+	return binary.BigEndian.AppendUint64(nil, v)
+}
@@ -0,0 +1,165 @@
+package mp4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestWriteInit(t *testing.T) {
+	configs := []TrackConfig{
+		{Id: 1, Handler: "vide", Timescale: 1000, Language: "und", Width: 1920, Height: 1080,
+			SampleEntry: AVCSampleEntry("avc1", "avcC", []byte{1, 0x64, 0, 0x28}, 1920, 1080)},
+		{Id: 2, Handler: "soun", Timescale: 1000, Language: "rus",
+			SampleEntry: AudioSampleEntry(ObjectTypeAAC, []byte{0x11, 0x90}, 2, 48000)},
+	}
+
+	var buf bytes.Buffer
+	if err := WriteInit(&buf, configs, 90000, 1000); err != nil {
+		t.Fatalf("WriteInit() error = %v", err)
+	}
+
+	data := buf.Bytes()
+	boxes, err := ParseBoxes(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(boxes) != 2 || boxes[0].Type != "ftyp" || boxes[1].Type != "moov" {
+		t.Fatalf("boxes = %+v, want ftyp and moov", boxes)
+	}
+	moov := data[boxes[1].DataOffset():boxes[1].End()]
+
+	mvhd, _ := FindBox(moov, "mvhd")
+	if timescale, duration, ok := MediaHeader(mvhd); !ok || timescale != 1000 || duration != 90000 {
+		t.Errorf("mvhd = %d, %d, %v", timescale, duration, ok)
+	}
+	if trex := FindBoxes(mustFind(t, moov, "mvex"), "trex"); len(trex) != 2 {
+		t.Errorf("trex = %d, want 2", len(trex))
+	}
+
+	// Сегмент инициализации читается обратно как дорожки без сэмплов
+	tracks, err := ReadTracks(moov)
+	if err != nil {
+		t.Fatalf("ReadTracks() error = %v", err)
+	}
+	if len(tracks) != len(configs) {
+		t.Fatalf("tracks = %d, want %d", len(tracks), len(configs))
+	}
+	for i, track := range tracks {
+		if len(track.Samples) != 0 {
+			t.Errorf("track %d has %d samples", track.Id, len(track.Samples))
+		}
+		if got := track.Config(); !reflect.DeepEqual(got, configs[i]) {
+			t.Errorf("track %d config = %+v, want %+v", i, got, configs[i])
+		}
+	}
+}
+
+func mustFind(t *testing.T, data []byte, path ...string) []byte {
+	t.Helper()
+
+	found, ok := FindBox(data, path...)
+	if !ok {
+		t.Fatalf("%v not found", path)
+	}
+	return found
+}
+
+func TestWriteFragment(t *testing.T) {
+	fragments := []TrackFragment{
+		{TrackId: 1, BaseTime: 5000, Samples: []Sample{
+			{Duration: 40, Keyframe: true, Data: []byte("video-key")},
+			{Duration: 40, CompositionOffset: -40, Data: []byte("video-b")},
+		}},
+		{TrackId: 2, BaseTime: 4990, Samples: []Sample{
+			{Duration: 21, Keyframe: true, Data: []byte("audio")},
+		}},
+	}
+
+	var buf bytes.Buffer
+	if err := WriteFragment(&buf, 7, fragments); err != nil {
+		t.Fatalf("WriteFragment() error = %v", err)
+	}
+
+	data := buf.Bytes()
+	boxes, err := ParseBoxes(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(boxes) != 2 || boxes[0].Type != "moof" || boxes[1].Type != "mdat" {
+		t.Fatalf("boxes = %+v, want moof and mdat", boxes)
+	}
+	if got := string(data[boxes[1].DataOffset():]); got != "video-keyvideo-baudio" {
+		t.Errorf("mdat = %q", got)
+	}
+
+	moof := data[boxes[0].DataOffset():boxes[0].End()]
+	if seq := binary.BigEndian.Uint32(mustFind(t, moof, "mfhd")[4:]); seq != 7 {
+		t.Errorf("sequence = %d, want 7", seq)
+	}
+
+	trafs := FindBoxes(moof, "traf")
+	if len(trafs) != len(fragments) {
+		t.Fatalf("traf = %d, want %d", len(trafs), len(fragments))
+	}
+	for i, traf := range trafs {
+		f := fragments[i]
+		if id := binary.BigEndian.Uint32(mustFind(t, traf, "tfhd")[4:]); id != f.TrackId {
+			t.Errorf("traf %d track = %d, want %d", i, id, f.TrackId)
+		}
+		if base := binary.BigEndian.Uint64(mustFind(t, traf, "tfdt")[4:]); base != f.BaseTime {
+			t.Errorf("traf %d base time = %d, want %d", i, base, f.BaseTime)
+		}
+
+		trun := mustFind(t, traf, "trun")
+		if count := binary.BigEndian.Uint32(trun[4:]); int(count) != len(f.Samples) {
+			t.Fatalf("traf %d samples = %d, want %d", i, count, len(f.Samples))
+		}
+
+		// Смещение данных отсчитывается от начала moof
+		offset := int(binary.BigEndian.Uint32(trun[8:]))
+		for j, s := range f.Samples {
+			entry := trun[12+j*16:]
+			size := int(binary.BigEndian.Uint32(entry[4:]))
+			if got := data[offset : offset+size]; !bytes.Equal(got, s.Data) {
+				t.Errorf("traf %d sample %d data = %q, want %q", i, j, got, s.Data)
+			}
+			if duration := binary.BigEndian.Uint32(entry); duration != s.Duration {
+				t.Errorf("traf %d sample %d duration = %d, want %d", i, j, duration, s.Duration)
+			}
+			if sync := binary.BigEndian.Uint32(entry[8:]) == sampleFlagsSync; sync != s.Keyframe {
+				t.Errorf("traf %d sample %d sync = %v, want %v", i, j, sync, s.Keyframe)
+			}
+			if cto := int32(binary.BigEndian.Uint32(entry[12:])); cto != s.CompositionOffset {
+				t.Errorf("traf %d sample %d composition offset = %d, want %d", i, j, cto, s.CompositionOffset)
+			}
+			offset += size
+		}
+	}
+}
+
+func TestOpusSampleEntry(t *testing.T) {
+	head := []byte("OpusHead\x01\x02\x38\x01\x80\xbb\x00\x00\x00\x00\x00")
+
+	entry, err := OpusSampleEntry(head)
+	if err != nil {
+		t.Fatalf("OpusSampleEntry() error = %v", err)
+	}
+	dops, ok := FindBox(entry[8+28:], "dOps")
+	if !ok {
+		t.Fatal("dOps not found")
+	}
+	// Поля OpusHead переводятся в big-endian: предварительный пропуск 312, частота 48000
+	want := []byte{0, 2, 0x01, 0x38, 0, 0, 0xbb, 0x80, 0, 0, 0}
+	if !bytes.Equal(dops, want) {
+		t.Errorf("dOps = %x, want %x", dops, want)
+	}
+
+	for _, invalid := range [][]byte{[]byte("OpusTags"), []byte("OpusHead\x01\x02\x38\x01\x80\xbb\x00\x00\x00\x00\x01")} {
+		if _, err := OpusSampleEntry(invalid); !errors.Is(err, ErrInvalidOpusHead) {
+			t.Errorf("OpusSampleEntry(%q) error = %v, want %v", invalid, err, ErrInvalidOpusHead)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package mp4
+
+import "encoding/binary"
+
+// MediaHeader извлекает timescale и длительность из mvhd или mdhd
+func MediaHeader(data []byte) (uint32, uint64, bool) {
+	if len(data) < 20 {
+		return 0, 0, false
+	}
+
+	var timescale uint32
+	var duration uint64
+	if data[0] == 1 {
+		if len(data) < 32 {
+			return 0, 0, false
+		}
+		timescale = binary.BigEndian.Uint32(data[20:24])
+		duration = binary.BigEndian.Uint64(data[24:32])
+	} else {
+		timescale = binary.BigEndian.Uint32(data[12:16])
+		duration = uint64(binary.BigEndian.Uint32(data[16:20]))
+	}
+
+	if timescale == 0 {
+		return 0, 0, false
+	}
+
+	return timescale, duration, true
+}
+
+// TrackId возвращает номер дорожки из tkhd
+func TrackId(tkhd []byte) uint32 {
+	offset := 12
+	if len(tkhd) > 0 && tkhd[0] == 1 {
+		offset = 20
+	}
+	if len(tkhd) < offset+4 {
+		return 0
+	}
+
+	return binary.BigEndian.Uint32(tkhd[offset:])
+}
+
+// TrackSize возвращает размер кадра из tkhd, где он хранится в формате 16.16
+func TrackSize(tkhd []byte) (int, int) {
+	if len(tkhd) < 8 {
+		return 0, 0
+	}
+
+	width := int(binary.BigEndian.Uint32(tkhd[len(tkhd)-8:]) >> 16)
+	height := int(binary.BigEndian.Uint32(tkhd[len(tkhd)-4:]) >> 16)
+	return width, height
+}
+
+// Language возвращает код языка ISO 639-2 из mdhd
+func Language(mdhd []byte) string {
+	offset := 20
+	if len(mdhd) > 0 && mdhd[0] == 1 {
+		offset = 32
+	}
+	if len(mdhd) < offset+2 {
+		return "und"
+	}
+
+	// Три буквы по 5 бит, каждая со смещением 0x60
+	packed := binary.BigEndian.Uint16(mdhd[offset:])
+	code := []byte{
+		byte(packed>>10&0x1f) + 0x60,
+		byte(packed>>5&0x1f) + 0x60,
+		byte(packed&0x1f) + 0x60,
+	}
+	for _, c := range code {
+		if c < 'a' || c > 'z' {
+			return "und"
+		}
+	}
+
+	return string(code)
+}
+
+// HandlerType возвращает тип обработчика из hdlr: "vide", "soun" и т.п.
+func HandlerType(hdlr []byte) string {
+	if len(hdlr) < 12 {
+		return ""
+	}
+	return string(hdlr[8:12])
+}
@@ -0,0 +1,304 @@
+package mp4
+
+import (
+	"encoding/binary"
+	"fmt"
+	"slices"
+)
+
+// maxSamples ограничивает число сэмплов дорожки: при постоянном размере
+// сэмпла stsz не содержит таблицы, и число записей ничем не ограничено
+const maxSamples = 1 << 22
+
+// SampleInfo описывает расположение и время сэмпла в нефрагментированном MP4
+type SampleInfo struct {
+	Offset            int64
+	Size              uint32
+	Time              int64 // Время декодирования в единицах timescale дорожки
+	Duration          uint32
+	CompositionOffset int32
+	Sync              bool
+}
+
+// Track описывает дорожку с таблицей сэмплов
+type Track struct {
+	Id          uint32
+	Handler     string
+	Timescale   uint32
+	Language    string
+	Width       int
+	Height      int
+	SampleEntry []byte
+	Samples     []SampleInfo
+}
+
+// Config возвращает описание дорожки для сегмента инициализации фрагментированного MP4
+func (t *Track) Config() TrackConfig {
+	return TrackConfig{
+		Id:          t.Id,
+		Handler:     t.Handler,
+		Timescale:   t.Timescale,
+		Language:    t.Language,
+		Width:       t.Width,
+		Height:      t.Height,
+		SampleEntry: t.SampleEntry,
+	}
+}
+
+// ReadTracks разбирает дорожки из содержимого атома moov
+func ReadTracks(moov []byte) ([]*Track, error) {
+	var tracks []*Track
+
+	for _, trak := range FindBoxes(moov, "trak") {
+		t, err := readTrack(trak)
+		if err != nil {
+			return nil, err
+		}
+		if t != nil {
+			tracks = append(tracks, t)
+		}
+	}
+
+	return tracks, nil
+}
+
+func readTrack(trak []byte) (*Track, error) {
+	tkhd, ok1 := FindBox(trak, "tkhd")
+	mdhd, ok2 := FindBox(trak, "mdia", "mdhd")
+	hdlr, ok3 := FindBox(trak, "mdia", "hdlr")
+	stbl, ok4 := FindBox(trak, "mdia", "minf", "stbl")
+	if !ok1 || !ok2 || !ok3 || !ok4 {
+		return nil, nil
+	}
+
+	timescale, _, ok := MediaHeader(mdhd)
+	if !ok {
+		return nil, fmt.Errorf("%w: mdhd", ErrInvalidBox)
+	}
+
+	t := &Track{
+		Id:        TrackId(tkhd),
+		Handler:   HandlerType(hdlr),
+		Timescale: timescale,
+		Language:  Language(mdhd),
+	}
+	t.Width, t.Height = TrackSize(tkhd)
+
+	stsd, ok := FindBox(stbl, "stsd")
+	if !ok || len(stsd) < 8 {
+		return nil, fmt.Errorf("%w: stsd", ErrInvalidBox)
+	}
+	entries, err := ParseBoxes(stsd[8:])
+	if err != nil || len(entries) == 0 {
+		return nil, fmt.Errorf("%w: stsd", ErrInvalidBox)
+	}
+	t.SampleEntry = slices.Clone(stsd[8+entries[0].Offset : 8+entries[0].End()])
+
+	if t.Samples, err = readSamples(stbl); err != nil {
+		return nil, err
+	}
+
+	// Список редактирования обычно сдвигает начало на задержку B-кадров
+	if elst, ok := FindBox(trak, "edts", "elst"); ok {
+		if shift := editShift(elst); shift > 0 {
+			for i := range t.Samples {
+				t.Samples[i].CompositionOffset -= int32(shift)
+			}
+		}
+	}
+
+	return t, nil
+}
+
+// readSamples строит таблицу сэмплов из stsz, stts, ctts, stsc, stco/co64 и stss
+func readSamples(stbl []byte) ([]SampleInfo, error) {
+	stsz, ok := FindBox(stbl, "stsz")
+	if !ok || len(stsz) < 12 {
+		return nil, fmt.Errorf("%w: stsz", ErrInvalidBox)
+	}
+
+	fixedSize := binary.BigEndian.Uint32(stsz[4:8])
+	count := int(binary.BigEndian.Uint32(stsz[8:12]))
+	if count > maxSamples || fixedSize == 0 && 12+count*4 > len(stsz) {
+		return nil, fmt.Errorf("%w: stsz", ErrInvalidBox)
+	}
+
+	samples := make([]SampleInfo, count)
+	for i := range samples {
+		samples[i].Size = fixedSize
+		if fixedSize == 0 {
+			samples[i].Size = binary.BigEndian.Uint32(stsz[12+i*4:])
+		}
+	}
+
+	if err := readTimes(stbl, samples); err != nil {
+		return nil, err
+	}
+	if err := readOffsets(stbl, samples); err != nil {
+		return nil, err
+	}
+
+	stss, ok := FindBox(stbl, "stss")
+	if !ok {
+		// Без stss все сэмплы являются ключевыми
+		for i := range samples {
+			samples[i].Sync = true
+		}
+		return samples, nil
+	}
+
+	n, err := tableEntries(stss, 4)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < n; i++ {
+		idx := int(binary.BigEndian.Uint32(stss[8+i*4:])) - 1
+		if idx >= 0 && idx < len(samples) {
+			samples[idx].Sync = true
+		}
+	}
+
+	return samples, nil
+}
+
+func readTimes(stbl []byte, samples []SampleInfo) error {
+	stts, ok := FindBox(stbl, "stts")
+	if !ok {
+		return fmt.Errorf("%w: stts", ErrInvalidBox)
+	}
+
+	n, err := tableEntries(stts, 8)
+	if err != nil {
+		return err
+	}
+
+	idx := 0
+	var time int64
+	for i := 0; i < n && idx < len(samples); i++ {
+		runLength := int(binary.BigEndian.Uint32(stts[8+i*8:]))
+		delta := binary.BigEndian.Uint32(stts[12+i*8:])
+		for j := 0; j < runLength && idx < len(samples); j++ {
+			samples[idx].Time = time
+			samples[idx].Duration = delta
+			time += int64(delta)
+			idx++
+		}
+	}
+
+	ctts, ok := FindBox(stbl, "ctts")
+	if !ok {
+		return nil
+	}
+
+	n, err = tableEntries(ctts, 8)
+	if err != nil {
+		return err
+	}
+
+	idx = 0
+	for i := 0; i < n && idx < len(samples); i++ {
+		runLength := int(binary.BigEndian.Uint32(ctts[8+i*8:]))
+		// В версии 0 смещение беззнаковое, но на практике встречаются и отрицательные
+		offset := int32(binary.BigEndian.Uint32(ctts[12+i*8:]))
+		for j := 0; j < runLength && idx < len(samples); j++ {
+			samples[idx].CompositionOffset = offset
+			idx++
+		}
+	}
+
+	return nil
+}
+
+func readOffsets(stbl []byte, samples []SampleInfo) error {
+	var chunks []int64
+	if stco, ok := FindBox(stbl, "stco"); ok {
+		n, err := tableEntries(stco, 4)
+		if err != nil {
+			return err
+		}
+		chunks = make([]int64, n)
+		for i := range chunks {
+			chunks[i] = int64(binary.BigEndian.Uint32(stco[8+i*4:]))
+		}
+	} else if co64, ok := FindBox(stbl, "co64"); ok {
+		n, err := tableEntries(co64, 8)
+		if err != nil {
+			return err
+		}
+		chunks = make([]int64, n)
+		for i := range chunks {
+			chunks[i] = int64(binary.BigEndian.Uint64(co64[8+i*8:]))
+		}
+	} else {
+		return fmt.Errorf("%w: stco", ErrInvalidBox)
+	}
+
+	stsc, ok := FindBox(stbl, "stsc")
+	if !ok {
+		return fmt.Errorf("%w: stsc", ErrInvalidBox)
+	}
+	n, err := tableEntries(stsc, 12)
+	if err != nil {
+		return err
+	}
+
+	idx := 0
+	for i := 0; i < n; i++ {
+		firstChunk := int(binary.BigEndian.Uint32(stsc[8+i*12:])) - 1
+		perChunk := int(binary.BigEndian.Uint32(stsc[12+i*12:]))
+
+		lastChunk := len(chunks)
+		if i+1 < n {
+			lastChunk = int(binary.BigEndian.Uint32(stsc[8+(i+1)*12:])) - 1
+		}
+
+		for c := max(firstChunk, 0); c < min(lastChunk, len(chunks)); c++ {
+			offset := chunks[c]
+			for j := 0; j < perChunk && idx < len(samples); j++ {
+				// Смещения co64 и их сумма с размерами не должны выходить за int64
+				end := offset + int64(samples[idx].Size)
+				if offset < 0 || end < offset {
+					return fmt.Errorf("%w: sample offset", ErrInvalidBox)
+				}
+				samples[idx].Offset = offset
+				offset = end
+				idx++
+			}
+		}
+	}
+
+	if idx < len(samples) {
+		return fmt.Errorf("%w: stsc does not cover all samples", ErrInvalidBox)
+	}
+
+	return nil
+}
+
+// editShift возвращает начало первого непустого фрагмента списка редактирования
+func editShift(elst []byte) int64 {
+	entrySize := 12
+	if len(elst) > 0 && elst[0] == 1 {
+		entrySize = 20
+	}
+
+	n, err := tableEntries(elst, entrySize)
+	if err != nil {
+		return 0
+	}
+
+	for i := 0; i < n; i++ {
+		entry := elst[8+i*entrySize:]
+		var mediaTime int64
+		if entrySize == 20 {
+			mediaTime = int64(binary.BigEndian.Uint64(entry[8:]))
+		} else {
+			mediaTime = int64(int32(binary.BigEndian.Uint32(entry[4:])))
+		}
+		// -1 обозначает пустой фрагмент (паузу)
+		if mediaTime >= 0 {
+			return mediaTime
+		}
+	}
+
+	return 0
+}
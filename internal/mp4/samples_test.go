@@ -0,0 +1,74 @@
+package mp4
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+// testTrak собирает дорожку видео из двух сэмплов по 1000 единиц времени
+// с заданными таблицами размеров и смещений чанков
+func testTrak(stsz, offsets []byte) []byte {
+	stbl := makeBox("stbl",
+		makeFullBox("stsd", 0, 0, u32(1), makeBox("avc1")),
+		stsz,
+		makeFullBox("stts", 0, 0, u32(1), u32(2), u32(1000)),
+		makeFullBox("stsc", 0, 0, u32(1), u32(1), u32(2), u32(1)),
+		offsets,
+	)
+
+	return makeBox("trak",
+		makeFullBox("tkhd", 0, 0, u32(0), u32(0), u32(1)),
+		makeBox("mdia",
+			makeFullBox("mdhd", 0, 0, u32(0), u32(0), u32(1000), u32(0)),
+			makeFullBox("hdlr", 0, 0, u32(0), []byte("vide")),
+			makeBox("minf", stbl),
+		),
+	)
+}
+
+func TestReadTracks(t *testing.T) {
+	sizes := makeFullBox("stsz", 0, 0, u32(0), u32(2), u32(4), u32(6))
+
+	tracks, err := ReadTracks(testTrak(sizes, makeFullBox("co64", 0, 0, u32(1), u64(100))))
+	if err != nil {
+		t.Fatalf("ReadTracks() error = %v", err)
+	}
+	if len(tracks) != 1 || len(tracks[0].Samples) != 2 {
+		t.Fatalf("tracks = %+v, want one track with two samples", tracks)
+	}
+
+	want := []SampleInfo{
+		{Offset: 100, Size: 4, Time: 0, Duration: 1000, Sync: true},
+		{Offset: 104, Size: 6, Time: 1000, Duration: 1000, Sync: true},
+	}
+	for i, s := range tracks[0].Samples {
+		if s != want[i] {
+			t.Errorf("sample %d = %+v, want %+v", i, s, want[i])
+		}
+	}
+}
+
+func TestReadTracksInvalid(t *testing.T) {
+	sizes := makeFullBox("stsz", 0, 0, u32(0), u32(2), u32(4), u32(6))
+
+	tests := []struct {
+		name string
+		trak []byte
+	}{
+		{"truncated stsz", testTrak(makeFullBox("stsz", 0, 0, u32(0), u32(2), u32(4)), makeFullBox("stco", 0, 0, u32(1), u32(100)))},
+		// Постоянный размер сэмпла позволяет задать любое число сэмплов без таблицы
+		{"too many samples", testTrak(makeFullBox("stsz", 0, 0, u32(4), u32(math.MaxUint32)), makeFullBox("stco", 0, 0, u32(1), u32(100)))},
+		{"negative chunk offset", testTrak(sizes, makeFullBox("co64", 0, 0, u32(1), u64(1<<63)))},
+		{"sample end overflows", testTrak(sizes, makeFullBox("co64", 0, 0, u32(1), u64(math.MaxInt64-4)))},
+		{"missing chunks", testTrak(sizes, makeFullBox("stco", 0, 0, u32(0)))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ReadTracks(tt.trak); !errors.Is(err, ErrInvalidBox) {
+				t.Errorf("ReadTracks() error = %v, want %v", err, ErrInvalidBox)
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package player
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+)
+
+// ipcRequest и ipcResponse описывают сообщения JSON IPC mpv.
+// Каждое сообщение занимает одну строку.
+type ipcRequest struct {
+	Command   []any `json:"command"`
+	RequestId int   `json:"request_id"`
+}
+
+type ipcResponse struct {
+	Error     string          `json:"error"`
+	Data      json.RawMessage `json:"data"`
+	RequestId int             `json:"request_id"`
+	Event     string          `json:"event"`
+}
+
+var errClosed = errors.New("ipc connection closed")
+
+// ipcConn выполняет команды через сокет IPC и сопоставляет ответы запросам
+type ipcConn struct {
+	conn net.Conn
+
+	mu      sync.Mutex
+	nextId  int
+	pending map[int]chan ipcResponse
+	closed  chan struct{}
+}
+
+func dialIPC(ctx context.Context, socket string) (*ipcConn, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "unix", socket)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &ipcConn{
+		conn:    conn,
+		pending: make(map[int]chan ipcResponse),
+		closed:  make(chan struct{}),
+	}
+	go c.readLoop()
+
+	return c, nil
+}
+
+// command отправляет команду и ждет ответа на нее
+func (c *ipcConn) command(ctx context.Context, args ...any) (json.RawMessage, error) {
+	c.mu.Lock()
+	c.nextId++
+	id := c.nextId
+	ch := make(chan ipcResponse, 1)
+	c.pending[id] = ch
+
+	data, err := json.Marshal(ipcRequest{Command: args, RequestId: id})
+	if err == nil {
+		_, err = c.conn.Write(append(data, '\n'))
+	}
+	if err != nil {
+		delete(c.pending, id)
+		c.mu.Unlock()
+		return nil, err
+	}
+	c.mu.Unlock()
+
+	select {
+	case res := <-ch:
+		if res.Error != "success" {
+			return nil, fmt.Errorf("mpv: %s: %s", args[0], res.Error)
+		}
+		return res.Data, nil
+	case <-c.closed:
+		return nil, errClosed
+	case <-ctx.Done():
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+// readLoop передает ответы ожидающим командам. События mpv не используются.
+func (c *ipcConn) readLoop() {
+	defer close(c.closed)
+
+	scanner := bufio.NewScanner(c.conn)
+	scanner.Buffer(make([]byte, 64<<10), 4<<20)
+	for scanner.Scan() {
+		var res ipcResponse
+		if err := json.Unmarshal(scanner.Bytes(), &res); err != nil || res.Event != "" {
+			continue
+		}
+
+		c.mu.Lock()
+		ch, ok := c.pending[res.RequestId]
+		delete(c.pending, res.RequestId)
+		c.mu.Unlock()
+
+		if ok {
+			ch <- res
+		}
+	}
+}
+
+func (c *ipcConn) done() <-chan struct{} {
+	return c.closed
+}
+
+func (c *ipcConn) Close() error {
+	return c.conn.Close()
+}
@@ -0,0 +1,399 @@
+package player
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+const (
+	// startTimeout ограничивает ожидание сокета IPC после запуска плеера
+	startTimeout = 10 * time.Second
+	// quitTimeout ограничивает ожидание завершения плеера после команды quit
+	quitTimeout = 5 * time.Second
+)
+
+var ErrNotRunning = errors.New("player is not running")
+
+// Media описывает воспроизводимый файл торрента
+type Media struct {
+	TorrentId string `json:"torrent_id"`
+	FileId    string `json:"file_id"`
+	Title     string `json:"title"`
+}
+
+// Track описывает дорожку файла, открытого в плеере
+type Track struct {
+	Id       int    `json:"id"`
+	Type     string `json:"type"` // "video", "audio" или "sub"
+	Title    string `json:"title,omitempty"`
+	Language string `json:"lang,omitempty"`
+	Codec    string `json:"codec,omitempty"`
+	Default  bool   `json:"default"`
+	Selected bool   `json:"selected"`
+}
+
+// State содержит состояние плеера
+type State struct {
+	Running  bool     `json:"running"`
+	Idle     bool     `json:"idle"` // Плеер запущен, но файл не открыт
+	Media    *Media   `json:"media,omitempty"`
+	Paused   bool     `json:"paused"`
+	Position float64  `json:"position"` // Секунды
+	Duration float64  `json:"duration"` // Секунды
+	Volume   float64  `json:"volume"`
+	Audio    int      `json:"audio"`    // Номер выбранной аудиодорожки, 0 - выключена
+	Subtitle int      `json:"subtitle"` // Номер выбранных субтитров, 0 - выключены
+	Tracks   []*Track `json:"tracks,omitempty"`
+}
+
+// Player управляет mpv через JSON IPC. Если команда задана, плеер
+// запускается при первом воспроизведении; иначе Player подключается
+// к сокету уже запущенного mpv.
+type Player struct {
+	command []string
+	socket  string
+
+	mu     sync.Mutex
+	cmd    *exec.Cmd
+	exited chan struct{}
+	conn   *ipcConn
+	media  *Media
+}
+
+// New создает Player. command задает команду запуска mpv без адреса файла,
+// socket - путь к сокету IPC.
+func New(command []string, socket string) *Player {
+	return &Player{
+		command: command,
+		socket:  socket,
+	}
+}
+
+// Play открывает url в плеере, запуская его при необходимости.
+// Воспроизведение начинается с start.
+func (p *Player) Play(ctx context.Context, url string, media Media, start time.Duration) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	conn, err := p.connect(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Параметры start и force-media-title применяются к следующему открываемому файлу
+	startOption := "none"
+	if start > 0 {
+		startOption = fmt.Sprintf("%.3f", start.Seconds())
+	}
+	if _, err := conn.command(ctx, "set_property", "start", startOption); err != nil {
+		return err
+	}
+	if _, err := conn.command(ctx, "set_property", "force-media-title", media.Title); err != nil {
+		return err
+	}
+	if _, err := conn.command(ctx, "loadfile", url, "replace"); err != nil {
+		return err
+	}
+	if _, err := conn.command(ctx, "set_property", "pause", false); err != nil {
+		return err
+	}
+
+	p.media = &media
+	return nil
+}
+
+// Pause ставит воспроизведение на паузу или продолжает его
+func (p *Player) Pause(ctx context.Context, paused bool) error {
+	return p.run(ctx, "set_property", "pause", paused)
+}
+
+// Seek переходит к позиции от начала файла
+func (p *Player) Seek(ctx context.Context, position time.Duration) error {
+	return p.run(ctx, "seek", position.Seconds(), "absolute")
+}
+
+// SetVolume устанавливает громкость в процентах
+func (p *Player) SetVolume(ctx context.Context, volume float64) error {
+	return p.run(ctx, "set_property", "volume", volume)
+}
+
+// SetAudio выбирает аудиодорожку по номеру из State.Tracks, 0 выключает звук
+func (p *Player) SetAudio(ctx context.Context, id int) error {
+	return p.run(ctx, "set_property", "aid", trackValue(id))
+}
+
+// SetSubtitle выбирает субтитры по номеру из State.Tracks, 0 выключает их
+func (p *Player) SetSubtitle(ctx context.Context, id int) error {
+	return p.run(ctx, "set_property", "sid", trackValue(id))
+}
+
+// Stop завершает воспроизведение. Запущенный сервером плеер закрывается,
+// внешний только выгружает файл.
+func (p *Player) Stop(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	conn, err := p.connected()
+	if p.cmd == nil {
+		if err != nil {
+			return err
+		}
+		p.media = nil
+		_, err := conn.command(ctx, "stop")
+		return err
+	}
+
+	cmd, exited := p.cmd, p.exited
+	timeout := quitTimeout
+	if err == nil {
+		if _, err := conn.command(ctx, "quit"); err != nil && !errors.Is(err, errClosed) {
+			log.Printf("Player did not accept quit: %v", err)
+		}
+	} else {
+		// Без подключения к IPC процесс можно только завершить принудительно
+		timeout = 0
+	}
+
+	select {
+	case <-exited:
+	case <-time.After(timeout):
+		_ = cmd.Process.Kill()
+		<-exited
+	}
+	p.reset()
+
+	return nil
+}
+
+// State возвращает состояние плеера. Если плеер не запущен, Running равно false.
+func (p *Player) State(ctx context.Context) (*State, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	state := &State{}
+	conn, err := p.connected()
+	if err != nil {
+		return state, nil
+	}
+	state.Running = true
+	state.Media = p.media
+
+	// Пока файл не открыт, большинство свойств недоступно, поэтому ошибки отдельных свойств пропускаются
+	get := func(name string, dst any) error {
+		data, err := conn.command(ctx, "get_property", name)
+		if err != nil {
+			if errors.Is(err, errClosed) || ctx.Err() != nil {
+				return err
+			}
+			return nil
+		}
+		return json.Unmarshal(data, dst)
+	}
+
+	var audio, subtitle any
+	var tracks []struct {
+		Id       int    `json:"id"`
+		Type     string `json:"type"`
+		Title    string `json:"title"`
+		Language string `json:"lang"`
+		Codec    string `json:"codec"`
+		Default  bool   `json:"default"`
+		Selected bool   `json:"selected"`
+	}
+	for name, dst := range map[string]any{
+		"idle-active": &state.Idle,
+		"pause":       &state.Paused,
+		"time-pos":    &state.Position,
+		"duration":    &state.Duration,
+		"volume":      &state.Volume,
+		"aid":         &audio,
+		"sid":         &subtitle,
+		"track-list":  &tracks,
+	} {
+		if err := get(name, dst); err != nil {
+			return nil, err
+		}
+	}
+
+	state.Audio = trackId(audio)
+	state.Subtitle = trackId(subtitle)
+	for _, t := range tracks {
+		if t.Type == "video" || t.Type == "audio" || t.Type == "sub" {
+			track := Track(t)
+			state.Tracks = append(state.Tracks, &track)
+		}
+	}
+	if state.Idle {
+		state.Media = nil
+	}
+
+	return state, nil
+}
+
+// Close закрывает плеер, запущенный сервером
+func (p *Player) Close() error {
+	p.mu.Lock()
+	running := p.cmd != nil
+	p.mu.Unlock()
+
+	if !running {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), quitTimeout)
+	defer cancel()
+
+	return p.Stop(ctx)
+}
+
+// run выполняет команду в уже запущенном плеере
+func (p *Player) run(ctx context.Context, args ...any) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	conn, err := p.connected()
+	if err != nil {
+		return err
+	}
+
+	_, err = conn.command(ctx, args...)
+	return err
+}
+
+// connected возвращает текущее подключение к плееру. Вызывается под p.mu.
+func (p *Player) connected() (*ipcConn, error) {
+	if p.conn != nil {
+		select {
+		case <-p.conn.done():
+			p.conn = nil
+		default:
+			return p.conn, nil
+		}
+	}
+
+	// Внешний плеер мог быть запущен после предыдущего обращения
+	if len(p.command) == 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		conn, err := dialIPC(ctx, p.socket)
+		if err != nil {
+			return nil, ErrNotRunning
+		}
+		p.conn = conn
+		return conn, nil
+	}
+
+	return nil, ErrNotRunning
+}
+
+// connect подключается к плееру, запуская его при необходимости. Вызывается под p.mu.
+func (p *Player) connect(ctx context.Context) (*ipcConn, error) {
+	if conn, err := p.connected(); err == nil {
+		return conn, nil
+	}
+	if len(p.command) == 0 {
+		return nil, ErrNotRunning
+	}
+
+	if p.cmd != nil {
+		select {
+		case <-p.exited:
+			p.reset()
+		default:
+		}
+	}
+	if p.cmd == nil {
+		if err := p.start(); err != nil {
+			return nil, err
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, startTimeout)
+	defer cancel()
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		conn, err := dialIPC(ctx, p.socket)
+		if err == nil {
+			p.conn = conn
+			return conn, nil
+		}
+
+		select {
+		case <-p.exited:
+			return nil, fmt.Errorf("player exited before opening IPC socket")
+		case <-ctx.Done():
+			return nil, fmt.Errorf("player IPC socket is not available: %w", err)
+		case <-ticker.C:
+		}
+	}
+}
+
+// start запускает плеер в режиме ожидания. Вызывается под p.mu.
+func (p *Player) start() error {
+	// Сокет мог остаться от предыдущего запуска
+	_ = os.Remove(p.socket)
+
+	args := append(append([]string{}, p.command[1:]...), "--idle=yes", "--input-ipc-server="+p.socket)
+	cmd := exec.Command(p.command[0], args...)
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start player: %w", err)
+	}
+
+	exited := make(chan struct{})
+	p.cmd = cmd
+	p.exited = exited
+
+	go func() {
+		if err := cmd.Wait(); err != nil {
+			log.Printf("Player exited: %v", err)
+		}
+		close(exited)
+
+		p.mu.Lock()
+		defer p.mu.Unlock()
+
+		if p.cmd == cmd {
+			p.reset()
+		}
+	}()
+
+	return nil
+}
+
+// reset забывает завершившийся плеер. Вызывается под p.mu.
+func (p *Player) reset() {
+	p.cmd = nil
+	p.exited = nil
+	p.media = nil
+	if p.conn != nil {
+		_ = p.conn.Close()
+		p.conn = nil
+	}
+}
+
+// trackValue переводит номер дорожки в значение свойств aid и sid
+func trackValue(id int) any {
+	if id <= 0 {
+		return "no"
+	}
+	return id
+}
+
+// trackId разбирает значение свойств aid и sid: номер дорожки или false
+func trackId(value any) int {
+	if n, ok := value.(float64); ok {
+		return int(n)
+	}
+	return 0
+}
@@ -0,0 +1,223 @@
+package player
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeMPV заменяет сокет JSON IPC mpv: хранит свойства, отвечает на команды
+// и перед каждым ответом присылает событие, которое клиент должен пропустить
+type fakeMPV struct {
+	mu         sync.Mutex
+	properties map[string]any
+	commands   [][]any
+}
+
+func startFakeMPV(t *testing.T) (*fakeMPV, string) {
+	t.Helper()
+
+	socket := filepath.Join(t.TempDir(), "mpv.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	mpv := &fakeMPV{properties: map[string]any{
+		"idle-active": true,
+		"pause":       false,
+		"volume":      100.0,
+	}}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go mpv.serve(conn)
+		}
+	}()
+
+	return mpv, socket
+}
+
+func (m *fakeMPV) serve(conn net.Conn) {
+	defer conn.Close()
+
+	enc := json.NewEncoder(conn)
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		var req ipcRequest
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			return
+		}
+
+		data, errText := m.handle(req.Command)
+		enc.Encode(map[string]any{"event": "property-change", "name": "time-pos"})
+		enc.Encode(map[string]any{"error": errText, "data": data, "request_id": req.RequestId})
+	}
+}
+
+func (m *fakeMPV) handle(command []any) (any, string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.commands = append(m.commands, command)
+	name, _ := command[0].(string)
+	switch name {
+	case "get_property":
+		value, ok := m.properties[command[1].(string)]
+		if !ok {
+			return nil, "property unavailable"
+		}
+		return value, "success"
+	case "set_property":
+		m.properties[command[1].(string)] = command[2]
+		return nil, "success"
+	case "loadfile":
+		m.properties["idle-active"] = false
+		m.properties["time-pos"] = 0.0
+		m.properties["duration"] = 1800.0
+		m.properties["aid"] = 1.0
+		m.properties["sid"] = false
+		m.properties["track-list"] = []map[string]any{
+			{"id": 1, "type": "video", "codec": "h264", "selected": true},
+			{"id": 1, "type": "audio", "lang": "eng", "codec": "aac", "default": true, "selected": true},
+			{"id": 2, "type": "audio", "lang": "rus", "codec": "ac3"},
+			{"id": 1, "type": "sub", "lang": "rus", "codec": "subrip"},
+		}
+		return nil, "success"
+	case "seek":
+		m.properties["time-pos"] = command[1]
+		return nil, "success"
+	case "stop":
+		m.properties["idle-active"] = true
+		for _, p := range []string{"time-pos", "duration", "aid", "sid", "track-list"} {
+			delete(m.properties, p)
+		}
+		return nil, "success"
+	}
+	return nil, "invalid parameter"
+}
+
+func (m *fakeMPV) property(name string) any {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.properties[name]
+}
+
+func (m *fakeMPV) lastCommand() []any {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.commands[len(m.commands)-1]
+}
+
+func TestPlayerExternal(t *testing.T) {
+	mpv, socket := startFakeMPV(t)
+	p := New(nil, socket)
+	ctx := context.Background()
+
+	state, err := p.State(ctx)
+	if err != nil {
+		t.Fatalf("State() error = %v", err)
+	}
+	if !state.Running || !state.Idle || state.Media != nil {
+		t.Errorf("idle state = %+v", state)
+	}
+
+	media := Media{TorrentId: "hash", FileId: "file", Title: "Movie"}
+	if err := p.Play(ctx, "http://localhost/stream", media, 90*time.Second); err != nil {
+		t.Fatalf("Play() error = %v", err)
+	}
+	if got := mpv.property("start"); got != "90.000" {
+		t.Errorf("start = %v, want 90.000", got)
+	}
+	if got := mpv.property("force-media-title"); got != "Movie" {
+		t.Errorf("force-media-title = %v, want Movie", got)
+	}
+
+	if err := p.Seek(ctx, 95*time.Second); err != nil {
+		t.Fatalf("Seek() error = %v", err)
+	}
+	if err := p.Pause(ctx, true); err != nil {
+		t.Fatalf("Pause() error = %v", err)
+	}
+	if err := p.SetAudio(ctx, 2); err != nil {
+		t.Fatalf("SetAudio() error = %v", err)
+	}
+	if err := p.SetSubtitle(ctx, 0); err != nil {
+		t.Fatalf("SetSubtitle() error = %v", err)
+	}
+	if got := mpv.lastCommand(); !reflect.DeepEqual(got, []any{"set_property", "sid", "no"}) {
+		t.Errorf("subtitle command = %v", got)
+	}
+
+	state, err = p.State(ctx)
+	if err != nil {
+		t.Fatalf("State() error = %v", err)
+	}
+	want := &State{
+		Running:  true,
+		Media:    &media,
+		Paused:   true,
+		Position: 95,
+		Duration: 1800,
+		Volume:   100,
+		Audio:    2,
+		Subtitle: 0,
+	}
+	if len(state.Tracks) != 4 {
+		t.Fatalf("tracks = %d, want 4", len(state.Tracks))
+	}
+	state.Tracks = nil
+	if !reflect.DeepEqual(state, want) {
+		t.Errorf("State() = %+v, want %+v", state, want)
+	}
+
+	if err := p.Stop(ctx); err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+	state, err = p.State(ctx)
+	if err != nil {
+		t.Fatalf("State() error = %v", err)
+	}
+	if !state.Running || !state.Idle || state.Media != nil {
+		t.Errorf("stopped state = %+v", state)
+	}
+}
+
+func TestPlayerNotRunning(t *testing.T) {
+	p := New(nil, filepath.Join(t.TempDir(), "missing.sock"))
+	ctx := context.Background()
+
+	state, err := p.State(ctx)
+	if err != nil || state.Running {
+		t.Errorf("State() = %+v, %v; want not running", state, err)
+	}
+	if err := p.Pause(ctx, true); !errors.Is(err, ErrNotRunning) {
+		t.Errorf("Pause() error = %v, want %v", err, ErrNotRunning)
+	}
+	if err := p.Play(ctx, "http://localhost/stream", Media{}, 0); !errors.Is(err, ErrNotRunning) {
+		t.Errorf("Play() error = %v, want %v", err, ErrNotRunning)
+	}
+}
+
+func TestPlayerCommandError(t *testing.T) {
+	_, socket := startFakeMPV(t)
+	p := New(nil, socket)
+
+	err := p.run(context.Background(), "unknown-command")
+	if err == nil || err.Error() != "mpv: unknown-command: invalid parameter" {
+		t.Errorf("error = %v", err)
+	}
+}
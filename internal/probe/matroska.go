@@ -0,0 +1,87 @@
+package probe
+
+import (
+	"io"
+	"strings"
+
+	"retreat-backend/internal/mkv"
+)
+
+// matroskaCodecs сопоставляет CodecID Matroska с названиями кодеков
+var matroskaCodecs = map[string]string{
+	"V_MPEG4/ISO/AVC":  "h264",
+	"V_MPEGH/ISO/HEVC": "hevc",
+	"V_AV1":            "av1",
+	"V_VP8":            "vp8",
+	"V_VP9":            "vp9",
+	"V_MPEG4/ISO/ASP":  "mpeg4",
+	"V_MPEG2":          "mpeg2",
+	"A_MPEG/L3":        "mp3",
+	"A_AC3":            "ac3",
+	"A_EAC3":           "eac3",
+	"A_DTS":            "dts",
+	"A_TRUEHD":         "truehd",
+	"A_OPUS":           "opus",
+	"A_VORBIS":         "vorbis",
+	"A_FLAC":           "flac",
+	"S_TEXT/UTF8":      "subrip",
+	"S_TEXT/ASS":       "ass",
+	"S_TEXT/SSA":       "ssa",
+	"S_TEXT/WEBVTT":    "webvtt",
+	"S_HDMV/PGS":       "pgs",
+	"S_VOBSUB":         "vobsub",
+}
+
+// matroskaCodec возвращает название кодека по CodecID
+func matroskaCodec(codecId string) string {
+	if name, ok := matroskaCodecs[codecId]; ok {
+		return name
+	}
+	// Варианты AAC различаются профилем: A_AAC/MPEG4/LC и т.п.
+	if strings.HasPrefix(codecId, "A_AAC") {
+		return "aac"
+	}
+	if strings.HasPrefix(codecId, "A_PCM") {
+		return "pcm"
+	}
+	return strings.ToLower(codecId)
+}
+
+func probeMatroska(r io.ReadSeeker, size int64) (*MediaInfo, error) {
+	header, err := mkv.ReadHeader(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &MediaInfo{
+		Container: "mkv",
+		Duration:  header.Duration.Seconds(),
+	}
+	if header.DocType == "webm" {
+		info.Container = "webm"
+	}
+
+	for _, t := range header.Tracks {
+		track := &Track{
+			Id:       t.Number,
+			Codec:    matroskaCodec(t.CodecID),
+			Language: t.Language,
+			Name:     t.Name,
+			Default:  t.Default,
+			Forced:   t.Forced,
+		}
+
+		switch t.Type {
+		case mkv.TrackVideo:
+			if info.Video == nil {
+				info.Video = &Video{Id: t.Number, Codec: track.Codec, Width: t.Width, Height: t.Height}
+			}
+		case mkv.TrackAudio:
+			info.Audio = append(info.Audio, track)
+		case mkv.TrackSubtitle:
+			info.Subtitles = append(info.Subtitles, track)
+		}
+	}
+
+	return info, nil
+}
@@ -0,0 +1,133 @@
+package probe
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"retreat-backend/internal/mp4"
+)
+
+// mp4Codecs сопоставляет типы записей stsd с названиями кодеков
+var mp4Codecs = map[string]string{
+	"avc1": "h264",
+	"avc3": "h264",
+	"hvc1": "hevc",
+	"hev1": "hevc",
+	"av01": "av1",
+	"vp08": "vp8",
+	"vp09": "vp9",
+	"mp4v": "mpeg4",
+	"mp4a": "aac",
+	".mp3": "mp3",
+	"ac-3": "ac3",
+	"ec-3": "eac3",
+	"Opus": "opus",
+	"fLaC": "flac",
+	"alac": "alac",
+	"tx3g": "tx3g",
+	"wvtt": "webvtt",
+	"stpp": "ttml",
+	"c608": "eia608",
+}
+
+func probeMP4(r io.ReadSeeker, size int64) (*MediaInfo, error) {
+	boxes, err := mp4.ReadBoxes(r, 0, size)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &MediaInfo{Container: "mp4"}
+
+	var moov *mp4.Box
+	for i, b := range boxes {
+		switch b.Type {
+		case "ftyp":
+			data, err := mp4.ReadBox(r, b)
+			if err != nil {
+				return nil, err
+			}
+			if brand := data[b.HeaderSize:]; len(brand) >= 4 && string(brand[:4]) == "qt  " {
+				info.Container = "mov"
+			}
+		case "moov":
+			moov = &boxes[i]
+		}
+	}
+
+	if moov == nil {
+		return nil, fmt.Errorf("%w: moov not found", mp4.ErrInvalidBox)
+	}
+	data, err := mp4.ReadBox(r, *moov)
+	if err != nil {
+		return nil, err
+	}
+	data = data[moov.HeaderSize:]
+
+	if mvhd, ok := mp4.FindBox(data, "mvhd"); ok {
+		if timescale, duration, ok := mp4.MediaHeader(mvhd); ok {
+			info.Duration = float64(duration) / float64(timescale)
+		}
+	}
+
+	for _, trak := range mp4.FindBoxes(data, "trak") {
+		parseTrak(info, trak)
+	}
+
+	return info, nil
+}
+
+// parseTrak добавляет в info дорожку из атома trak
+func parseTrak(info *MediaInfo, trak []byte) {
+	hdlr, ok := mp4.FindBox(trak, "mdia", "hdlr")
+	if !ok {
+		return
+	}
+
+	var id int
+	tkhd, hasTkhd := mp4.FindBox(trak, "tkhd")
+	if hasTkhd {
+		id = int(mp4.TrackId(tkhd))
+	}
+
+	language := "und"
+	if mdhd, ok := mp4.FindBox(trak, "mdia", "mdhd"); ok {
+		language = mp4.Language(mdhd)
+	}
+
+	codec := ""
+	if stsd, ok := mp4.FindBox(trak, "mdia", "minf", "stbl", "stsd"); ok && len(stsd) > 8 {
+		if entries, err := mp4.ParseBoxes(stsd[8:]); err == nil && len(entries) > 0 {
+			codec = entries[0].Type
+		}
+	}
+	if name, ok := mp4Codecs[codec]; ok {
+		codec = name
+	} else {
+		codec = strings.ToLower(strings.TrimSpace(codec))
+	}
+
+	switch mp4.HandlerType(hdlr) {
+	case "vide":
+		if info.Video != nil {
+			return
+		}
+		info.Video = &Video{Id: id, Codec: codec}
+		if hasTkhd {
+			info.Video.Width, info.Video.Height = mp4.TrackSize(tkhd)
+		}
+	case "soun":
+		info.Audio = append(info.Audio, &Track{
+			Id:       id,
+			Codec:    codec,
+			Language: language,
+			Default:  len(info.Audio) == 0,
+		})
+	case "sbtl", "subt", "text", "clcp":
+		info.Subtitles = append(info.Subtitles, &Track{
+			Id:       id,
+			Codec:    codec,
+			Language: language,
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package probe
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"time"
+)
+
+// MediaInfo содержит сведения о медиафайле, извлеченные из заголовков контейнера
+type MediaInfo struct {
+	Container string   `json:"container" bson:"container"`
+	Duration  float64  `json:"duration,omitempty" bson:"duration,omitempty"` // Длительность в секундах
+	Video     *Video   `json:"video,omitempty" bson:"video,omitempty"`
+	Audio     []*Track `json:"audio,omitempty" bson:"audio,omitempty"`
+	Subtitles []*Track `json:"subtitles,omitempty" bson:"subtitles,omitempty"`
+
+	// Playable сообщает, может ли браузер воспроизвести файл без перекодирования
+	Playable    bool     `json:"playable" bson:"playable"`
+	Unsupported []string `json:"unsupported,omitempty" bson:"unsupported,omitempty"`
+}
+
+// Video описывает видеодорожку
+type Video struct {
+	Id     int    `json:"id" bson:"id"`
+	Codec  string `json:"codec" bson:"codec"`
+	Width  int    `json:"width,omitempty" bson:"width,omitempty"`
+	Height int    `json:"height,omitempty" bson:"height,omitempty"`
+}
+
+// Track описывает аудиодорожку или дорожку субтитров
+type Track struct {
+	Id       int    `json:"id" bson:"id"` // Номер дорожки в контейнере
+	Codec    string `json:"codec" bson:"codec"`
+	Language string `json:"language,omitempty" bson:"language,omitempty"`
+	Name     string `json:"name,omitempty" bson:"name,omitempty"`
+	Default  bool   `json:"default,omitempty" bson:"default,omitempty"`
+	Forced   bool   `json:"forced,omitempty" bson:"forced,omitempty"`
+}
+
+// DurationTime возвращает длительность как time.Duration
+func (mi *MediaInfo) DurationTime() time.Duration {
+	return time.Duration(mi.Duration * float64(time.Second))
+}
+
+var ErrUnknownFormat = errors.New("unknown container format")
+
+// Probe определяет формат контейнера по сигнатуре и читает его заголовки.
+// Читаются только заголовки, поэтому при чтении через торрент загружаются
+// лишь нужные части файла.
+func Probe(r io.ReadSeeker, size int64) (*MediaInfo, error) {
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	var magic [12]byte
+	if _, err := io.ReadFull(r, magic[:]); err != nil {
+		return nil, fmt.Errorf("failed to read signature: %w", err)
+	}
+
+	var info *MediaInfo
+	var err error
+	switch {
+	case string(magic[:4]) == "\x1a\x45\xdf\xa3":
+		info, err = probeMatroska(r, size)
+	case string(magic[4:8]) == "ftyp":
+		info, err = probeMP4(r, size)
+	default:
+		return nil, ErrUnknownFormat
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	info.checkPlayable()
+	return info, nil
+}
+
+var (
+	// browserVideo содержит видеокодеки, которые браузеры воспроизводят без перекодирования
+	browserVideo = []string{"h264", "vp8", "vp9", "av1"}
+	// browserAudio содержит аудиокодеки, которые браузеры воспроизводят без перекодирования
+	browserAudio = []string{"aac", "mp3", "opus", "vorbis", "flac"}
+)
+
+// checkPlayable проверяет кодеки: файл воспроизводим, если браузер поддерживает
+// видео и хотя бы одну аудиодорожку
+func (mi *MediaInfo) checkPlayable() {
+	mi.Playable = true
+	mi.Unsupported = nil
+
+	if mi.Video != nil && !slices.Contains(browserVideo, mi.Video.Codec) {
+		mi.Playable = false
+		mi.Unsupported = append(mi.Unsupported, mi.Video.Codec)
+	}
+
+	audioOk := len(mi.Audio) == 0
+	for _, a := range mi.Audio {
+		if slices.Contains(browserAudio, a.Codec) {
+			audioOk = true
+		} else if !slices.Contains(mi.Unsupported, a.Codec) {
+			mi.Unsupported = append(mi.Unsupported, a.Codec)
+		}
+	}
+	if !audioOk {
+		mi.Playable = false
+	}
+}
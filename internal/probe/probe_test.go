@@ -0,0 +1,207 @@
+package probe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+
+	"retreat-backend/internal/mkv"
+)
+
+// ebml собирает элемент EBML с размером в восьмибайтовом vint
+func ebml(id uint32, children ...[]byte) []byte {
+	idBytes := binary.BigEndian.AppendUint32(nil, id)
+	for len(idBytes) > 1 && idBytes[0] == 0 {
+		idBytes = idBytes[1:]
+	}
+	content := bytes.Join(children, nil)
+	return bytes.Join([][]byte{idBytes, binary.BigEndian.AppendUint64(nil, uint64(len(content))|1<<56), content}, nil)
+}
+
+func ebmlUint(id uint32, v uint64) []byte {
+	return ebml(id, binary.BigEndian.AppendUint64(nil, v))
+}
+
+func ebmlString(id uint32, s string) []byte {
+	return ebml(id, []byte(s))
+}
+
+// box собирает атом MP4
+func box(boxType string, children ...[]byte) []byte {
+	content := bytes.Join(children, nil)
+	return bytes.Join([][]byte{binary.BigEndian.AppendUint32(nil, uint32(8+len(content))), []byte(boxType), content}, nil)
+}
+
+func u32(values ...uint32) []byte {
+	var b []byte
+	for _, v := range values {
+		b = binary.BigEndian.AppendUint32(b, v)
+	}
+	return b
+}
+
+// matroskaFile собирает Matroska с заданными дорожками длительностью 90 секунд
+func matroskaFile(docType string, tracks ...[]byte) []byte {
+	info := ebml(mkv.IdInfo,
+		ebmlUint(mkv.IdTimestampScale, 1000000),
+		ebml(mkv.IdDuration, binary.BigEndian.AppendUint64(nil, math.Float64bits(90000))),
+	)
+	return append(ebml(mkv.IdEBML, ebmlString(mkv.IdDocType, docType)), ebml(mkv.IdSegment, info, ebml(mkv.IdTracks, tracks...))...)
+}
+
+func matroskaTrack(number, trackType uint64, codecId string, fields ...[]byte) []byte {
+	return ebml(mkv.IdTrackEntry, append([][]byte{
+		ebmlUint(mkv.IdTrackNumber, number),
+		ebmlUint(mkv.IdTrackType, trackType),
+		ebmlString(mkv.IdCodecID, codecId),
+	}, fields...)...)
+}
+
+// mp4Track собирает trak с обработчиком handler, кодеком codec и языком из mdhd
+func mp4Track(id uint32, handler, codec, language string, width, height uint32) []byte {
+	tkhd := box("tkhd", u32(0, 0, 0, id, 0, 0, width<<16, height<<16))
+	mdia := [][]byte{box("hdlr", u32(0, 0), []byte(handler), u32(0, 0, 0))}
+	if language != "" {
+		packed := uint16(language[0]-0x60)<<10 | uint16(language[1]-0x60)<<5 | uint16(language[2]-0x60)
+		mdia = append(mdia, box("mdhd", u32(0, 0, 0, 1000, 0), binary.BigEndian.AppendUint16(nil, packed), []byte{0, 0}))
+	}
+	stsd := box("stsd", u32(0, 1), box(codec, make([]byte, 16)))
+	mdia = append(mdia, box("minf", box("stbl", stsd)))
+
+	return box("trak", tkhd, box("mdia", mdia...))
+}
+
+func TestProbe(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want *MediaInfo
+	}{
+		{
+			name: "matroska",
+			data: matroskaFile("matroska",
+				matroskaTrack(1, mkv.TrackVideo, "V_MPEGH/ISO/HEVC", ebml(mkv.IdVideo, ebmlUint(mkv.IdPixelWidth, 3840), ebmlUint(mkv.IdPixelHeight, 2160))),
+				matroskaTrack(2, mkv.TrackAudio, "A_AC3", ebmlString(mkv.IdLanguage, "rus"), ebmlString(mkv.IdName, "Dub")),
+				matroskaTrack(3, mkv.TrackAudio, "A_DTS", ebmlUint(mkv.IdFlagDefault, 0)),
+				matroskaTrack(4, mkv.TrackSubtitle, "S_TEXT/UTF8", ebmlString(mkv.IdLanguage, "rus"), ebmlUint(mkv.IdFlagForced, 1)),
+			),
+			want: &MediaInfo{
+				Container: "mkv",
+				Duration:  90,
+				Video:     &Video{Id: 1, Codec: "hevc", Width: 3840, Height: 2160},
+				Audio: []*Track{
+					{Id: 2, Codec: "ac3", Language: "rus", Name: "Dub", Default: true},
+					{Id: 3, Codec: "dts", Language: "eng"},
+				},
+				Subtitles:   []*Track{{Id: 4, Codec: "subrip", Language: "rus", Default: true, Forced: true}},
+				Unsupported: []string{"hevc", "ac3", "dts"},
+			},
+		},
+		{
+			name: "webm",
+			data: matroskaFile("webm",
+				matroskaTrack(1, mkv.TrackVideo, "V_VP9"),
+				matroskaTrack(2, mkv.TrackAudio, "A_OPUS"),
+			),
+			want: &MediaInfo{
+				Container: "webm",
+				Duration:  90,
+				Video:     &Video{Id: 1, Codec: "vp9"},
+				Audio:     []*Track{{Id: 2, Codec: "opus", Language: "eng", Default: true}},
+				Playable:  true,
+			},
+		},
+		{
+			name: "mov",
+			data: bytes.Join([][]byte{
+				box("ftyp", []byte("qt  "), u32(0)),
+				box("mdat", []byte("data")),
+				box("moov",
+					box("mvhd", u32(0, 0, 0, 1000, 90000)),
+					mp4Track(1, "vide", "avc1", "und", 1280, 720),
+					mp4Track(2, "soun", "mp4a", "rus", 0, 0),
+					mp4Track(3, "soun", "ac-3", "", 0, 0),
+					mp4Track(4, "text", "tx3g", "eng", 0, 0),
+				),
+			}, nil),
+			want: &MediaInfo{
+				Container: "mov",
+				Duration:  90,
+				Video:     &Video{Id: 1, Codec: "h264", Width: 1280, Height: 720},
+				Audio: []*Track{
+					{Id: 2, Codec: "aac", Language: "rus", Default: true},
+					{Id: 3, Codec: "ac3", Language: "und"},
+				},
+				Subtitles:   []*Track{{Id: 4, Codec: "tx3g", Language: "eng"}},
+				Playable:    true,
+				Unsupported: []string{"ac3"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Probe(bytes.NewReader(tt.data), int64(len(tt.data)))
+			if err != nil {
+				t.Fatalf("Probe() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Probe() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProbeErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"too short", []byte("ftyp")},
+		{"mp4 without moov", bytes.Join([][]byte{box("ftyp", []byte("isom"), u32(0)), box("mdat", []byte("data"))}, nil)},
+		{"matroska without segment", ebml(mkv.IdEBML, ebmlString(mkv.IdDocType, "matroska"), make([]byte, 8))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if info, err := Probe(bytes.NewReader(tt.data), int64(len(tt.data))); err == nil {
+				t.Errorf("Probe() = %+v, want error", info)
+			}
+		})
+	}
+
+	if _, err := Probe(bytes.NewReader([]byte("RIFF\x00\x00\x00\x00AVI LIST")), 16); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("Probe() error = %v, want %v", err, ErrUnknownFormat)
+	}
+}
+
+func TestProbeTruncated(t *testing.T) {
+	files := map[string][]byte{
+		"matroska": matroskaFile("matroska",
+			matroskaTrack(1, mkv.TrackVideo, "V_MPEG4/ISO/AVC", ebml(mkv.IdVideo, ebmlUint(mkv.IdPixelWidth, 1920))),
+			matroskaTrack(2, mkv.TrackAudio, "A_AAC", ebmlString(mkv.IdLanguage, "rus")),
+		),
+		"mp4": bytes.Join([][]byte{
+			box("ftyp", []byte("isom"), u32(0)),
+			box("moov",
+				box("mvhd", u32(0, 0, 0, 1000, 90000)),
+				mp4Track(1, "vide", "avc1", "und", 1280, 720),
+				mp4Track(2, "soun", "mp4a", "rus", 0, 0),
+			),
+		}, nil),
+	}
+
+	// Заголовки приходят от пиров: обрезанный файл должен давать ошибку, а не панику
+	for name, data := range files {
+		t.Run(name, func(t *testing.T) {
+			for n := 0; n < len(data); n++ {
+				if _, err := Probe(bytes.NewReader(data[:n]), int64(n)); err == nil && n < 12 {
+					t.Errorf("Probe() of %d bytes succeeded", n)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package reader
+
+import (
+	"errors"
+	"io"
+)
+
+// Segment описывает часть "виртуального" файла: либо диапазон оригинального
+// файла, либо данные в памяти.
+type Segment struct {
+	Offset int64  // Смещение в оригинальном файле (если Data == nil).
+	Length int64  // Длина диапазона оригинального файла (если Data == nil).
+	Data   []byte // Данные, подставляемые вместо диапазона оригинала.
+}
+
+func (s Segment) size() int64 {
+	if s.Data != nil {
+		return int64(len(s.Data))
+	}
+	return s.Length
+}
+
+// SegmentReader предоставляет view для io.ReadSeeker, собранный из сегментов.
+// В отличие от ModifiedReader, он позволяет переставлять части файла местами,
+// например переносить атом moov в начало MP4.
+type SegmentReader struct {
+	original    io.ReadSeeker
+	originalPos int64 // Позиция оригинала, чтобы не выполнять лишние Seek.
+
+	segments    []Segment
+	starts      []int64 // Виртуальное смещение начала каждого сегмента.
+	currentPos  int64
+	virtualSize int64
+}
+
+// NewSegmentReader создает SegmentReader из упорядоченного списка сегментов.
+func NewSegmentReader(original io.ReadSeeker, segments []Segment) *SegmentReader {
+	sr := &SegmentReader{
+		original:    original,
+		originalPos: -1,
+		segments:    segments,
+		starts:      make([]int64, len(segments)),
+	}
+
+	for i, s := range segments {
+		sr.starts[i] = sr.virtualSize
+		sr.virtualSize += s.size()
+	}
+
+	return sr
+}
+
+// Seek реализует io.Seeker для перемещения по "виртуальному" файлу.
+func (sr *SegmentReader) Seek(offset int64, whence int) (int64, error) {
+	var newPos int64
+
+	switch whence {
+	case io.SeekStart:
+		newPos = offset
+	case io.SeekCurrent:
+		newPos = sr.currentPos + offset
+	case io.SeekEnd:
+		newPos = sr.virtualSize + offset
+	default:
+		return 0, errors.New("seek: invalid whence")
+	}
+
+	if newPos < 0 {
+		return 0, errors.New("seek: invalid offset")
+	}
+
+	sr.currentPos = newPos
+	return newPos, nil
+}
+
+// Read реализует io.Reader для чтения из "виртуального" файла.
+// Чтение не пересекает границу сегмента, чтобы не блокироваться на
+// данных, которые еще не нужны.
+func (sr *SegmentReader) Read(p []byte) (int, error) {
+	if sr.currentPos >= sr.virtualSize {
+		return 0, io.EOF
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	// Находим сегмент, содержащий текущую позицию.
+	i := len(sr.starts) - 1
+	for i > 0 && sr.starts[i] > sr.currentPos {
+		i--
+	}
+	s := sr.segments[i]
+	inSegment := sr.currentPos - sr.starts[i]
+	chunkSize := min(int64(len(p)), s.size()-inSegment)
+
+	if s.Data != nil {
+		n := copy(p, s.Data[inSegment:inSegment+chunkSize])
+		sr.currentPos += int64(n)
+		return n, nil
+	}
+
+	if pos := s.Offset + inSegment; pos != sr.originalPos {
+		if _, err := sr.original.Seek(pos, io.SeekStart); err != nil {
+			sr.originalPos = -1
+			return 0, err
+		}
+		sr.originalPos = pos
+	}
+
+	n, err := sr.original.Read(p[:chunkSize])
+	sr.currentPos += int64(n)
+	sr.originalPos += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+
+	return n, err
+}
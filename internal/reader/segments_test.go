@@ -0,0 +1,51 @@
+package reader
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestSegmentReader(t *testing.T) {
+	original := strings.NewReader("0123456789")
+	sr := NewSegmentReader(original, []Segment{
+		{Offset: 6, Length: 4},
+		{Data: []byte("ab")},
+		{Offset: 0, Length: 3},
+	})
+
+	all, err := io.ReadAll(sr)
+	if err != nil || string(all) != "6789ab012" {
+		t.Fatalf("ReadAll() = %q, %v", all, err)
+	}
+
+	tests := []struct {
+		offset int64
+		whence int
+		want   string
+	}{
+		{5, io.SeekStart, "b"}, // Чтение не пересекает границу сегмента
+		{-3, io.SeekEnd, "012"},
+		{2, io.SeekStart, "89"},
+	}
+	for _, tt := range tests {
+		if _, err := sr.Seek(tt.offset, tt.whence); err != nil {
+			t.Fatalf("Seek() error = %v", err)
+		}
+		buf := make([]byte, 8)
+		n, err := sr.Read(buf)
+		if err != nil || string(buf[:n]) != tt.want {
+			t.Errorf("Read() after Seek(%d, %d) = %q, %v; want %q", tt.offset, tt.whence, buf[:n], err, tt.want)
+		}
+	}
+
+	if _, err := sr.Seek(-1, io.SeekStart); err == nil {
+		t.Error("Seek() accepted a negative offset")
+	}
+	if _, err := sr.Seek(0, io.SeekEnd); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := sr.Read(make([]byte, 1)); n != 0 || err != io.EOF {
+		t.Errorf("Read() at end = %d, %v; want EOF", n, err)
+	}
+}
@@ -0,0 +1,431 @@
+package remux
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"retreat-backend/internal/mkv"
+	"retreat-backend/internal/mp4"
+)
+
+const (
+	// timescale задает единицу времени дорожек MP4: миллисекунды, как в Matroska
+	timescale = 1000
+	// maxFragmentSize ограничивает объем данных фрагмента, если ключевых кадров долго нет
+	maxFragmentSize = 8 << 20
+	// audioFragment задает длительность фрагмента для файлов без видео
+	audioFragment = time.Second
+)
+
+var (
+	ErrUnsupportedCodec = errors.New("codec is not supported for remuxing")
+	ErrTrackNotFound    = errors.New("track not found")
+)
+
+// Options задает параметры перепаковки
+type Options struct {
+	Audio int           // Номер аудиодорожки среди аудиодорожек файла; -1 выбирает дорожку по умолчанию
+	Start time.Duration // Время, с которого начинается поток
+}
+
+// Remuxer перепаковывает Matroska во фрагментированный MP4 без перекодирования
+type Remuxer struct {
+	demuxer *mkv.Demuxer
+	video   *track
+	audio   *track
+	tracks  map[int]*track
+
+	start    time.Duration
+	skipping bool // Индекса нет: кадры до start пропускаются при чтении
+	sequence uint32
+}
+
+// track хранит состояние дорожки при формировании фрагментов
+type track struct {
+	config  mp4.TrackConfig
+	frames  []*mkv.Frame
+	size    int
+	lastDts int64
+	lastDur int64
+}
+
+// New читает заголовки Matroska, выбирает дорожки и переходит к ближайшей
+// точке индекса перед opts.Start
+func New(r io.ReadSeeker, size int64, opts Options) (*Remuxer, error) {
+	demuxer, err := mkv.NewDemuxer(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	rm := &Remuxer{
+		demuxer: demuxer,
+		tracks:  make(map[int]*track),
+		start:   opts.Start,
+	}
+
+	video, audio, err := selectTracks(demuxer.Tracks, opts.Audio)
+	if err != nil {
+		return nil, err
+	}
+	if rm.video, err = newVideoTrack(video); err != nil {
+		return nil, err
+	}
+	if rm.audio, err = newAudioTrack(audio); err != nil {
+		return nil, err
+	}
+
+	var videoNumber int
+	if video != nil {
+		videoNumber = video.Number
+		rm.tracks[video.Number] = rm.video
+	}
+	if audio != nil {
+		rm.tracks[audio.Number] = rm.audio
+	}
+
+	if opts.Start > 0 {
+		cueTime, ok, err := demuxer.SeekTime(opts.Start, videoNumber)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			rm.start = cueTime
+		} else {
+			rm.skipping = true
+		}
+	}
+
+	return rm, nil
+}
+
+// Start возвращает время исходного файла, с которого начинается поток.
+// Время в потоке отсчитывается от него.
+func (rm *Remuxer) Start() time.Duration {
+	return rm.start
+}
+
+// WriteTo записывает сегмент инициализации и фрагменты до конца файла
+func (rm *Remuxer) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+
+	var configs []mp4.TrackConfig
+	for _, t := range []*track{rm.video, rm.audio} {
+		if t != nil {
+			configs = append(configs, t.config)
+		}
+	}
+
+	duration := max(rm.demuxer.Duration-rm.start, 0)
+	if err := mp4.WriteInit(cw, configs, uint64(duration.Milliseconds()), timescale); err != nil {
+		return cw.n, err
+	}
+
+	for {
+		frame, err := rm.demuxer.ReadFrame()
+		if errors.Is(err, io.EOF) {
+			return cw.n, rm.flush(cw, -1)
+		}
+		if err != nil {
+			return cw.n, err
+		}
+
+		t, ok := rm.tracks[frame.Track]
+		if !ok {
+			continue
+		}
+
+		if rm.skipping {
+			// Без индекса поток начинается с первого ключевого кадра после start
+			if rm.video != nil && t != rm.video {
+				continue
+			}
+			if !frame.Keyframe || frame.Time < rm.start {
+				continue
+			}
+			rm.start = frame.Time
+			rm.skipping = false
+		}
+		if frame.Time < rm.start {
+			continue
+		}
+
+		switch {
+		case t == rm.video && frame.Keyframe && len(t.frames) > 0:
+			err = rm.flush(cw, toTicks(frame.Time-rm.start))
+		case rm.video == nil && len(t.frames) > 0 && frame.Time-t.frames[0].Time >= audioFragment:
+			err = rm.flush(cw, -1)
+		case rm.bufferedSize() > maxFragmentSize:
+			err = rm.flush(cw, -1)
+		}
+		if err != nil {
+			return cw.n, err
+		}
+
+		t.frames = append(t.frames, frame)
+		t.size += len(frame.Data)
+	}
+}
+
+// flush записывает накопленные кадры одним фрагментом.
+// nextVideo задает время следующего видеокадра или -1, если оно неизвестно.
+func (rm *Remuxer) flush(w io.Writer, nextVideo int64) error {
+	var fragments []mp4.TrackFragment
+	for _, t := range []*track{rm.video, rm.audio} {
+		if t == nil || len(t.frames) == 0 {
+			continue
+		}
+
+		next := int64(-1)
+		if t == rm.video {
+			next = nextVideo
+		}
+
+		fragments = append(fragments, t.fragment(rm.start, next))
+		t.frames = t.frames[:0]
+		t.size = 0
+	}
+
+	if len(fragments) == 0 {
+		return nil
+	}
+
+	rm.sequence++
+	return mp4.WriteFragment(w, rm.sequence, fragments)
+}
+
+func (rm *Remuxer) bufferedSize() int {
+	var size int
+	for _, t := range rm.tracks {
+		size += t.size
+	}
+	return size
+}
+
+// fragment формирует фрагмент дорожки. Matroska хранит время отображения в
+// порядке декодирования, поэтому время декодирования восстанавливается
+// сортировкой времен отображения внутри фрагмента.
+func (t *track) fragment(start time.Duration, next int64) mp4.TrackFragment {
+	pts := make([]int64, len(t.frames))
+	for i, f := range t.frames {
+		pts[i] = toTicks(f.Time - start)
+	}
+
+	dts := slices.Clone(pts)
+	slices.Sort(dts)
+	for i := range dts {
+		prev := t.lastDts
+		if i > 0 {
+			prev = dts[i-1]
+		}
+		dts[i] = max(dts[i], prev+1)
+	}
+
+	samples := make([]mp4.Sample, len(t.frames))
+	for i, f := range t.frames {
+		var duration int64
+		switch {
+		case i+1 < len(dts):
+			duration = dts[i+1] - dts[i]
+		case next > dts[i]:
+			duration = next - dts[i]
+		case f.Duration > 0:
+			duration = toTicks(f.Duration)
+		default:
+			duration = t.lastDur
+		}
+		t.lastDur = duration
+
+		samples[i] = mp4.Sample{
+			Duration:          uint32(duration),
+			CompositionOffset: int32(pts[i] - dts[i]),
+			Keyframe:          f.Keyframe || t.config.Handler == "soun",
+			Data:              f.Data,
+		}
+	}
+
+	t.lastDts = dts[len(dts)-1]
+
+	return mp4.TrackFragment{
+		TrackId:  t.config.Id,
+		BaseTime: uint64(max(dts[0], 0)),
+		Samples:  samples,
+	}
+}
+
+// toTicks переводит время в единицы timescale с округлением
+func toTicks(d time.Duration) int64 {
+	return d.Round(time.Second / timescale).Milliseconds()
+}
+
+// selectTracks выбирает первую видеодорожку и аудиодорожку по номеру
+// среди аудиодорожек (или дорожку по умолчанию, если audio < 0)
+func selectTracks(tracks []*mkv.Track, audio int) (*mkv.Track, *mkv.Track, error) {
+	var video *mkv.Track
+	var audioTracks []*mkv.Track
+	for _, t := range tracks {
+		switch t.Type {
+		case mkv.TrackVideo:
+			if video == nil {
+				video = t
+			}
+		case mkv.TrackAudio:
+			audioTracks = append(audioTracks, t)
+		}
+	}
+
+	var selected *mkv.Track
+	if len(audioTracks) > 0 {
+		var err error
+		if selected, err = selectAudio(audioTracks, audio); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if video == nil && selected == nil {
+		return nil, nil, fmt.Errorf("%w: no audio or video", ErrTrackNotFound)
+	}
+
+	return video, selected, nil
+}
+
+func newVideoTrack(t *mkv.Track) (*track, error) {
+	if t == nil {
+		return nil, nil
+	}
+
+	config, err := videoConfig(t)
+	if err != nil {
+		return nil, err
+	}
+
+	return &track{config: config, lastDts: -1}, nil
+}
+
+func newAudioTrack(t *mkv.Track) (*track, error) {
+	if t == nil {
+		return nil, nil
+	}
+
+	config, err := audioConfig(t)
+	if err != nil {
+		return nil, err
+	}
+
+	return &track{config: config, lastDts: -1}, nil
+}
+
+// selectAudio выбирает аудиодорожку по номеру среди аудиодорожек или дорожку по умолчанию
+func selectAudio(tracks []*mkv.Track, index int) (*mkv.Track, error) {
+	if index >= len(tracks) {
+		return nil, fmt.Errorf("%w: audio %d", ErrTrackNotFound, index)
+	}
+	if index >= 0 {
+		return tracks[index], nil
+	}
+
+	for _, t := range tracks {
+		if t.Default {
+			return t, nil
+		}
+	}
+	return tracks[0], nil
+}
+
+func videoConfig(t *mkv.Track) (mp4.TrackConfig, error) {
+	config := mp4.TrackConfig{
+		Id:        1,
+		Handler:   "vide",
+		Timescale: timescale,
+		Language:  "und",
+		Width:     t.Width,
+		Height:    t.Height,
+	}
+
+	if len(t.CodecPrivate) == 0 {
+		return config, fmt.Errorf("%w: %s without codec private data", ErrUnsupportedCodec, t.CodecID)
+	}
+
+	switch t.CodecID {
+	case "V_MPEG4/ISO/AVC":
+		config.SampleEntry = mp4.AVCSampleEntry("avc1", "avcC", t.CodecPrivate, t.Width, t.Height)
+	case "V_MPEGH/ISO/HEVC":
+		config.SampleEntry = mp4.AVCSampleEntry("hvc1", "hvcC", t.CodecPrivate, t.Width, t.Height)
+	default:
+		return config, fmt.Errorf("%w: %s", ErrUnsupportedCodec, t.CodecID)
+	}
+
+	return config, nil
+}
+
+func audioConfig(t *mkv.Track) (mp4.TrackConfig, error) {
+	config := mp4.TrackConfig{
+		Id:        2,
+		Handler:   "soun",
+		Timescale: timescale,
+		Language:  t.Language,
+	}
+
+	rate := int(t.SampleRate)
+	switch {
+	case strings.HasPrefix(t.CodecID, "A_AAC"):
+		asc := t.CodecPrivate
+		if len(asc) == 0 {
+			asc = audioSpecificConfig(t)
+		}
+		config.SampleEntry = mp4.AudioSampleEntry(mp4.ObjectTypeAAC, asc, t.Channels, rate)
+	case t.CodecID == "A_MPEG/L3":
+		config.SampleEntry = mp4.AudioSampleEntry(mp4.ObjectTypeMP3, nil, t.Channels, rate)
+	case t.CodecID == "A_OPUS":
+		entry, err := mp4.OpusSampleEntry(t.CodecPrivate)
+		if err != nil {
+			return config, err
+		}
+		config.SampleEntry = entry
+	default:
+		return config, fmt.Errorf("%w: %s", ErrUnsupportedCodec, t.CodecID)
+	}
+
+	return config, nil
+}
+
+// aacSampleRates содержит частоты дискретизации в порядке их индексов в AudioSpecificConfig
+var aacSampleRates = []int{96000, 88200, 64000, 48000, 44100, 32000, 24000, 22050, 16000, 12000, 11025, 8000, 7350}
+
+// audioSpecificConfig восстанавливает AudioSpecificConfig для старых файлов,
+// где профиль AAC указан в CodecID (A_AAC/MPEG4/LC), а CodecPrivate отсутствует
+func audioSpecificConfig(t *mkv.Track) []byte {
+	objectType := 2
+	switch {
+	case strings.HasSuffix(t.CodecID, "/MAIN"):
+		objectType = 1
+	case strings.HasSuffix(t.CodecID, "/SSR"):
+		objectType = 3
+	case strings.HasSuffix(t.CodecID, "/LTP"):
+		objectType = 4
+	}
+
+	rateIndex := slices.Index(aacSampleRates, int(t.SampleRate))
+	if rateIndex < 0 {
+		rateIndex = 4
+	}
+
+	return []byte{
+		byte(objectType<<3 | rateIndex>>1),
+		byte(rateIndex&1<<7 | t.Channels&0xf<<3),
+	}
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,143 @@
+package remux
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"retreat-backend/internal/mkv"
+	"retreat-backend/internal/mp4"
+)
+
+func frame(ms int, keyframe bool, data string) *mkv.Frame {
+	return &mkv.Frame{Track: 1, Time: time.Duration(ms) * time.Millisecond, Keyframe: keyframe, Data: []byte(data)}
+}
+
+func TestTrackFragment(t *testing.T) {
+	video := &track{config: mp4.TrackConfig{Id: 1, Handler: "vide"}, lastDts: -1}
+
+	// Кадры в порядке декодирования: I P B B, время отображения не возрастает
+	video.frames = []*mkv.Frame{frame(10000, true, "I"), frame(10120, false, "P"), frame(10040, false, "B1"), frame(10080, false, "B2")}
+	got := video.fragment(10*time.Second, 160)
+	want := mp4.TrackFragment{TrackId: 1, BaseTime: 0, Samples: []mp4.Sample{
+		{Duration: 40, CompositionOffset: 0, Keyframe: true, Data: []byte("I")},
+		{Duration: 40, CompositionOffset: 80, Data: []byte("P")},
+		{Duration: 40, CompositionOffset: -40, Data: []byte("B1")},
+		{Duration: 40, CompositionOffset: -40, Data: []byte("B2")},
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("fragment() = %+v, want %+v", got, want)
+	}
+
+	// Следующий фрагмент продолжает время декодирования; длительность последнего
+	// кадра без следующего берется из Matroska, а без нее - от предыдущего кадра
+	last := frame(10200, false, "P2")
+	last.Duration = 50 * time.Millisecond
+	video.frames = []*mkv.Frame{frame(10160, true, "I2"), last}
+	got = video.fragment(10*time.Second, -1)
+	if got.BaseTime != 160 || got.Samples[0].Duration != 40 || got.Samples[1].Duration != 50 {
+		t.Errorf("second fragment = %+v", got)
+	}
+
+	video.frames = []*mkv.Frame{frame(10250, true, "I3")}
+	if got = video.fragment(10*time.Second, -1); got.BaseTime != 250 || got.Samples[0].Duration != 50 {
+		t.Errorf("third fragment = %+v", got)
+	}
+}
+
+func TestSelectTracks(t *testing.T) {
+	video := &mkv.Track{Number: 1, Type: mkv.TrackVideo}
+	eng := &mkv.Track{Number: 2, Type: mkv.TrackAudio, Language: "eng"}
+	rus := &mkv.Track{Number: 3, Type: mkv.TrackAudio, Language: "rus", Default: true}
+	subs := &mkv.Track{Number: 4, Type: mkv.TrackSubtitle}
+	tracks := []*mkv.Track{video, subs, eng, rus}
+
+	tests := []struct {
+		name   string
+		tracks []*mkv.Track
+		audio  int
+		video  *mkv.Track
+		want   *mkv.Track
+		err    error
+	}{
+		{"default audio", tracks, -1, video, rus, nil},
+		{"audio by index", tracks, 0, video, eng, nil},
+		{"audio out of range", tracks, 2, nil, nil, ErrTrackNotFound},
+		{"video only", []*mkv.Track{video, subs}, -1, video, nil, nil},
+		{"no audio or video", []*mkv.Track{subs}, -1, nil, nil, ErrTrackNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, a, err := selectTracks(tt.tracks, tt.audio)
+			if !errors.Is(err, tt.err) || v != tt.video || a != tt.want {
+				t.Errorf("selectTracks() = %v, %v, %v; want %v, %v, %v", v, a, err, tt.video, tt.want, tt.err)
+			}
+		})
+	}
+}
+
+func TestTrackConfigs(t *testing.T) {
+	tests := []struct {
+		name  string
+		track *mkv.Track
+		entry string // Тип записи stsd, пустая строка - кодек не поддерживается
+	}{
+		{"h264", &mkv.Track{Type: mkv.TrackVideo, CodecID: "V_MPEG4/ISO/AVC", CodecPrivate: []byte{1}}, "avc1"},
+		{"hevc", &mkv.Track{Type: mkv.TrackVideo, CodecID: "V_MPEGH/ISO/HEVC", CodecPrivate: []byte{1}}, "hvc1"},
+		{"h264 without private data", &mkv.Track{Type: mkv.TrackVideo, CodecID: "V_MPEG4/ISO/AVC"}, ""},
+		{"vp9", &mkv.Track{Type: mkv.TrackVideo, CodecID: "V_VP9", CodecPrivate: []byte{1}}, ""},
+		{"aac", &mkv.Track{Type: mkv.TrackAudio, CodecID: "A_AAC", CodecPrivate: []byte{0x11, 0x90}}, "mp4a"},
+		{"mp3", &mkv.Track{Type: mkv.TrackAudio, CodecID: "A_MPEG/L3"}, "mp4a"},
+		{"ac3", &mkv.Track{Type: mkv.TrackAudio, CodecID: "A_AC3"}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var config mp4.TrackConfig
+			var err error
+			if tt.track.Type == mkv.TrackVideo {
+				config, err = videoConfig(tt.track)
+			} else {
+				config, err = audioConfig(tt.track)
+			}
+
+			if tt.entry == "" {
+				if !errors.Is(err, ErrUnsupportedCodec) {
+					t.Errorf("error = %v, want %v", err, ErrUnsupportedCodec)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error = %v", err)
+			}
+			if got := string(config.SampleEntry[4:8]); got != tt.entry {
+				t.Errorf("sample entry = %q, want %q", got, tt.entry)
+			}
+		})
+	}
+}
+
+func TestAudioSpecificConfig(t *testing.T) {
+	tests := []struct {
+		codecId    string
+		sampleRate float64
+		channels   int
+		want       []byte
+	}{
+		{"A_AAC/MPEG4/LC", 48000, 2, []byte{0x11, 0x90}},
+		{"A_AAC/MPEG2/MAIN", 44100, 2, []byte{0x0a, 0x10}},
+		{"A_AAC/MPEG4/LC", 12345, 6, []byte{0x12, 0x30}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.codecId, func(t *testing.T) {
+			got := audioSpecificConfig(&mkv.Track{CodecID: tt.codecId, SampleRate: tt.sampleRate, Channels: tt.channels})
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("audioSpecificConfig() = %x, want %x", got, tt.want)
+			}
+		})
+	}
+}
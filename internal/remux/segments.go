@@ -0,0 +1,155 @@
+package remux
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"retreat-backend/internal/hls"
+	"retreat-backend/internal/mkv"
+	"retreat-backend/internal/mp4"
+)
+
+var ErrNoCues = errors.New("file has no cues")
+
+// Segmenter нарезает Matroska на сегменты HLS по индексу Cues.
+// Каждый сегмент собирается из кластеров между соседними точками индекса.
+type Segmenter struct {
+	header   *mkv.Header
+	video    *mkv.Track
+	audio    *mkv.Track
+	configs  []mp4.TrackConfig
+	cues     []mkv.CuePoint
+	segments []hls.Segment
+}
+
+// NewSegmenter читает заголовки и индекс Matroska. audio задает номер
+// аудиодорожки так же, как Options.Audio.
+func NewSegmenter(r io.ReadSeeker, size int64, audio int) (*Segmenter, error) {
+	header, err := mkv.ReadHeader(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Segmenter{header: header}
+	if s.video, s.audio, err = selectTracks(header.Tracks, audio); err != nil {
+		return nil, err
+	}
+
+	video, err := newVideoTrack(s.video)
+	if err != nil {
+		return nil, err
+	}
+	sound, err := newAudioTrack(s.audio)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range []*track{video, sound} {
+		if t != nil {
+			s.configs = append(s.configs, t.config)
+		}
+	}
+
+	cues, err := header.ReadCues(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNoCues, err)
+	}
+
+	main := s.audio
+	if s.video != nil {
+		main = s.video
+	}
+
+	// Сегмент может начинаться только с нового кластера
+	var keyframes []time.Duration
+	for _, cue := range cues {
+		if cue.Track != main.Number {
+			continue
+		}
+		if n := len(s.cues); n > 0 && cue.Cluster <= s.cues[n-1].Cluster {
+			continue
+		}
+		s.cues = append(s.cues, cue)
+		keyframes = append(keyframes, cue.Time)
+	}
+	if len(s.cues) == 0 {
+		return nil, ErrNoCues
+	}
+
+	s.segments = hls.Plan(keyframes, header.Duration)
+
+	return s, nil
+}
+
+func (s *Segmenter) Segments() []hls.Segment {
+	return s.segments
+}
+
+func (s *Segmenter) WriteInit(w io.Writer) error {
+	return mp4.WriteInit(w, s.configs, uint64(s.header.Duration.Milliseconds()), timescale)
+}
+
+func (s *Segmenter) WriteSegment(w io.Writer, r io.ReadSeeker, index int) error {
+	if index < 0 || index >= len(s.segments) {
+		return fmt.Errorf("segment not found: %d", index)
+	}
+
+	start := s.cues[s.segments[index].Keyframe].Cluster
+	end := s.header.SegmentEnd
+	nextVideo := int64(-1)
+	if index+1 < len(s.segments) {
+		next := s.segments[index+1]
+		end = s.cues[next.Keyframe].Cluster
+		nextVideo = toTicks(next.Start)
+	}
+
+	demuxer, err := mkv.OpenDemuxer(r, s.header)
+	if err != nil {
+		return err
+	}
+	if err := demuxer.SeekRange(start, end); err != nil {
+		return err
+	}
+
+	// Дорожки создаются заново, чтобы сегменты не зависели друг от друга
+	tracks := make(map[int]*track)
+	var ordered []*track
+	for _, t := range []*mkv.Track{s.video, s.audio} {
+		if t == nil {
+			continue
+		}
+		state := &track{config: s.configs[len(ordered)], lastDts: -1}
+		tracks[t.Number] = state
+		ordered = append(ordered, state)
+	}
+
+	for {
+		frame, err := demuxer.ReadFrame()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		if t, ok := tracks[frame.Track]; ok {
+			t.frames = append(t.frames, frame)
+		}
+	}
+
+	var fragments []mp4.TrackFragment
+	for _, t := range ordered {
+		if len(t.frames) == 0 {
+			continue
+		}
+
+		next := int64(-1)
+		if t.config.Handler == "vide" {
+			next = nextVideo
+		}
+		fragments = append(fragments, t.fragment(0, next))
+	}
+
+	return mp4.WriteFragment(w, uint32(index+1), fragments)
+}
@@ -0,0 +1,258 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// DefaultTimeout ограничивает ожидание ответа одного источника
+const DefaultTimeout = 15 * time.Second
+
+var ErrNoProviders = errors.New("no search providers configured")
+
+// Query описывает поисковый запрос
+type Query struct {
+	Text     string
+	Category string // Категории Newznab через запятую, например "2000,5000"
+	Limit    int    // Максимальное число результатов, 0 - без ограничения
+}
+
+// Result описывает найденную раздачу
+type Result struct {
+	Title     string    `json:"title"`
+	Providers []string  `json:"providers"`
+	InfoHash  string    `json:"info_hash,omitempty"`
+	Magnet    string    `json:"magnet,omitempty"`
+	Link      string    `json:"link,omitempty"`    // Ссылка на .torrent файл
+	Details   string    `json:"details,omitempty"` // Страница раздачи
+	Size      int64     `json:"size"`
+	Seeders   int       `json:"seeders"`
+	Leechers  int       `json:"leechers"`
+	Published time.Time `json:"published"`
+}
+
+// MagnetURI возвращает магнет-ссылку результата, при необходимости собирая ее по info hash
+func (r *Result) MagnetURI() string {
+	if r.Magnet != "" {
+		return r.Magnet
+	}
+	if r.InfoHash == "" {
+		return ""
+	}
+
+	var hash metainfo.Hash
+	if err := hash.FromHexString(r.InfoHash); err != nil {
+		return ""
+	}
+	return metainfo.Magnet{InfoHash: hash, DisplayName: r.Title}.String()
+}
+
+// Provider - источник результатов поиска
+type Provider interface {
+	Name() string
+	Search(ctx context.Context, query Query) ([]Result, error)
+	// Resolve проверяет, что ссылка выдана источником, и возвращает ее в виде для загрузки
+	Resolve(link string) (string, bool)
+}
+
+// Response содержит объединенные результаты и ошибки отдельных источников
+type Response struct {
+	Results []Result          `json:"results"`
+	Errors  map[string]string `json:"errors,omitempty"`
+}
+
+// Searcher опрашивает источники параллельно и объединяет их результаты
+type Searcher struct {
+	providers []Provider
+	timeout   time.Duration
+}
+
+func NewSearcher(timeout time.Duration, providers ...Provider) *Searcher {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	return &Searcher{
+		providers: providers,
+		timeout:   timeout,
+	}
+}
+
+// Providers возвращает имена подключенных источников
+func (s *Searcher) Providers() []string {
+	names := make([]string, 0, len(s.providers))
+	for _, p := range s.providers {
+		names = append(names, p.Name())
+	}
+	return names
+}
+
+// Resolve находит источник, выдавший ссылку, и возвращает ее в виде для загрузки
+func (s *Searcher) Resolve(link string) (string, bool) {
+	for _, p := range s.providers {
+		if resolved, ok := p.Resolve(link); ok {
+			return resolved, true
+		}
+	}
+	return "", false
+}
+
+// Search отправляет запрос во все источники, объединяет результаты
+// с одинаковым info hash и сортирует их по числу сидов и размеру.
+// Ошибка одного источника не мешает получить результаты остальных.
+func (s *Searcher) Search(ctx context.Context, query Query) (*Response, error) {
+	if len(s.providers) == 0 {
+		return nil, ErrNoProviders
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		results []Result
+		errs    = make(map[string]string)
+	)
+
+	for _, p := range s.providers {
+		wg.Add(1)
+		go func(p Provider) {
+			defer wg.Done()
+
+			found, err := p.Search(ctx, query)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs[p.Name()] = err.Error()
+				return
+			}
+			for _, r := range found {
+				r.Providers = []string{p.Name()}
+				results = append(results, r)
+			}
+		}(p)
+	}
+	wg.Wait()
+
+	if len(errs) == len(s.providers) {
+		messages := make([]string, 0, len(errs))
+		for name, err := range errs {
+			messages = append(messages, name+": "+err)
+		}
+		slices.Sort(messages)
+		return nil, errors.New(strings.Join(messages, "; "))
+	}
+
+	results = Rank(Merge(results))
+	if query.Limit > 0 && len(results) > query.Limit {
+		results = results[:query.Limit]
+	}
+
+	res := &Response{Results: results}
+	if len(errs) > 0 {
+		res.Errors = errs
+	}
+	return res, nil
+}
+
+// Merge объединяет результаты одной раздачи из разных источников. Раздачи
+// сравниваются по info hash, а без него - по ссылке.
+func Merge(results []Result) []Result {
+	merged := make([]Result, 0, len(results))
+	index := make(map[string]int)
+
+	for _, r := range results {
+		r.InfoHash = normalizeHash(r.InfoHash, r.Magnet)
+
+		key := resultKey(r)
+		if key == "" {
+			merged = append(merged, r)
+			continue
+		}
+
+		i, ok := index[key]
+		if !ok {
+			index[key] = len(merged)
+			merged = append(merged, r)
+			continue
+		}
+
+		m := &merged[i]
+		m.Seeders = max(m.Seeders, r.Seeders)
+		m.Leechers = max(m.Leechers, r.Leechers)
+		m.Size = max(m.Size, r.Size)
+		if m.Magnet == "" {
+			m.Magnet = r.Magnet
+		}
+		if m.Link == "" {
+			m.Link = r.Link
+		}
+		if m.Details == "" {
+			m.Details = r.Details
+		}
+		if m.Published.IsZero() {
+			m.Published = r.Published
+		}
+		for _, p := range r.Providers {
+			if !slices.Contains(m.Providers, p) {
+				m.Providers = append(m.Providers, p)
+			}
+		}
+	}
+
+	return merged
+}
+
+// Rank сортирует результаты: больше сидов - выше, при равенстве - больше размер
+func Rank(results []Result) []Result {
+	slices.SortStableFunc(results, func(a, b Result) int {
+		if a.Seeders != b.Seeders {
+			return b.Seeders - a.Seeders
+		}
+		if a.Size != b.Size {
+			if a.Size > b.Size {
+				return -1
+			}
+			return 1
+		}
+		return strings.Compare(a.Title, b.Title)
+	})
+	return results
+}
+
+func resultKey(r Result) string {
+	switch {
+	case r.InfoHash != "":
+		return r.InfoHash
+	case r.Magnet != "":
+		return r.Magnet
+	case r.Link != "":
+		return r.Link
+	}
+	return ""
+}
+
+// normalizeHash приводит info hash к шестнадцатеричному виду в нижнем регистре,
+// при его отсутствии извлекая из магнет-ссылки
+func normalizeHash(hash string, magnet string) string {
+	var h metainfo.Hash
+	if hash != "" && h.FromHexString(hash) == nil {
+		return h.HexString()
+	}
+
+	if magnet != "" {
+		if m, err := metainfo.ParseMagnetUri(magnet); err == nil {
+			return m.InfoHash.HexString()
+		}
+	}
+
+	return ""
+}
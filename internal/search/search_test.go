@@ -0,0 +1,182 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	testHash  = "0123456789abcdef0123456789abcdef01234567"
+	otherHash = "89abcdef0123456789abcdef0123456789abcdef"
+)
+
+func titles(results []Result) []string {
+	names := make([]string, 0, len(results))
+	for _, r := range results {
+		names = append(names, r.Title)
+	}
+	return names
+}
+
+func TestMerge(t *testing.T) {
+	published := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		results []Result
+		want    []Result
+	}{
+		{
+			name: "same hash in different case",
+			results: []Result{
+				{Title: "A", Providers: []string{"one"}, InfoHash: strings.ToUpper(testHash), Seeders: 5, Size: 100},
+				{Title: "A (copy)", Providers: []string{"two"}, InfoHash: testHash, Seeders: 9, Leechers: 3, Link: "http://two/a.torrent", Published: published},
+			},
+			want: []Result{
+				{Title: "A", Providers: []string{"one", "two"}, InfoHash: testHash, Seeders: 9, Leechers: 3, Size: 100, Link: "http://two/a.torrent", Published: published},
+			},
+		},
+		{
+			name: "hash from magnet",
+			results: []Result{
+				{Title: "A", Providers: []string{"one"}, InfoHash: testHash},
+				{Title: "A", Providers: []string{"two"}, Magnet: "magnet:?xt=urn:btih:" + testHash},
+			},
+			want: []Result{
+				{Title: "A", Providers: []string{"one", "two"}, InfoHash: testHash, Magnet: "magnet:?xt=urn:btih:" + testHash},
+			},
+		},
+		{
+			name: "same link without hash",
+			results: []Result{
+				{Title: "A", Providers: []string{"one"}, Link: "http://tracker/1.torrent"},
+				{Title: "A", Providers: []string{"one"}, Link: "http://tracker/1.torrent", Details: "http://tracker/1"},
+			},
+			want: []Result{
+				{Title: "A", Providers: []string{"one"}, Link: "http://tracker/1.torrent", Details: "http://tracker/1"},
+			},
+		},
+		{
+			name: "different releases",
+			results: []Result{
+				{Title: "A", InfoHash: testHash},
+				{Title: "B", InfoHash: otherHash},
+				{Title: "C"},
+				{Title: "D"},
+			},
+			want: []Result{
+				{Title: "A", InfoHash: testHash},
+				{Title: "B", InfoHash: otherHash},
+				{Title: "C"},
+				{Title: "D"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Merge(tt.results); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Merge() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRank(t *testing.T) {
+	results := []Result{
+		{Title: "small", Seeders: 10, Size: 1},
+		{Title: "dead", Seeders: 0, Size: 100},
+		{Title: "popular", Seeders: 50, Size: 1},
+		{Title: "large", Seeders: 10, Size: 5},
+		{Title: "b", Seeders: 10, Size: 1},
+	}
+
+	want := []string{"popular", "large", "b", "small", "dead"}
+	if got := titles(Rank(results)); !reflect.DeepEqual(got, want) {
+		t.Errorf("Rank() = %v, want %v", got, want)
+	}
+}
+
+func TestMagnetURI(t *testing.T) {
+	tests := []struct {
+		name   string
+		result Result
+		want   string
+	}{
+		{"magnet", Result{Magnet: "magnet:?xt=urn:btih:" + testHash, InfoHash: otherHash}, "magnet:?xt=urn:btih:" + testHash},
+		{"from hash", Result{Title: "Movie", InfoHash: testHash}, "magnet:?xt=urn:btih:" + testHash + "&dn=Movie"},
+		{"invalid hash", Result{InfoHash: "zz"}, ""},
+		{"no hash", Result{Link: "http://tracker/1.torrent"}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.result.MagnetURI(); got != tt.want {
+				t.Errorf("MagnetURI() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// fakeProvider возвращает заданные результаты или ошибку
+type fakeProvider struct {
+	name    string
+	results []Result
+	err     error
+	prefix  string // Префикс ссылок, которые источник признает своими
+}
+
+func (p *fakeProvider) Name() string {
+	return p.name
+}
+
+func (p *fakeProvider) Search(ctx context.Context, query Query) ([]Result, error) {
+	return p.results, p.err
+}
+
+func (p *fakeProvider) Resolve(link string) (string, bool) {
+	if p.prefix == "" || !strings.HasPrefix(link, p.prefix) {
+		return "", false
+	}
+	return link + "&key=" + p.name, true
+}
+
+func TestSearcher(t *testing.T) {
+	one := &fakeProvider{name: "one", prefix: "http://one/", results: []Result{
+		{Title: "A", InfoHash: testHash, Seeders: 1},
+		{Title: "B", InfoHash: otherHash, Seeders: 3},
+	}}
+	two := &fakeProvider{name: "two", results: []Result{{Title: "A", InfoHash: testHash, Seeders: 7}}}
+	broken := &fakeProvider{name: "broken", err: errors.New("unavailable")}
+
+	res, err := NewSearcher(time.Second, one, two, broken).Search(context.Background(), Query{Text: "a", Limit: 1})
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+	if len(res.Results) != 1 || res.Results[0].Seeders != 7 || !reflect.DeepEqual(res.Results[0].Providers, []string{"one", "two"}) &&
+		!reflect.DeepEqual(res.Results[0].Providers, []string{"two", "one"}) {
+		t.Errorf("results = %+v, want merged A from both providers", res.Results)
+	}
+	if res.Errors["broken"] != "unavailable" {
+		t.Errorf("errors = %v", res.Errors)
+	}
+
+	if _, err := NewSearcher(time.Second, broken).Search(context.Background(), Query{Text: "a"}); err == nil {
+		t.Error("Search() succeeded when every provider failed")
+	}
+	if _, err := NewSearcher(time.Second).Search(context.Background(), Query{Text: "a"}); !errors.Is(err, ErrNoProviders) {
+		t.Errorf("Search() error = %v, want %v", err, ErrNoProviders)
+	}
+
+	searcher := NewSearcher(time.Second, two, one)
+	if link, ok := searcher.Resolve("http://one/dl?id=1"); !ok || link != "http://one/dl?id=1&key=one" {
+		t.Errorf("Resolve() = %q, %v", link, ok)
+	}
+	if _, ok := searcher.Resolve("http://internal/admin"); ok {
+		t.Error("Resolve() accepted a link of no provider")
+	}
+}
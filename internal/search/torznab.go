@@ -0,0 +1,243 @@
+package search
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxTorznabResponse ограничивает размер ответа индексатора
+const maxTorznabResponse = 8 << 20
+
+// TorznabConfig описывает индексатор Torznab, например Jackett или Prowlarr
+type TorznabConfig struct {
+	Name   string `json:"name"`
+	URL    string `json:"url"` // Адрес API, например http://jackett:9117/api/v2.0/indexers/all/results/torznab/api
+	ApiKey string `json:"api_key"`
+}
+
+// Torznab ищет раздачи через API Torznab
+type Torznab struct {
+	name   string
+	url    string
+	apiKey string
+	client *http.Client
+}
+
+func NewTorznab(config TorznabConfig) *Torznab {
+	name := config.Name
+	if name == "" {
+		if u, err := url.Parse(config.URL); err == nil && u.Host != "" {
+			name = u.Host
+		} else {
+			name = "torznab"
+		}
+	}
+
+	return &Torznab{
+		name:   name,
+		url:    config.URL,
+		apiKey: config.ApiKey,
+		client: &http.Client{},
+	}
+}
+
+func (t *Torznab) Name() string {
+	return t.name
+}
+
+type torznabFeed struct {
+	XMLName xml.Name
+	Items   []torznabItem `xml:"channel>item"`
+
+	// Ошибка возвращается корневым элементом <error code="..." description="..."/>
+	Code        string `xml:"code,attr"`
+	Description string `xml:"description,attr"`
+}
+
+type torznabItem struct {
+	Title     string `xml:"title"`
+	Link      string `xml:"link"`
+	Comments  string `xml:"comments"`
+	PubDate   string `xml:"pubDate"`
+	Size      int64  `xml:"size"`
+	Enclosure struct {
+		URL    string `xml:"url,attr"`
+		Length int64  `xml:"length,attr"`
+	} `xml:"enclosure"`
+	Attrs []struct {
+		Name  string `xml:"name,attr"`
+		Value string `xml:"value,attr"`
+	} `xml:"attr"` // torznab:attr и newznab:attr
+}
+
+func (t *Torznab) Search(ctx context.Context, query Query) ([]Result, error) {
+	u, err := url.Parse(t.url)
+	if err != nil {
+		return nil, err
+	}
+
+	params := u.Query()
+	params.Set("t", "search")
+	params.Set("q", query.Text)
+	if t.apiKey != "" {
+		params.Set("apikey", t.apiKey)
+	}
+	if query.Category != "" {
+		params.Set("cat", query.Category)
+	}
+	if query.Limit > 0 {
+		params.Set("limit", strconv.Itoa(query.Limit))
+	}
+	u.RawQuery = params.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		// Адрес в ошибке содержит ключ API
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return nil, fmt.Errorf("torznab request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("torznab returned %s", resp.Status)
+	}
+
+	var feed torznabFeed
+	if err := xml.NewDecoder(io.LimitReader(resp.Body, maxTorznabResponse)).Decode(&feed); err != nil {
+		return nil, fmt.Errorf("invalid torznab response: %w", err)
+	}
+	if feed.XMLName.Local == "error" {
+		return nil, fmt.Errorf("torznab error %s: %s", feed.Code, feed.Description)
+	}
+
+	results := make([]Result, 0, len(feed.Items))
+	for _, item := range feed.Items {
+		r := item.result()
+		r.Link = t.hideKey(r.Link)
+		r.Details = t.hideKey(r.Details)
+		results = append(results, r)
+	}
+
+	return results, nil
+}
+
+// hideKey убирает ключ API из ссылки индексатора, оставляя пустой параметр,
+// который Resolve заполняет перед загрузкой. Ссылка, в которой ключ остается
+// в другой части адреса, отбрасывается.
+func (t *Torznab) hideKey(link string) string {
+	if t.apiKey == "" || !strings.Contains(link, t.apiKey) {
+		return link
+	}
+
+	u, err := url.Parse(link)
+	if err != nil {
+		return ""
+	}
+
+	params := u.Query()
+	for name, values := range params {
+		if slices.Contains(values, t.apiKey) {
+			params.Set(name, "")
+		}
+	}
+	u.RawQuery = params.Encode()
+
+	link = u.String()
+	if strings.Contains(link, t.apiKey) {
+		return ""
+	}
+	return link
+}
+
+// Resolve принимает только ссылки на адрес индексатора и возвращает в них ключ API
+func (t *Torznab) Resolve(link string) (string, bool) {
+	base, err := url.Parse(t.url)
+	if err != nil {
+		return "", false
+	}
+	u, err := url.Parse(link)
+	if err != nil || u.Scheme != base.Scheme || !strings.EqualFold(u.Host, base.Host) {
+		return "", false
+	}
+
+	if t.apiKey != "" {
+		params := u.Query()
+		for name, values := range params {
+			if strings.Contains(strings.ToLower(name), "apikey") && slices.Equal(values, []string{""}) {
+				params.Set(name, t.apiKey)
+			}
+		}
+		u.RawQuery = params.Encode()
+	}
+
+	return u.String(), true
+}
+
+func (item *torznabItem) result() Result {
+	r := Result{
+		Title:   strings.TrimSpace(item.Title),
+		Details: item.Comments,
+		Size:    item.Size,
+	}
+	if r.Size == 0 {
+		r.Size = item.Enclosure.Length
+	}
+	for _, layout := range []string{time.RFC1123Z, time.RFC1123} {
+		if published, err := time.Parse(layout, item.PubDate); err == nil {
+			r.Published = published
+			break
+		}
+	}
+
+	for _, link := range []string{item.Link, item.Enclosure.URL} {
+		switch {
+		case strings.HasPrefix(link, "magnet:"):
+			r.Magnet = link
+		case link != "" && r.Link == "":
+			r.Link = link
+		}
+	}
+
+	peers := -1
+	for _, attr := range item.Attrs {
+		switch attr.Name {
+		case "seeders":
+			r.Seeders, _ = strconv.Atoi(attr.Value)
+		case "peers":
+			peers, _ = strconv.Atoi(attr.Value)
+		case "leechers":
+			r.Leechers, _ = strconv.Atoi(attr.Value)
+		case "infohash":
+			r.InfoHash = attr.Value
+		case "magneturl":
+			r.Magnet = attr.Value
+		case "size":
+			if r.Size == 0 {
+				r.Size, _ = strconv.ParseInt(attr.Value, 10, 64)
+			}
+		}
+	}
+	// В Torznab peers - это сиды вместе с личерами
+	if r.Leechers == 0 && peers > r.Seeders {
+		r.Leechers = peers - r.Seeders
+	}
+
+	return r
+}
@@ -0,0 +1,181 @@
+package search
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testApiKey = "secret-key"
+
+// torznabStandIn отвечает как индексатор Torznab и проверяет параметры запроса
+func torznabStandIn(t *testing.T, body string) *httptest.Server {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		params := r.URL.Query()
+		if params.Get("apikey") != testApiKey {
+			w.Write([]byte(`<error code="100" description="Invalid API Key"/>`))
+			return
+		}
+		if params.Get("t") != "search" || params.Get("q") != "movie" || params.Get("cat") != "2000" || params.Get("limit") != "10" {
+			t.Errorf("unexpected query %s", r.URL.RawQuery)
+		}
+
+		w.Header().Set("Content-Type", "application/rss+xml")
+		w.Write([]byte(strings.ReplaceAll(body, "{server}", "http://"+r.Host)))
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+const torznabResponse = `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0" xmlns:torznab="http://torznab.com/schemas/2015/feed">
+<channel>
+  <item>
+    <title> Movie 2024 1080p </title>
+    <link>{server}/dl/indexer/?jackett_apikey=secret-key&amp;path=abc</link>
+    <comments>https://tracker.example/details/1</comments>
+    <pubDate>Wed, 01 May 2024 12:00:00 +0000</pubDate>
+    <size>2147483648</size>
+    <enclosure url="{server}/dl/indexer/?jackett_apikey=secret-key&amp;path=abc" length="2147483648" type="application/x-bittorrent"/>
+    <torznab:attr name="seeders" value="12"/>
+    <torznab:attr name="peers" value="20"/>
+    <torznab:attr name="infohash" value="0123456789ABCDEF0123456789ABCDEF01234567"/>
+  </item>
+  <item>
+    <title>Movie 2024 720p</title>
+    <link>magnet:?xt=urn:btih:89abcdef0123456789abcdef0123456789abcdef</link>
+    <torznab:attr name="size" value="1024"/>
+    <torznab:attr name="seeders" value="3"/>
+    <torznab:attr name="leechers" value="1"/>
+  </item>
+</channel>
+</rss>`
+
+func TestTorznabSearch(t *testing.T) {
+	srv := torznabStandIn(t, torznabResponse)
+	torznab := NewTorznab(TorznabConfig{URL: srv.URL + "/api", ApiKey: testApiKey})
+
+	results, err := torznab.Search(context.Background(), Query{Text: "movie", Category: "2000", Limit: 10})
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("results = %d, want 2", len(results))
+	}
+
+	first := results[0]
+	if first.Title != "Movie 2024 1080p" || first.Size != 2<<30 || first.Seeders != 12 || first.Leechers != 8 {
+		t.Errorf("first result = %+v", first)
+	}
+	if !first.Published.Equal(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("published = %s", first.Published)
+	}
+	if strings.Contains(first.Link, testApiKey) {
+		t.Errorf("link %q exposes the API key", first.Link)
+	}
+	if first.Details != "https://tracker.example/details/1" {
+		t.Errorf("details = %q", first.Details)
+	}
+
+	second := results[1]
+	if second.Magnet == "" || second.Link != "" || second.Size != 1024 || second.Leechers != 1 {
+		t.Errorf("second result = %+v", second)
+	}
+
+	// Ссылка из результата загружается с ключом, возвращенным Resolve
+	link, ok := torznab.Resolve(first.Link)
+	if !ok {
+		t.Fatalf("Resolve(%q) rejected the indexer link", first.Link)
+	}
+	u, _ := url.Parse(link)
+	if u.Query().Get("jackett_apikey") != testApiKey || u.Query().Get("path") != "abc" {
+		t.Errorf("resolved link = %q", link)
+	}
+}
+
+func TestTorznabErrors(t *testing.T) {
+	srv := torznabStandIn(t, torznabResponse)
+	missing := httptest.NewServer(http.NotFoundHandler())
+	defer missing.Close()
+	garbage := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<html><body>login</html>"))
+	}))
+	defer garbage.Close()
+
+	tests := []struct {
+		name   string
+		config TorznabConfig
+		want   string // Пустая строка - подходит любая ошибка
+	}{
+		{"invalid key", TorznabConfig{URL: srv.URL + "/api", ApiKey: "wrong"}, "torznab error 100: Invalid API Key"},
+		{"not found", TorznabConfig{URL: missing.URL, ApiKey: testApiKey}, "torznab returned 404 Not Found"},
+		{"invalid response", TorznabConfig{URL: garbage.URL, ApiKey: testApiKey}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewTorznab(tt.config).Search(context.Background(), Query{Text: "movie", Category: "2000", Limit: 10})
+			if err == nil || (tt.want != "" && err.Error() != tt.want) {
+				t.Errorf("Search() error = %v, want %q", err, tt.want)
+			}
+			if err != nil && strings.Contains(err.Error(), testApiKey) {
+				t.Errorf("error %q exposes the API key", err)
+			}
+		})
+	}
+}
+
+func TestTorznabResolve(t *testing.T) {
+	torznab := NewTorznab(TorznabConfig{URL: "http://jackett:9117/api/v2.0/indexers/all/results/torznab/api", ApiKey: testApiKey})
+
+	tests := []struct {
+		name string
+		link string
+		want string // Пустая строка - ссылка отклоняется
+	}{
+		{"hidden key", "http://jackett:9117/dl/rutracker/?jackett_apikey=&path=abc", "http://jackett:9117/dl/rutracker/?jackett_apikey=" + testApiKey + "&path=abc"},
+		{"no key", "http://JACKETT:9117/dl/rutracker/?path=abc", "http://JACKETT:9117/dl/rutracker/?path=abc"},
+		{"other host", "http://127.0.0.1:27017/?apikey=", ""},
+		{"other port", "http://jackett:8080/dl/?apikey=", ""},
+		{"other scheme", "https://jackett:9117/dl/?apikey=", ""},
+		{"not a url", "::", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := torznab.Resolve(tt.link)
+			if ok != (tt.want != "") || got != tt.want {
+				t.Errorf("Resolve() = %q, %v; want %q", got, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestTorznabHideKey(t *testing.T) {
+	torznab := NewTorznab(TorznabConfig{URL: "http://prowlarr:9696/1/api", ApiKey: testApiKey})
+
+	tests := []struct {
+		name string
+		link string
+		want string
+	}{
+		{"query key", "http://prowlarr:9696/1/download?apikey=" + testApiKey + "&link=xyz", "http://prowlarr:9696/1/download?apikey=&link=xyz"},
+		{"no key", "https://tracker.example/details/1", "https://tracker.example/details/1"},
+		{"key in path", "http://prowlarr:9696/" + testApiKey + "/download", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := torznab.hideKey(tt.link); got != tt.want {
+				t.Errorf("hideKey() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
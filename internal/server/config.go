@@ -7,31 +7,55 @@ import (
 	"os"
 	"path/filepath"
 	"retreat-backend/internal/database"
+	"retreat-backend/internal/search"
+	"retreat-backend/internal/torrent"
+	"retreat-backend/internal/transcode"
 	"retreat-backend/internal/utils"
 )
 
 type Config struct {
-	Port          int                   `json:"port"`
-	Filetypes     []string              `json:"filetypes"`
-	Playback      []string              `json:"playback"`
-	DownloadPath  string                `json:"downloadpath"`
-	JWTSecret     string                `json:"jwt_secret"`
-	UsersFile     string                `json:"users_file"`
-	TokenTTLHours int                   `json:"token_ttl_hours"`
-	mongoConfig   *database.MongoConfig `json:"mongoConfig"`
-	file          string
+	Port              int                      `json:"port"`
+	Filetypes         []string                 `json:"filetypes"`
+	SubtitleTypes     []string                 `json:"subtitletypes"`
+	Playback          []string                 `json:"playback"`
+	PlaybackSocket    string                   `json:"playback_socket"`
+	Transcoder        []string                 `json:"transcoder"`
+	TranscodeProfiles map[string][]string      `json:"transcode_profiles"`
+	TranscodeJobs     int                      `json:"transcode_jobs"`
+	DownloadPath      string                   `json:"downloadpath"`
+	CacheQuota        int64                    `json:"cache_quota"`
+	MetadataTimeout   int                      `json:"metadata_timeout"`
+	DownloadRateLimit int64                    `json:"download_rate_limit"`
+	UploadRateLimit   int64                    `json:"upload_rate_limit"`
+	UserLimits        map[string]UserLimits    `json:"user_limits"`
+	Admins            []string                 `json:"admins"`
+	SeedPolicy        torrent.SeedPolicy       `json:"seed_policy"`
+	Torznab           []search.TorznabConfig   `json:"torznab"`
+	SearchTimeout     int                      `json:"search_timeout"`
+	Trackers          map[string]TrackerConfig `json:"trackers"` // Cookies и заголовки для загрузки .torrent по домену
+	JWTSecret         string                   `json:"jwt_secret"`
+	UsersFile         string                   `json:"users_file"`
+	TokenTTLHours     int                      `json:"token_ttl_hours"`
+	mongoConfig       *database.MongoConfig    // Не сохраняется в config.json вместе с паролем
+	file              string
 }
 
 func LoadConfig() (*Config, error) {
 	config := Config{
-		Port:          8000,
-		Filetypes:     []string{".mkv", ".mp4", ".avi"},
-		Playback:      []string{"mpv", "--no-terminal", "--force-window", "--ytdl-format=best"},
-		DownloadPath:  filepath.Join("downloads"),
-		JWTSecret:     "SecretKey",
-		UsersFile:     filepath.Join("data/users.json"),
-		TokenTTLHours: 24,
-		file:          filepath.Join("data/config.json"),
+		Port:            8000,
+		Filetypes:       []string{".mkv", ".mp4", ".avi"},
+		SubtitleTypes:   []string{".srt", ".ass", ".ssa", ".vtt"},
+		Playback:        []string{"mpv", "--no-terminal", "--force-window", "--ytdl-format=best"},
+		PlaybackSocket:  filepath.Join(os.TempDir(), "retreat-mpv.sock"),
+		Transcoder:      transcode.DefaultCommand,
+		TranscodeJobs:   2,
+		DownloadPath:    filepath.Join("downloads"),
+		JWTSecret:       "SecretKey",
+		UsersFile:       filepath.Join("data/users.json"),
+		TokenTTLHours:   24,
+		MetadataTimeout: 120,
+		SearchTimeout:   15,
+		file:            filepath.Join("data/config.json"),
 		mongoConfig: &database.MongoConfig{
 			Host:     "localhost",
 			Port:     27017,
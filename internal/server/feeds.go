@@ -0,0 +1,157 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"retreat-backend/internal/database"
+	"retreat-backend/internal/feed"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// feedPollInterval задает период поиска лент, которые пора проверить
+	feedPollInterval = time.Minute
+	// feedQueue задает размер очереди внеочередных проверок
+	feedQueue = 16
+	// feedAttempts ограничивает число попыток добавить раздачу из ленты
+	feedAttempts = 5
+)
+
+// runFeeds проверяет ленты по расписанию и по запросу, по одной за раз
+func (server *Server) runFeeds() {
+	ticker := time.NewTicker(feedPollInterval)
+	defer ticker.Stop()
+
+	server.checkDueFeeds()
+	for {
+		select {
+		case f := <-server.feedChecks:
+			server.checkFeed(f)
+		case <-ticker.C:
+			server.checkDueFeeds()
+		}
+	}
+}
+
+// scheduleFeed ставит ленту в очередь на внеочередную проверку
+func (server *Server) scheduleFeed(f *database.Feed) {
+	select {
+	case server.feedChecks <- f:
+	default:
+		// Очередь полна, лента будет проверена по расписанию
+	}
+}
+
+func (server *Server) checkDueFeeds() {
+	feeds, err := server.feedStore.GetAllFeeds()
+	if err != nil {
+		log.Printf("Failed to load feeds: %v", err)
+		return
+	}
+
+	for _, f := range feeds {
+		if time.Since(f.CheckedAt) >= time.Duration(f.Interval)*time.Minute {
+			server.checkFeed(f)
+		}
+	}
+}
+
+// checkFeed загружает ленту и добавляет в библиотеку владельца новые раздачи,
+// подходящие под правила. Каждая серия добавляется один раз, даже если
+// лента содержит ее в нескольких вариантах качества.
+func (server *Server) checkFeed(f *database.Feed) {
+	checkedAt := time.Now()
+
+	err := server.processFeed(f)
+	message := ""
+	if err != nil {
+		message = err.Error()
+		log.Printf("Failed to check feed %s: %v", f.ID.Hex(), err)
+	}
+
+	if err := server.feedStore.SetFeedChecked(f.ID, checkedAt, message); err != nil {
+		log.Printf("Failed to save feed %s state: %v", f.ID.Hex(), err)
+	}
+}
+
+func (server *Server) processFeed(f *database.Feed) error {
+	rules, err := feed.CompileRules(f.Include, f.Exclude)
+	if err != nil {
+		return err
+	}
+
+	// Лента загружается как ссылка пользователя: с cookies трекера и только с публичных адресов
+	client, req, err := server.linkRequest(context.Background(), f.URL)
+	if err != nil {
+		return err
+	}
+	items, err := feed.Fetch(client, req)
+	if err != nil {
+		return linkError(err)
+	}
+
+	// Ленты перечисляют раздачи от новых к старым, а добавлять нужно первую вышедшую
+	for i := len(items) - 1; i >= 0; i-- {
+		item := items[i]
+		if !rules.Match(item.Title) || server.feedStore.HasMatch(f.ID, item.Key(), feedAttempts) {
+			continue
+		}
+
+		match := &database.FeedMatch{
+			FeedId:    f.ID,
+			OwnerId:   f.OwnerId,
+			GUID:      item.Key(),
+			Title:     item.Title,
+			Episode:   feed.Episode(item.Title),
+			Status:    database.MatchAdded,
+			MatchedAt: time.Now(),
+		}
+
+		if match.Episode != "" && server.feedStore.HasEpisode(f.ID, match.Episode) {
+			match.Status = database.MatchDuplicate
+		} else {
+			match.Hash, err = server.addFeedItem(f.OwnerId, item)
+			switch {
+			case errors.Is(err, database.ErrTorrentExists):
+				match.Status = database.MatchDuplicate
+			case err != nil:
+				match.Status = database.MatchFailed
+				match.Error = err.Error()
+			}
+		}
+
+		if err := server.feedStore.SaveMatch(match); err != nil {
+			log.Printf("Failed to save feed match: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// addFeedItem добавляет раздачу из ленты тем же путем, что и /api/magnet
+func (server *Server) addFeedItem(ownerId primitive.ObjectID, item feed.Item) (string, error) {
+	if item.Magnet != "" {
+		job, err := server.addMagnet(ownerId, item.Magnet, nil)
+		if err != nil {
+			return "", err
+		}
+		return job.Hash, nil
+	}
+
+	if !isHTTPURL(item.Link) {
+		return "", errors.New("item has no torrent link")
+	}
+
+	info, job, err := server.addURL(context.Background(), ownerId, item.Link, nil)
+	switch {
+	case err != nil:
+		return "", err
+	case job != nil:
+		return job.Hash, nil
+	}
+	return info.Id, nil
+}
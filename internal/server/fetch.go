@@ -0,0 +1,239 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"path"
+	"strings"
+	"syscall"
+	"time"
+
+	"retreat-backend/internal/torrent"
+
+	"github.com/anacrolix/torrent/metainfo"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// maxTorrentFileSize ограничивает размер .torrent файла, загружаемого по ссылке
+	maxTorrentFileSize = 10 << 20
+	// fetchTimeout ограничивает загрузку .torrent файла по ссылке
+	fetchTimeout = 30 * time.Second
+	// maxRedirects ограничивает число перенаправлений при загрузке
+	maxRedirects = 10
+
+	userAgent = "Retreat"
+)
+
+var (
+	errTorrentTooLarge = errors.New("torrent file is too large")
+	errNotTorrent      = errors.New("response is not a torrent file")
+	errPrivateAddress  = errors.New("link points to a private address")
+)
+
+// TrackerConfig содержит cookies и заголовки, которые передаются при загрузке
+// .torrent файлов с домена трекера и его поддоменов
+type TrackerConfig struct {
+	Cookies map[string]string `json:"cookies"`
+	Headers map[string]string `json:"headers"`
+}
+
+// fetchedTorrent содержит .torrent файл или магнет-ссылку, на которую перенаправила ссылка
+type fetchedTorrent struct {
+	Name   string
+	Data   []byte
+	Magnet string
+}
+
+// isHTTPURL сообщает, является ли строка http(s) ссылкой
+func isHTTPURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// addURL добавляет торрент по http(s) ссылке тем же путем, что и .torrent файл.
+// Если ссылка перенаправляет на магнет-ссылку, возвращается задача загрузки метаданных.
+func (server *Server) addURL(ctx context.Context, ownerId primitive.ObjectID, link string, files []string) (*torrent.TorrentInfo, *torrent.Job, error) {
+	fetched, err := server.fetchTorrent(ctx, link)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if fetched.Magnet != "" {
+		job, err := server.addMagnet(ownerId, fetched.Magnet, files)
+		return nil, job, err
+	}
+
+	info, err := server.addTorrentFile(ownerId, fetched.Name, fetched.Data, files)
+	return info, nil, err
+}
+
+// fetchTorrent загружает .torrent файл по http(s) ссылке с ограничением
+// размера и времени и проверяет, что ответ содержит метаданные торрента.
+// Ссылки подключенных индексаторов загружаются с ключом API, остальные -
+// только с публичных адресов.
+func (server *Server) fetchTorrent(ctx context.Context, link string) (*fetchedTorrent, error) {
+	ctx, cancel := context.WithTimeout(ctx, fetchTimeout)
+	defer cancel()
+
+	client, req, err := server.linkRequest(ctx, link)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("torrent download failed: %w", linkError(err))
+	}
+	defer resp.Body.Close()
+
+	if location := resp.Header.Get("Location"); strings.HasPrefix(location, "magnet:") {
+		return &fetchedTorrent{Magnet: location}, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("torrent download returned %s", resp.Status)
+	}
+
+	// Трекеры отдают страницу входа вместо файла, если cookies устарели
+	contentType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if contentType == "text/html" {
+		return nil, fmt.Errorf("%w: %s", errNotTorrent, contentType)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxTorrentFileSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxTorrentFileSize {
+		return nil, errTorrentTooLarge
+	}
+
+	mi, err := metainfo.Load(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errNotTorrent, err)
+	}
+	info, err := mi.UnmarshalInfo()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errNotTorrent, err)
+	}
+
+	return &fetchedTorrent{Name: torrentFileName(resp, info.BestName()), Data: data}, nil
+}
+
+// linkRequest готовит запрос по ссылке пользователя. Ссылки подключенных
+// индексаторов загружаются с ключом API, остальные - только с публичных адресов.
+// Cookies и заголовки трекера передаются в запросе и после перенаправлений
+// на его домен. Перенаправление на магнет-ссылку возвращается как ответ.
+func (server *Server) linkRequest(ctx context.Context, link string) (*http.Client, *http.Request, error) {
+	base := server.linkClient
+	if resolved, ok := server.searcher.Resolve(link); ok {
+		link, base = resolved, server.httpClient
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	server.applyTracker(req)
+
+	client := *base
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if req.URL.Scheme == "magnet" {
+			return http.ErrUseLastResponse
+		}
+		if len(via) >= maxRedirects {
+			return errors.New("too many redirects")
+		}
+		// Cookies и заголовки одного трекера не должны уходить на другой домен
+		req.Header = http.Header{"User-Agent": {userAgent}}
+		server.applyTracker(req)
+		return nil
+	}
+
+	return &client, req, nil
+}
+
+// linkError убирает из ошибки запроса адрес: он может содержать ключ API индексатора
+func linkError(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return urlErr.Err
+	}
+	return err
+}
+
+// publicTransport возвращает транспорт, который не подключается к локальным
+// и внутренним адресам, в том числе после перенаправления
+func publicTransport() *http.Transport {
+	dialer := &net.Dialer{
+		Timeout: fetchTimeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+
+			ip, err := netip.ParseAddr(host)
+			if err != nil {
+				return err
+			}
+			if !isPublicAddr(ip.Unmap()) {
+				return fmt.Errorf("%w: %s", errPrivateAddress, ip)
+			}
+			return nil
+		},
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return transport
+}
+
+// isPublicAddr сообщает, что адрес доступен из интернета
+func isPublicAddr(ip netip.Addr) bool {
+	return ip.IsGlobalUnicast() && !ip.IsPrivate() && !ip.IsLoopback() && !ip.IsLinkLocalUnicast()
+}
+
+// applyTracker добавляет к запросу cookies и заголовки, настроенные для домена
+func (server *Server) applyTracker(req *http.Request) {
+	host := strings.ToLower(req.URL.Hostname())
+	for domain, tracker := range server.config.Trackers {
+		domain = strings.ToLower(domain)
+		if host != domain && !strings.HasSuffix(host, "."+domain) {
+			continue
+		}
+
+		for name, value := range tracker.Headers {
+			req.Header.Set(name, value)
+		}
+		for name, value := range tracker.Cookies {
+			req.AddCookie(&http.Cookie{Name: name, Value: value})
+		}
+	}
+}
+
+// torrentFileName определяет имя .torrent файла по заголовку ответа,
+// адресу или названию раздачи
+func torrentFileName(resp *http.Response, name string) string {
+	if _, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition")); err == nil {
+		if filename := path.Base(params["filename"]); strings.HasSuffix(filename, ".torrent") {
+			return filename
+		}
+	}
+
+	if base := path.Base(resp.Request.URL.Path); strings.HasSuffix(base, ".torrent") {
+		return base
+	}
+
+	return name + ".torrent"
+}
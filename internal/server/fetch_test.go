@@ -0,0 +1,152 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"retreat-backend/internal/database"
+	"retreat-backend/internal/search"
+)
+
+const testTorrent = "d4:infod6:lengthi1024e4:name9:movie.mkv12:piece lengthi16384e6:pieces20:aaaaaaaaaaaaaaaaaaaaee"
+
+func TestFetchTorrent(t *testing.T) {
+	indexer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("apikey") != "key" {
+			http.Error(w, "invalid key", http.StatusUnauthorized)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/dl/movie":
+			w.Header().Set("Content-Type", "application/x-bittorrent")
+			w.Write([]byte(testTorrent))
+		case "/dl/magnet":
+			http.Redirect(w, r, "magnet:?xt=urn:btih:0123456789abcdef0123456789abcdef01234567", http.StatusFound)
+		case "/dl/login":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte("<html>login</html>"))
+		}
+	}))
+	defer indexer.Close()
+
+	server := &Server{
+		config:     &Config{},
+		httpClient: &http.Client{},
+		linkClient: &http.Client{Transport: publicTransport()},
+		searcher:   search.NewSearcher(time.Second, search.NewTorznab(search.TorznabConfig{URL: indexer.URL + "/api", ApiKey: "key"})),
+	}
+
+	tests := []struct {
+		name   string
+		link   string
+		err    error
+		magnet bool
+	}{
+		{"indexer link", indexer.URL + "/dl/movie?apikey=", nil, false},
+		{"indexer redirect to magnet", indexer.URL + "/dl/magnet?apikey=", nil, true},
+		{"indexer login page", indexer.URL + "/dl/login?apikey=", errNotTorrent, false},
+		{"private address", "http://127.0.0.1:1/dl/movie", errPrivateAddress, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fetched, err := server.fetchTorrent(context.Background(), tt.link)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("fetchTorrent() error = %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("fetchTorrent() error = %v", err)
+			}
+
+			if tt.magnet {
+				if fetched.Magnet == "" {
+					t.Errorf("fetched = %+v, want magnet", fetched)
+				}
+				return
+			}
+			if string(fetched.Data) != testTorrent || fetched.Name != "movie.mkv.torrent" {
+				t.Errorf("fetched = %q %q", fetched.Name, fetched.Data)
+			}
+		})
+	}
+}
+
+func TestProcessFeed(t *testing.T) {
+	// Лента индексатора требует ключ API и cookie трекера
+	indexer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session, err := r.Cookie("session")
+		if r.URL.Query().Get("apikey") != "key" || err != nil || session.Value != "secret" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		w.Write([]byte(`<rss version="2.0"><channel></channel></rss>`))
+	}))
+	defer indexer.Close()
+
+	server := &Server{
+		config: &Config{Trackers: map[string]TrackerConfig{
+			"127.0.0.1": {Cookies: map[string]string{"session": "secret"}},
+		}},
+		httpClient: &http.Client{},
+		linkClient: &http.Client{Transport: publicTransport()},
+		searcher:   search.NewSearcher(time.Second, search.NewTorznab(search.TorznabConfig{URL: indexer.URL + "/api", ApiKey: "key"})),
+	}
+
+	tests := []struct {
+		name string
+		url  string
+		err  error
+	}{
+		{"indexer feed", indexer.URL + "/api?t=search&apikey=", nil},
+		{"loopback", "http://127.0.0.1:27017/", errPrivateAddress},
+		{"link-local", "http://169.254.169.254/latest/meta-data/", errPrivateAddress},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := server.processFeed(&database.Feed{URL: tt.url})
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("processFeed() error = %v, want %v", err, tt.err)
+			}
+			if err != nil && strings.Contains(err.Error(), tt.url) {
+				t.Errorf("error %q exposes the feed address", err)
+			}
+		})
+	}
+}
+
+func TestIsPublicAddr(t *testing.T) {
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"10.0.0.5", false},
+		{"192.168.1.10", false},
+		{"169.254.169.254", false},
+		{"0.0.0.0", false},
+		{"::1", false},
+		{"fd00::1", false},
+		{"fe80::1", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			if got := isPublicAddr(netip.MustParseAddr(tt.addr)); got != tt.want {
+				t.Errorf("isPublicAddr(%s) = %v, want %v", tt.addr, got, tt.want)
+			}
+		})
+	}
+}
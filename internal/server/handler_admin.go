@@ -0,0 +1,92 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+type AdminResponse struct {
+	Message string `json:"message,omitempty"`
+}
+
+// Limits описывает общие и пользовательские ограничения скорости
+type Limits struct {
+	DownloadRate int64                 `json:"download_rate"`
+	UploadRate   int64                 `json:"upload_rate"`
+	Users        map[string]UserLimits `json:"users"`
+}
+
+func (server *Server) admin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		email, _ := r.Context().Value(userEmailKey).(string)
+		isAdmin := slices.ContainsFunc(server.config.Admins, func(admin string) bool {
+			return strings.EqualFold(admin, email)
+		})
+		if !isAdmin {
+			server.respond(w, AdminResponse{Message: "Forbidden"}, http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// limits возвращает (GET) или заменяет (POST) ограничения скорости без перезапуска сервера
+func (server *Server) limits(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		server.mu.Lock()
+		limits := Limits{
+			DownloadRate: server.config.DownloadRateLimit,
+			UploadRate:   server.config.UploadRateLimit,
+			Users:        server.config.UserLimits,
+		}
+		server.mu.Unlock()
+
+		server.respond(w, limits, http.StatusOK)
+	case http.MethodPost:
+		var limits Limits
+		if err := json.NewDecoder(r.Body).Decode(&limits); err != nil {
+			server.respond(w, AdminResponse{Message: "Invalid JSON"}, http.StatusBadRequest)
+			return
+		}
+
+		server.applyLimits(limits)
+
+		if err := server.config.save(); err != nil {
+			server.respond(w, AdminResponse{Message: "Failed to save config"}, http.StatusInternalServerError)
+			return
+		}
+
+		server.respond(w, AdminResponse{Message: "Limits updated"}, http.StatusOK)
+	default:
+		server.respond(w, AdminResponse{Message: "Method not allowed"}, http.StatusMethodNotAllowed)
+	}
+}
+
+// applyLimits применяет ограничения к клиенту и потокам пользователей
+func (server *Server) applyLimits(limits Limits) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	server.torrentManager.SetRateLimits(limits.DownloadRate, limits.UploadRate)
+
+	// Снимаем ограничения с пользователей, которых больше нет в списке
+	for email := range server.config.UserLimits {
+		if _, ok := limits.Users[email]; !ok {
+			server.userLimiters.set(email, UserLimits{})
+		}
+	}
+
+	users := make(map[string]UserLimits, len(limits.Users))
+	for email, l := range limits.Users {
+		email = strings.ToLower(strings.TrimSpace(email))
+		users[email] = l
+		server.userLimiters.set(email, l)
+	}
+
+	server.config.DownloadRateLimit = limits.DownloadRate
+	server.config.UploadRateLimit = limits.UploadRate
+	server.config.UserLimits = users
+}
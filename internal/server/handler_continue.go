@@ -0,0 +1,50 @@
+package server
+
+import (
+	"net/http"
+
+	"retreat-backend/internal/database"
+)
+
+const defaultContinueLimit = 20
+
+type ContinueResponse struct {
+	Message string                   `json:"message,omitempty"`
+	Entries []*database.HistoryEntry `json:"entries"`
+}
+
+// continueWatching возвращает начатые и не досмотренные файлы, недавние первыми.
+// Файлы торрентов, удаленных из библиотеки, пропускаются.
+func (server *Server) continueWatching(w http.ResponseWriter, r *http.Request) {
+	email, _ := r.Context().Value(userEmailKey).(string)
+	user, err := server.userStore.GetUserByEmail(email)
+	if err != nil {
+		server.respond(w, ContinueResponse{Message: "unauthorized"}, http.StatusUnauthorized)
+		return
+	}
+
+	limit, ok := queryInt(r, "limit", defaultContinueLimit)
+	if !ok || limit <= 0 {
+		server.respond(w, ContinueResponse{Message: "invalid limit"}, http.StatusBadRequest)
+		return
+	}
+	limit = min(limit, maxHistoryLimit)
+
+	torrents, err := server.torrentStore.GetTorrents(user.ID)
+	if err != nil {
+		server.respond(w, ContinueResponse{Message: err.Error()}, http.StatusInternalServerError)
+		return
+	}
+	library := make([]string, 0, len(torrents))
+	for _, t := range torrents {
+		library = append(library, t.Hash)
+	}
+
+	entries, err := server.historyStore.GetContinueWatching(user.ID, library, limit)
+	if err != nil {
+		server.respond(w, ContinueResponse{Message: err.Error()}, http.StatusInternalServerError)
+		return
+	}
+
+	server.respond(w, ContinueResponse{Entries: entries}, http.StatusOK)
+}
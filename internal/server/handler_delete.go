@@ -2,6 +2,8 @@ package server
 
 import (
 	"net/http"
+
+	"retreat-backend/internal/torrent"
 )
 
 type DeleteResponse struct {
@@ -18,10 +20,17 @@ func (server *Server) delete(w http.ResponseWriter, r *http.Request) {
 	id := r.URL.Query().Get("id")
 
 	err = server.torrentStore.DeleteTorrent(user.ID, id)
+	if err == nil {
+		server.torrentManager.Publish(torrent.Event{Type: torrent.EventRemoved, Hash: id, Owner: user.ID.Hex()})
+	}
 
 	isHave := server.torrentStore.HaveTorrent(id)
 	if !isHave {
 		server.torrentManager.RemoveTorrent(id)
+	} else {
+		_ = server.applySelection(id)
+		_ = server.applyPins(id)
+		_ = server.applySeedPolicy(id)
 	}
 
 	if err != nil {
@@ -0,0 +1,57 @@
+package server
+
+import (
+	"net/http"
+
+	"retreat-backend/internal/database"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type DeliveriesResponse struct {
+	Message    string                      `json:"message,omitempty"`
+	Deliveries []*database.WebhookDelivery `json:"deliveries,omitempty"`
+	Total      int64                       `json:"total"`
+	Offset     int64                       `json:"offset"`
+	Limit      int64                       `json:"limit"`
+}
+
+// deliveries возвращает страницу журнала доставок вебхуков пользователя,
+// недавние первыми. Параметр id ограничивает журнал одним вебхуком.
+func (server *Server) deliveries(w http.ResponseWriter, r *http.Request) {
+	email, _ := r.Context().Value(userEmailKey).(string)
+	user, err := server.userStore.GetUserByEmail(email)
+	if err != nil {
+		server.respond(w, DeliveriesResponse{Message: "unauthorized"}, http.StatusUnauthorized)
+		return
+	}
+
+	var webhookId primitive.ObjectID
+	if id := r.URL.Query().Get("id"); id != "" {
+		webhookId, err = primitive.ObjectIDFromHex(id)
+		if err != nil {
+			server.respond(w, DeliveriesResponse{Message: "invalid id"}, http.StatusBadRequest)
+			return
+		}
+	}
+
+	offset, ok := queryInt(r, "offset", 0)
+	if !ok || offset < 0 {
+		server.respond(w, DeliveriesResponse{Message: "invalid offset"}, http.StatusBadRequest)
+		return
+	}
+	limit, ok := queryInt(r, "limit", defaultHistoryLimit)
+	if !ok || limit <= 0 {
+		server.respond(w, DeliveriesResponse{Message: "invalid limit"}, http.StatusBadRequest)
+		return
+	}
+	limit = min(limit, maxHistoryLimit)
+
+	deliveries, total, err := server.webhookStore.GetDeliveries(user.ID, webhookId, offset, limit)
+	if err != nil {
+		server.respond(w, DeliveriesResponse{Message: err.Error()}, http.StatusInternalServerError)
+		return
+	}
+
+	server.respond(w, DeliveriesResponse{Deliveries: deliveries, Total: total, Offset: offset, Limit: limit}, http.StatusOK)
+}
@@ -2,28 +2,92 @@ package server
 
 import (
 	"net/http"
+	"slices"
+
+	"retreat-backend/internal/torrent"
 )
 
 type DownloadResponse struct {
 	Message string `json:"message,omitempty"`
 }
 
+// download закрепляет файл (или весь торрент, если fileId не указан) для полной загрузки в фоне.
+// POST закрепляет, DELETE снимает закрепление.
 func (server *Server) download(w http.ResponseWriter, r *http.Request) {
-	//id := r.URL.Query().Get("id")
-
-	//info, ok := server.torrentManager.GetTorrent(id)
-	//if !ok {
-	//	server.respond(w, DownloadResponse{Message: "File not found"}, http.StatusNotFound)
-	//	return
-	//}
-
-	//if info.File.Priority() == torrent.PiecePriorityNone {
-	//	info.File.Download()
-	//	info.Download = true
-	//	server.respond(w, DownloadResponse{Message: "Downloading file"}, http.StatusOK)
-	//} else {
-	//	info.File.SetPriority(torrent.PiecePriorityNone)
-	//	info.Download = false
-	//	server.respond(w, DownloadResponse{Message: "File download paused"}, http.StatusOK)
-	//}
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		server.respond(w, DownloadResponse{Message: "Method not allowed"}, http.StatusMethodNotAllowed)
+		return
+	}
+
+	email, _ := r.Context().Value(userEmailKey).(string)
+	user, err := server.userStore.GetUserByEmail(email)
+	if err != nil {
+		server.respond(w, DownloadResponse{Message: "unauthorized"}, http.StatusUnauthorized)
+		return
+	}
+
+	id := r.URL.Query().Get("id")
+	fileId := r.URL.Query().Get("fileId")
+	pin := r.Method == http.MethodPost
+
+	t, err := server.torrentStore.GetTorrent(user.ID, id)
+	if err != nil {
+		server.respond(w, DownloadResponse{Message: "torrent not found"}, http.StatusNotFound)
+		return
+	}
+
+	if err := server.restoreTorrent(t); err != nil {
+		server.respond(w, DownloadResponse{Message: "torrent not found"}, http.StatusNotFound)
+		return
+	}
+
+	info, ok := server.torrentManager.GetTorrent(t.Hash)
+	if !ok {
+		server.respond(w, DownloadResponse{Message: "torrent not found"}, http.StatusNotFound)
+		return
+	}
+
+	pinned := t.PinnedFiles
+	switch {
+	case fileId == "" && pin:
+		pinned = make([]string, 0, len(info.Files))
+		for _, f := range info.Files {
+			if fileSelected(t, f.Id) {
+				pinned = append(pinned, f.Id)
+			}
+		}
+	case fileId == "":
+		pinned = nil
+	default:
+		found := fileSelected(t, fileId) && slices.ContainsFunc(info.Files, func(f *torrent.FileInfo) bool {
+			return f.Id == fileId
+		})
+		if !found {
+			server.respond(w, DownloadResponse{Message: "file not found"}, http.StatusNotFound)
+			return
+		}
+
+		pinned = slices.DeleteFunc(slices.Clone(pinned), func(id string) bool {
+			return id == fileId
+		})
+		if pin {
+			pinned = append(pinned, fileId)
+		}
+	}
+
+	if err := server.torrentStore.SetPinnedFiles(user.ID, t.Hash, pinned); err != nil {
+		server.respond(w, DownloadResponse{Message: err.Error()}, http.StatusInternalServerError)
+		return
+	}
+
+	if err := server.applyPins(t.Hash); err != nil {
+		server.respond(w, DownloadResponse{Message: err.Error()}, http.StatusInternalServerError)
+		return
+	}
+
+	if pin {
+		server.respond(w, DownloadResponse{Message: "Downloading file"}, http.StatusOK)
+	} else {
+		server.respond(w, DownloadResponse{Message: "File download paused"}, http.StatusOK)
+	}
 }
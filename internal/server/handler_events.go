@@ -0,0 +1,144 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"retreat-backend/internal/torrent"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// eventsKeepAlive задает период комментариев, не дающих прокси закрыть соединение
+	eventsKeepAlive = 30 * time.Second
+	// libraryRefresh ограничивает частоту перечитывания библиотеки при событиях о незнакомых торрентах
+	libraryRefresh = 10 * time.Second
+)
+
+type EventsResponse struct {
+	Message string `json:"message,omitempty"`
+}
+
+// events отдает поток Server-Sent Events об изменениях торрентов в библиотеке
+// пользователя: добавление, получение метаданных, прогресс и завершение загрузки, ошибки
+// и удаление. Токен можно передать параметром token, так как EventSource
+// не поддерживает заголовки.
+func (server *Server) events(w http.ResponseWriter, r *http.Request) {
+	email, _ := r.Context().Value(userEmailKey).(string)
+	user, err := server.userStore.GetUserByEmail(email)
+	if err != nil {
+		server.respond(w, EventsResponse{Message: "unauthorized"}, http.StatusUnauthorized)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		server.respond(w, EventsResponse{Message: "streaming is not supported"}, http.StatusInternalServerError)
+		return
+	}
+
+	// Подписка оформляется до чтения библиотеки, чтобы не пропустить события между ними
+	events, unsubscribe := server.torrentManager.Subscribe()
+	defer unsubscribe()
+
+	library := &userLibrary{server: server, owner: user.ID}
+	if err := library.refresh(); err != nil {
+		server.respond(w, EventsResponse{Message: err.Error()}, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, ": connected\n\n")
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(eventsKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case e := <-events:
+			if !library.accepts(e) {
+				continue
+			}
+
+			data, err := json.Marshal(e)
+			if err != nil {
+				log.Printf("Failed to encode event: %v", err)
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, data); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// userLibrary отслеживает торренты пользователя для отбора событий
+type userLibrary struct {
+	server    *Server
+	owner     primitive.ObjectID
+	hashes    map[string]bool
+	refreshed time.Time
+}
+
+func (l *userLibrary) refresh() error {
+	torrents, err := l.server.torrentStore.GetTorrents(l.owner)
+	if err != nil {
+		return err
+	}
+
+	l.hashes = make(map[string]bool, len(torrents))
+	for _, t := range torrents {
+		l.hashes[t.Hash] = true
+	}
+	l.refreshed = time.Now()
+
+	return nil
+}
+
+// accepts сообщает, относится ли событие к пользователю. Торрент мог быть
+// добавлен после подключения, поэтому при событии о незнакомом торренте
+// библиотека перечитывается, но не чаще libraryRefresh, так как это в основном
+// частые события прогресса.
+func (l *userLibrary) accepts(e torrent.Event) bool {
+	if e.Owner != "" {
+		if e.Owner != l.owner.Hex() {
+			return false
+		}
+		switch e.Type {
+		case torrent.EventAdded:
+			l.hashes[e.Hash] = true
+		case torrent.EventRemoved:
+			delete(l.hashes, e.Hash)
+		}
+		return true
+	}
+
+	if l.hashes[e.Hash] || e.Type == torrent.EventRemoved {
+		return l.hashes[e.Hash]
+	}
+
+	if time.Since(l.refreshed) >= libraryRefresh {
+		if err := l.refresh(); err != nil {
+			log.Printf("Failed to refresh library for events: %v", err)
+		}
+	}
+
+	return l.hashes[e.Hash]
+}
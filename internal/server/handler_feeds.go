@@ -0,0 +1,144 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"retreat-backend/internal/database"
+	"retreat-backend/internal/feed"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// defaultFeedInterval и minFeedInterval задают период проверки ленты в минутах
+	defaultFeedInterval = 15
+	minFeedInterval     = 5
+	// maxFeeds ограничивает число подписок одного пользователя
+	maxFeeds = 50
+)
+
+type FeedRequest struct {
+	Id       string   `json:"id,omitempty"` // Только при изменении
+	Name     string   `json:"name"`
+	URL      string   `json:"url"`
+	Include  []string `json:"include"`
+	Exclude  []string `json:"exclude"`
+	Interval int      `json:"interval"`
+}
+
+type FeedsResponse struct {
+	Message string           `json:"message,omitempty"`
+	Feed    *database.Feed   `json:"feed,omitempty"`
+	Feeds   []*database.Feed `json:"feeds,omitempty"`
+}
+
+// feeds возвращает подписки пользователя на RSS-ленты (GET), создает (POST)
+// или изменяет (PUT) подписку либо удаляет ее по параметру id (DELETE).
+// Новая или измененная лента проверяется сразу.
+func (server *Server) feeds(w http.ResponseWriter, r *http.Request) {
+	email, _ := r.Context().Value(userEmailKey).(string)
+	user, err := server.userStore.GetUserByEmail(email)
+	if err != nil {
+		server.respond(w, FeedsResponse{Message: "unauthorized"}, http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		feeds, err := server.feedStore.GetFeeds(user.ID)
+		if err != nil {
+			server.respond(w, FeedsResponse{Message: err.Error()}, http.StatusInternalServerError)
+			return
+		}
+		server.respond(w, FeedsResponse{Feeds: feeds}, http.StatusOK)
+		return
+	case http.MethodDelete:
+		id, err := primitive.ObjectIDFromHex(r.URL.Query().Get("id"))
+		if err != nil {
+			server.respond(w, FeedsResponse{Message: "invalid id"}, http.StatusBadRequest)
+			return
+		}
+		if err := server.feedStore.DeleteFeed(user.ID, id); err != nil {
+			server.respond(w, FeedsResponse{Message: err.Error()}, http.StatusNotFound)
+			return
+		}
+		server.respond(w, FeedsResponse{Message: "Feed deleted"}, http.StatusOK)
+		return
+	case http.MethodPost, http.MethodPut:
+	default:
+		server.respond(w, FeedsResponse{Message: "Method not allowed"}, http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req FeedRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		server.respond(w, FeedsResponse{Message: "Invalid JSON"}, http.StatusBadRequest)
+		return
+	}
+
+	target, err := url.Parse(req.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		server.respond(w, FeedsResponse{Message: "invalid url"}, http.StatusBadRequest)
+		return
+	}
+	if _, err := feed.CompileRules(req.Include, req.Exclude); err != nil {
+		server.respond(w, FeedsResponse{Message: err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	f := &database.Feed{
+		OwnerId:  user.ID,
+		Name:     strings.TrimSpace(req.Name),
+		URL:      target.String(),
+		Include:  req.Include,
+		Exclude:  req.Exclude,
+		Interval: req.Interval,
+	}
+	if f.Name == "" {
+		f.Name = target.Host
+	}
+	if f.Interval == 0 {
+		f.Interval = defaultFeedInterval
+	}
+	f.Interval = max(f.Interval, minFeedInterval)
+
+	if r.Method == http.MethodPut {
+		if f.ID, err = primitive.ObjectIDFromHex(req.Id); err != nil {
+			server.respond(w, FeedsResponse{Message: "invalid id"}, http.StatusBadRequest)
+			return
+		}
+		if err := server.feedStore.UpdateFeed(f); err != nil {
+			server.respond(w, FeedsResponse{Message: err.Error()}, http.StatusNotFound)
+			return
+		}
+		if f, err = server.feedStore.GetFeed(user.ID, f.ID); err != nil {
+			server.respond(w, FeedsResponse{Message: err.Error()}, http.StatusInternalServerError)
+			return
+		}
+
+		server.scheduleFeed(f)
+		server.respond(w, FeedsResponse{Message: "Feed updated", Feed: f}, http.StatusOK)
+		return
+	}
+
+	feeds, err := server.feedStore.GetFeeds(user.ID)
+	if err != nil {
+		server.respond(w, FeedsResponse{Message: err.Error()}, http.StatusInternalServerError)
+		return
+	}
+	if len(feeds) >= maxFeeds {
+		server.respond(w, FeedsResponse{Message: "too many feeds"}, http.StatusConflict)
+		return
+	}
+
+	if err := server.feedStore.CreateFeed(f); err != nil {
+		server.respond(w, FeedsResponse{Message: err.Error()}, http.StatusInternalServerError)
+		return
+	}
+
+	server.scheduleFeed(f)
+	server.respond(w, FeedsResponse{Message: "Feed created", Feed: f}, http.StatusCreated)
+}
@@ -1,8 +1,17 @@
 package server
 
 import (
+	"bytes"
+	"io"
+	"log"
 	"net/http"
 	"strings"
+
+	"retreat-backend/internal/database"
+	"retreat-backend/internal/torrent"
+
+	"github.com/anacrolix/torrent/metainfo"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type FileResponse struct {
@@ -10,6 +19,14 @@ type FileResponse struct {
 }
 
 func (server *Server) file(w http.ResponseWriter, r *http.Request) {
+	email, _ := r.Context().Value(userEmailKey).(string)
+
+	user, err := server.userStore.GetUserByEmail(email)
+	if err != nil {
+		server.respond(w, FileResponse{Message: "unauthorized"}, http.StatusUnauthorized)
+		return
+	}
+
 	if err := r.ParseMultipartForm(10 << 20); err != nil { // 10 MB max
 		server.respond(w, FileResponse{Message: "Failed to parse multipart form"}, http.StatusBadRequest)
 		return
@@ -27,12 +44,58 @@ func (server *Server) file(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Используем менеджер торрентов для обработки файла
-	_, err = server.torrentManager.AddTorrentFromFile(file, handler.Filename)
+	data, err := io.ReadAll(file)
 	if err != nil {
+		server.respond(w, FileResponse{Message: "Failed to read file"}, http.StatusBadRequest)
+		return
+	}
+
+	if _, err := server.addTorrentFile(user.ID, handler.Filename, data, formFiles(r)); err != nil {
 		server.respond(w, FileResponse{Message: "Error adding torrent: " + err.Error()}, http.StatusBadRequest)
 		return
 	}
 
 	server.respond(w, FileResponse{Message: "Files added"}, http.StatusOK)
 }
+
+// addTorrentFile добавляет .torrent файл в библиотеку пользователя с выбранными файлами (nil — все файлы)
+func (server *Server) addTorrentFile(ownerId primitive.ObjectID, name string, data []byte, files []string) (*torrent.TorrentInfo, error) {
+	if len(files) > 0 {
+		if mi, err := metainfo.Load(bytes.NewReader(data)); err == nil {
+			server.preselectFiles(mi.HashInfoBytes().HexString(), files)
+		}
+	}
+
+	// Используем менеджер торрентов для обработки файла
+	torrentInfo, err := server.torrentManager.AddTorrentFromFile(bytes.NewReader(data), name)
+	if err != nil {
+		return nil, err
+	}
+	server.torrentManager.Touch(torrentInfo.Id)
+
+	// Сохраняем исходные байты, чтобы торрент можно было добавить повторно после перезапуска
+	err = server.torrentStore.CreateTorrent(&database.Torrent{
+		OwnerId:     ownerId,
+		Hash:        torrentInfo.Id,
+		TorrentFile: name,
+		Metainfo:    data,
+		State:       torrent.JobReady,
+		Files:       files,
+		TorrentInfo: torrentInfo,
+	})
+	if err := server.applySelection(torrentInfo.Id); err != nil {
+		log.Printf("Failed to apply file selection for %s: %v", torrentInfo.Id, err)
+	}
+	if err := server.applySeedPolicy(torrentInfo.Id); err != nil {
+		log.Printf("Failed to apply seeding policy for %s: %v", torrentInfo.Id, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	go server.probeMedia(torrentInfo.Id)
+	server.torrentManager.Publish(torrent.Event{Type: torrent.EventAdded, Hash: torrentInfo.Id, Owner: ownerId.Hex()})
+	server.torrentManager.Publish(torrent.Event{Type: torrent.EventMetadata, Hash: torrentInfo.Id, Owner: ownerId.Hex(), Torrent: torrentInfo})
+
+	return torrentInfo, nil
+}
@@ -0,0 +1,189 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+
+	"retreat-backend/internal/database"
+	"retreat-backend/internal/torrent"
+)
+
+type FilesRequest struct {
+	Files []string `json:"files"` // null выбирает все файлы
+}
+
+type FilesResponse struct {
+	Message string          `json:"message,omitempty"`
+	Files   []*SelectedFile `json:"files,omitempty"`
+}
+
+// SelectedFile описывает файл торрента и его выбор пользователем
+type SelectedFile struct {
+	*torrent.FileInfo
+	Selected bool `json:"selected"`
+}
+
+// files возвращает (GET) все файлы торрента с отметкой выбора или сохраняет (PUT)
+// файлы, входящие в библиотеку пользователя. Невыбранные файлы скрываются из списков
+// и не загружаются, если их не выбрал другой пользователь торрента.
+func (server *Server) files(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPut {
+		server.respond(w, FilesResponse{Message: "Method not allowed"}, http.StatusMethodNotAllowed)
+		return
+	}
+
+	email, _ := r.Context().Value(userEmailKey).(string)
+	user, err := server.userStore.GetUserByEmail(email)
+	if err != nil {
+		server.respond(w, FilesResponse{Message: "unauthorized"}, http.StatusUnauthorized)
+		return
+	}
+
+	t, err := server.torrentStore.GetTorrent(user.ID, r.URL.Query().Get("id"))
+	if err != nil {
+		server.respond(w, FilesResponse{Message: "torrent not found"}, http.StatusNotFound)
+		return
+	}
+	if t.State == torrent.JobPendingMetadata {
+		server.respond(w, FilesResponse{Message: "torrent info is not loaded yet"}, http.StatusConflict)
+		return
+	}
+
+	if err := server.restoreTorrent(t); err != nil {
+		server.respond(w, FilesResponse{Message: "torrent not found"}, http.StatusNotFound)
+		return
+	}
+
+	info, ok := server.torrentManager.GetTorrent(t.Hash)
+	if !ok {
+		server.respond(w, FilesResponse{Message: "torrent not found"}, http.StatusNotFound)
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		server.respond(w, FilesResponse{Files: selectedFiles(info, t)}, http.StatusOK)
+		return
+	}
+
+	var req FilesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		server.respond(w, FilesResponse{Message: "Invalid JSON"}, http.StatusBadRequest)
+		return
+	}
+
+	files := req.Files
+	if files != nil {
+		if len(files) == 0 {
+			server.respond(w, FilesResponse{Message: "no files selected"}, http.StatusBadRequest)
+			return
+		}
+
+		for _, fileId := range files {
+			found := slices.ContainsFunc(info.Files, func(f *torrent.FileInfo) bool {
+				return f.Id == fileId
+			})
+			if !found {
+				server.respond(w, FilesResponse{Message: "file not found"}, http.StatusNotFound)
+				return
+			}
+		}
+
+		files = slices.Clone(files)
+		slices.Sort(files)
+		files = slices.Compact(files)
+		if len(files) == len(info.Files) {
+			files = nil
+		}
+	}
+
+	pinned := t.PinnedFiles
+	if files != nil {
+		pinned = slices.DeleteFunc(slices.Clone(pinned), func(id string) bool {
+			return !slices.Contains(files, id)
+		})
+	}
+
+	if err := server.torrentStore.SetSelectedFiles(user.ID, t.Hash, files, pinned); err != nil {
+		server.respond(w, FilesResponse{Message: err.Error()}, http.StatusInternalServerError)
+		return
+	}
+	t.Files, t.PinnedFiles = files, pinned
+
+	if err := server.applySelection(t.Hash); err != nil {
+		server.respond(w, FilesResponse{Message: err.Error()}, http.StatusInternalServerError)
+		return
+	}
+	if err := server.applyPins(t.Hash); err != nil {
+		server.respond(w, FilesResponse{Message: err.Error()}, http.StatusInternalServerError)
+		return
+	}
+
+	server.respond(w, FilesResponse{Message: "File selection saved", Files: selectedFiles(info, t)}, http.StatusOK)
+}
+
+// selectedFiles отмечает файлы торрента, выбранные пользователем
+func selectedFiles(info *torrent.TorrentInfo, t *database.Torrent) []*SelectedFile {
+	selected := selectedSet(info, t)
+
+	files := make([]*SelectedFile, 0, len(info.Files))
+	for _, f := range info.Files {
+		f.Pinned = slices.Contains(t.PinnedFiles, f.Id)
+		files = append(files, &SelectedFile{FileInfo: f, Selected: selected == nil || selected[f.Id]})
+	}
+
+	return files
+}
+
+// fileSelected сообщает, входит ли файл в библиотеку пользователя
+func fileSelected(t *database.Torrent, fileId string) bool {
+	return t.Files == nil || slices.Contains(t.Files, fileId)
+}
+
+// selectedSet возвращает файлы, выбранные пользователем, вместе с субтитрами
+// выбранных видео. nil означает все файлы.
+func selectedSet(info *torrent.TorrentInfo, t *database.Torrent) map[string]bool {
+	if t.Files == nil {
+		return nil
+	}
+
+	selected := make(map[string]bool, len(t.Files))
+	for _, f := range info.Files {
+		if !fileSelected(t, f.Id) {
+			continue
+		}
+
+		selected[f.Id] = true
+		for _, s := range f.Subtitles {
+			selected[s.Id] = true
+		}
+	}
+
+	return selected
+}
+
+// preselectFiles задает выбор файлов нового торрента до добавления в клиент, чтобы
+// невыбранные файлы не получили приоритет при обработке метаданных. Выбор торрента,
+// который уже есть в библиотеке, объединяется с выбором других пользователей
+// после сохранения записи.
+func (server *Server) preselectFiles(hash string, files []string) {
+	if server.torrentStore.HaveTorrent(hash) {
+		return
+	}
+
+	_ = server.torrentManager.SetSelectedFiles(hash, files)
+}
+
+// formFiles разбирает выбор файлов из параметра files (ID через запятую).
+// nil означает все файлы.
+func formFiles(r *http.Request) []string {
+	var files []string
+	for _, fileId := range strings.Split(r.FormValue("files"), ",") {
+		if fileId = strings.TrimSpace(fileId); fileId != "" {
+			files = append(files, fileId)
+		}
+	}
+
+	return files
+}
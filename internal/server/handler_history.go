@@ -0,0 +1,82 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+
+	"retreat-backend/internal/database"
+)
+
+const (
+	defaultHistoryLimit = 20
+	maxHistoryLimit     = 100
+)
+
+type HistoryResponse struct {
+	Message string                   `json:"message,omitempty"`
+	Entries []*database.HistoryEntry `json:"entries,omitempty"`
+	Total   int64                    `json:"total"`
+	Offset  int64                    `json:"offset"`
+	Limit   int64                    `json:"limit"`
+}
+
+// history возвращает страницу истории просмотров (GET, параметры offset и limit)
+// или очищает историю (DELETE)
+func (server *Server) history(w http.ResponseWriter, r *http.Request) {
+	email, _ := r.Context().Value(userEmailKey).(string)
+	user, err := server.userStore.GetUserByEmail(email)
+	if err != nil {
+		server.respond(w, HistoryResponse{Message: "unauthorized"}, http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodDelete:
+		deleted, err := server.historyStore.ClearHistory(user.ID)
+		if err != nil {
+			server.respond(w, HistoryResponse{Message: err.Error()}, http.StatusInternalServerError)
+			return
+		}
+		server.respond(w, HistoryResponse{Message: "History cleared", Total: deleted}, http.StatusOK)
+		return
+	default:
+		server.respond(w, HistoryResponse{Message: "Method not allowed"}, http.StatusMethodNotAllowed)
+		return
+	}
+
+	offset, ok := queryInt(r, "offset", 0)
+	if !ok || offset < 0 {
+		server.respond(w, HistoryResponse{Message: "invalid offset"}, http.StatusBadRequest)
+		return
+	}
+	limit, ok := queryInt(r, "limit", defaultHistoryLimit)
+	if !ok || limit <= 0 {
+		server.respond(w, HistoryResponse{Message: "invalid limit"}, http.StatusBadRequest)
+		return
+	}
+	limit = min(limit, maxHistoryLimit)
+
+	entries, total, err := server.historyStore.GetHistory(user.ID, offset, limit)
+	if err != nil {
+		server.respond(w, HistoryResponse{Message: err.Error()}, http.StatusInternalServerError)
+		return
+	}
+
+	server.respond(w, HistoryResponse{Entries: entries, Total: total, Offset: offset, Limit: limit}, http.StatusOK)
+}
+
+// queryInt разбирает целочисленный параметр запроса или возвращает значение по умолчанию
+func queryInt(r *http.Request, name string, def int64) (int64, bool) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return def, true
+	}
+
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+
+	return n, true
+}
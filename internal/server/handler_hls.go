@@ -0,0 +1,85 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"retreat-backend/internal/hls"
+	"retreat-backend/internal/mkv"
+	"retreat-backend/internal/mp4"
+	"retreat-backend/internal/remux"
+)
+
+type HLSResponse struct {
+	Message string `json:"message,omitempty"`
+}
+
+// hls отдает поток HLS файла: index.m3u8, init.mp4 и сегменты N.m4s.
+// Параметр audio задает номер аудиодорожки среди аудиодорожек файла.
+func (server *Server) hls(w http.ResponseWriter, r *http.Request) {
+	email, _ := r.Context().Value(userEmailKey).(string)
+	user, err := server.userStore.GetUserByEmail(email)
+	if err != nil {
+		return
+	}
+
+	id := r.PathValue("torrent")
+	fileId := r.PathValue("file")
+	segment := r.PathValue("segment")
+
+	torrent, err := server.torrentStore.GetTorrent(user.ID, id)
+	if err != nil {
+		server.respond(w, HLSResponse{Message: "torrent not found"}, http.StatusNotFound)
+		return
+	}
+
+	if !fileSelected(torrent, fileId) {
+		server.respond(w, HLSResponse{Message: "file not found"}, http.StatusNotFound)
+		return
+	}
+
+	if err := server.restoreTorrent(torrent); err != nil {
+		server.respond(w, HLSResponse{Message: "torrent not found"}, http.StatusNotFound)
+		return
+	}
+
+	audio := -1
+	if value := r.URL.Query().Get("audio"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			server.respond(w, HLSResponse{Message: "invalid audio"}, http.StatusBadRequest)
+			return
+		}
+		audio = n
+	}
+
+	switch {
+	case segment == "index.m3u8":
+		// Параметры запроса (токен и дорожка) передаются в адреса сегментов
+		err = server.torrentManager.HLSPlaylist(w, r, id, fileId, audio, r.URL.RawQuery)
+	case segment == "init.mp4":
+		err = server.torrentManager.HLSInit(w, r, id, fileId, audio)
+	case strings.HasSuffix(segment, ".m4s"):
+		index, convErr := strconv.Atoi(strings.TrimSuffix(segment, ".m4s"))
+		if convErr != nil || index < 0 {
+			server.respond(w, HLSResponse{Message: "invalid segment"}, http.StatusBadRequest)
+			return
+		}
+		err = server.torrentManager.HLSSegment(server.limitWriter(w, r, email), r, id, fileId, audio, index)
+	default:
+		server.respond(w, HLSResponse{Message: "not found"}, http.StatusNotFound)
+		return
+	}
+
+	switch {
+	case err == nil:
+	case errors.Is(err, hls.ErrUnsupported), errors.Is(err, hls.ErrTrackNotFound),
+		errors.Is(err, remux.ErrUnsupportedCodec), errors.Is(err, remux.ErrTrackNotFound), errors.Is(err, remux.ErrNoCues),
+		errors.Is(err, mkv.ErrInvalidElement), errors.Is(err, mp4.ErrInvalidBox):
+		server.respond(w, HLSResponse{Message: err.Error()}, http.StatusUnprocessableEntity)
+	default:
+		server.respond(w, HLSResponse{Message: err.Error()}, http.StatusNotFound)
+	}
+}
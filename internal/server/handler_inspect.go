@@ -0,0 +1,90 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"retreat-backend/internal/torrent"
+)
+
+type InspectResponse struct {
+	Message string           `json:"message,omitempty"`
+	Torrent *torrent.Preview `json:"torrent,omitempty"`
+	Added   bool             `json:"added"` // Торрент уже есть в библиотеке пользователя
+}
+
+// inspect описывает торрент по магнет-ссылке или http(s) ссылке (параметр uri)
+// либо по загруженному .torrent файлу (поле формы file), ничего не сохраняя.
+// После подтверждения торрент добавляется через /api/magnet или /api/file.
+func (server *Server) inspect(w http.ResponseWriter, r *http.Request) {
+	email, _ := r.Context().Value(userEmailKey).(string)
+	user, err := server.userStore.GetUserByEmail(email)
+	if err != nil {
+		server.respond(w, InspectResponse{Message: "unauthorized"}, http.StatusUnauthorized)
+		return
+	}
+
+	preview, code, err := server.inspectRequest(r)
+	if err != nil {
+		server.respond(w, InspectResponse{Message: err.Error()}, code)
+		return
+	}
+
+	res := InspectResponse{Torrent: preview}
+	if _, err := server.torrentStore.GetTorrent(user.ID, preview.Id); err == nil {
+		res.Added = true
+	}
+	if preview.Playable == 0 {
+		res.Message = "no valid files in torrent"
+	}
+
+	server.respond(w, res, http.StatusOK)
+}
+
+// inspectRequest описывает торрент из запроса и при ошибке возвращает код ответа
+func (server *Server) inspectRequest(r *http.Request) (*torrent.Preview, int, error) {
+	uri := r.URL.Query().Get("uri")
+	switch {
+	case isHTTPURL(uri):
+		fetched, err := server.fetchTorrent(r.Context(), uri)
+		if errors.Is(err, errNotTorrent) || errors.Is(err, errTorrentTooLarge) {
+			return nil, http.StatusUnprocessableEntity, fmt.Errorf("Error fetching torrent: %w", err)
+		}
+		if err != nil {
+			return nil, http.StatusBadRequest, fmt.Errorf("Error fetching torrent: %w", err)
+		}
+
+		if fetched.Magnet != "" {
+			return inspected(server.torrentManager.InspectMagnet(r.Context(), fetched.Magnet))
+		}
+		return inspected(server.torrentManager.InspectFile(r.Context(), bytes.NewReader(fetched.Data)))
+	case strings.HasPrefix(uri, "magnet:"):
+		return inspected(server.torrentManager.InspectMagnet(r.Context(), uri))
+	case uri != "":
+		return nil, http.StatusBadRequest, errors.New("Unsupported URI format")
+	}
+
+	if err := r.ParseMultipartForm(10 << 20); err != nil { // 10 MB max
+		return nil, http.StatusBadRequest, errors.New("Missing URI or file")
+	}
+
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		return nil, http.StatusBadRequest, errors.New("Failed to get file from form")
+	}
+	defer file.Close()
+
+	return inspected(server.torrentManager.InspectFile(r.Context(), file))
+}
+
+// inspected дополняет результат осмотра кодом ответа
+func inspected(preview *torrent.Preview, err error) (*torrent.Preview, int, error) {
+	if err != nil {
+		return nil, http.StatusUnprocessableEntity, fmt.Errorf("Error inspecting torrent: %w", err)
+	}
+
+	return preview, http.StatusOK, nil
+}
@@ -0,0 +1,58 @@
+package server
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"retreat-backend/internal/torrent"
+)
+
+func TestInspectRequestFailure(t *testing.T) {
+	server := &Server{torrentManager: &torrent.TorrentManager{}}
+
+	upload := func(data []byte) *http.Request {
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		part, _ := form.CreateFormFile("file", "broken.torrent")
+		part.Write(data)
+		form.Close()
+
+		r := httptest.NewRequest(http.MethodPost, "/api/inspect", &body)
+		r.Header.Set("Content-Type", form.FormDataContentType())
+		return r
+	}
+	query := func(uri string) *http.Request {
+		return httptest.NewRequest(http.MethodGet, "/api/inspect?uri="+url.QueryEscape(uri), nil)
+	}
+
+	tests := []struct {
+		name string
+		r    *http.Request
+		code int
+	}{
+		{"broken file", upload([]byte("not a torrent")), http.StatusUnprocessableEntity},
+		{"file without info", upload([]byte("d8:announce3:urle")), http.StatusUnprocessableEntity},
+		{"broken magnet", query("magnet:?xt=urn:btih:zz"), http.StatusUnprocessableEntity},
+		{"unsupported uri", query("ftp://example.com/a.torrent"), http.StatusBadRequest},
+		{"missing file", httptest.NewRequest(http.MethodPost, "/api/inspect", nil), http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			preview, code, err := server.inspectRequest(tt.r)
+			if err == nil {
+				t.Fatalf("expected error, got preview %+v", preview)
+			}
+			if preview != nil {
+				t.Errorf("expected no preview, got %+v", preview)
+			}
+			if code != tt.code {
+				t.Errorf("code = %d, want %d (%v)", code, tt.code, err)
+			}
+		})
+	}
+}
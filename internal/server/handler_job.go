@@ -0,0 +1,49 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+
+	"retreat-backend/internal/torrent"
+)
+
+type JobResponse struct {
+	Message string `json:"message,omitempty"`
+}
+
+func (server *Server) job(w http.ResponseWriter, r *http.Request) {
+	email, _ := r.Context().Value(userEmailKey).(string)
+	user, err := server.userStore.GetUserByEmail(email)
+	if err != nil {
+		server.respond(w, JobResponse{Message: "unauthorized"}, http.StatusUnauthorized)
+		return
+	}
+
+	// Задача доступна только владельцу торрента в библиотеке
+	job, ok := server.torrentManager.GetJob(r.URL.Query().Get("id"))
+	if ok {
+		_, err = server.torrentStore.GetTorrent(user.ID, job.Hash)
+	}
+	if !ok || err != nil {
+		server.respond(w, JobResponse{Message: torrent.ErrJobNotFound.Error()}, http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		server.respond(w, job, http.StatusOK)
+	case http.MethodDelete:
+		err := server.torrentManager.CancelJob(job.Id)
+		switch {
+		case errors.Is(err, torrent.ErrJobNotFound):
+			server.respond(w, JobResponse{Message: err.Error()}, http.StatusNotFound)
+			return
+		case errors.Is(err, torrent.ErrJobFinished):
+			server.respond(w, JobResponse{Message: err.Error()}, http.StatusConflict)
+			return
+		}
+		server.respond(w, JobResponse{Message: "job cancelled"}, http.StatusOK)
+	default:
+		server.respond(w, JobResponse{Message: "Method not allowed"}, http.StatusMethodNotAllowed)
+	}
+}
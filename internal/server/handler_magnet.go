@@ -1,15 +1,25 @@
 package server
 
 import (
+	"errors"
 	"log"
 	"net/http"
 	"strings"
+
+	"retreat-backend/internal/database"
+	"retreat-backend/internal/torrent"
+
+	"github.com/anacrolix/torrent/metainfo"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type MagnetResponse struct {
 	Message string `json:"message,omitempty"`
+	JobId   string `json:"job_id,omitempty"`
+	Id      string `json:"id,omitempty"` // Торрент, добавленный из .torrent файла по ссылке
 }
 
+// magnet добавляет торрент по магнет-ссылке или http(s) ссылке на .torrent файл
 func (server *Server) magnet(w http.ResponseWriter, r *http.Request) {
 	uri := r.URL.Query().Get("uri")
 	if uri == "" {
@@ -26,30 +36,114 @@ func (server *Server) magnet(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	files := formFiles(r)
+	if isHTTPURL(uri) {
+		server.addLink(w, r, user.ID, uri, files)
+		return
+	}
+
 	if !strings.HasPrefix(uri, "magnet:") {
 		server.respond(w, MagnetResponse{Message: "Unsupported URI format"}, http.StatusBadRequest)
 		return
 	}
 
-	torrentInfo, err := server.torrentManager.AddMagnet(uri)
-
+	job, err := server.addMagnet(user.ID, uri, files)
 	if err != nil {
 		server.respond(w, MagnetResponse{Message: "Error adding torrent: " + err.Error()}, http.StatusBadRequest)
 		return
 	}
 
-	if torrentInfo == nil {
-		server.respond(w, MagnetResponse{Message: "Error adding torrent"}, http.StatusBadRequest)
-		return
+	server.respond(w, MagnetResponse{Message: "Loading torrent info", JobId: job.Id}, http.StatusAccepted)
+}
+
+// addLink отвечает на добавление торрента по http(s) ссылке. Ссылка,
+// перенаправившая на магнет-ссылку, обрабатывается как /api/magnet.
+func (server *Server) addLink(w http.ResponseWriter, r *http.Request, ownerId primitive.ObjectID, link string, files []string) {
+	info, job, err := server.addURL(r.Context(), ownerId, link, files)
+	switch {
+	case errors.Is(err, errNotTorrent) || errors.Is(err, errTorrentTooLarge):
+		server.respond(w, MagnetResponse{Message: "Error adding torrent: " + err.Error()}, http.StatusUnprocessableEntity)
+	case err != nil:
+		server.respond(w, MagnetResponse{Message: "Error adding torrent: " + err.Error()}, http.StatusBadRequest)
+	case job != nil:
+		server.respond(w, MagnetResponse{Message: "Loading torrent info", JobId: job.Id}, http.StatusAccepted)
+	default:
+		server.respond(w, MagnetResponse{Message: "Files added", Id: info.Id}, http.StatusOK)
+	}
+}
+
+// addMagnet добавляет магнет-ссылку в библиотеку пользователя с выбранными файлами
+// (nil — все файлы). Метаданные загружаются в фоне, результат сохраняет watchJob.
+func (server *Server) addMagnet(ownerId primitive.ObjectID, uri string, files []string) (*torrent.Job, error) {
+	if len(files) > 0 {
+		if m, err := metainfo.ParseMagnetUri(uri); err == nil {
+			server.preselectFiles(m.InfoHash.HexString(), files)
+		}
+	}
+
+	job, err := server.torrentManager.AddMagnetAsync(uri)
+	if err != nil {
+		return nil, err
 	}
+	server.torrentManager.Touch(job.Hash)
 
 	log.Printf("Loading torrent info...")
 
-	err = server.torrentStore.CreateTorrent(user.ID, torrentInfo, uri, true)
+	err = server.torrentStore.CreateTorrent(&database.Torrent{
+		OwnerId:     ownerId,
+		Hash:        job.Hash,
+		TorrentFile: uri,
+		IsMagnet:    true,
+		State:       torrent.JobPendingMetadata,
+		Files:       files,
+		TorrentInfo: &torrent.TorrentInfo{Id: job.Hash, Name: job.Name, Files: []*torrent.FileInfo{}},
+	})
 	if err != nil {
-		server.respond(w, MagnetResponse{Message: "Error adding torrent: " + err.Error()}, http.StatusBadRequest)
+		if err := server.torrentManager.CancelJob(job.Id); err != nil && !errors.Is(err, torrent.ErrJobFinished) {
+			log.Printf("Failed to cancel job %s: %v", job.Id, err)
+		}
+		return nil, err
+	}
+	if err := server.applySelection(job.Hash); err != nil {
+		log.Printf("Failed to apply file selection for %s: %v", job.Hash, err)
+	}
+	if err := server.applySeedPolicy(job.Hash); err != nil {
+		log.Printf("Failed to apply seeding policy for %s: %v", job.Hash, err)
+	}
+
+	server.torrentManager.Publish(torrent.Event{Type: torrent.EventAdded, Hash: job.Hash, Owner: ownerId.Hex()})
+	go server.watchJob(ownerId, job)
+
+	return job, nil
+}
+
+// watchJob сохраняет результат добавления магнет-ссылки в библиотеку
+func (server *Server) watchJob(ownerId primitive.ObjectID, job *torrent.Job) {
+	<-job.Done()
+
+	job, ok := server.torrentManager.GetJob(job.Id)
+	if !ok {
 		return
 	}
 
-	server.respond(w, MagnetResponse{Message: "Files added"}, http.StatusOK)
+	var err error
+	switch job.State {
+	case torrent.JobReady:
+		err = server.torrentStore.UpdateTorrentInfo(job.Hash, job.Torrent, job.State)
+		go server.probeMedia(job.Hash)
+		server.torrentManager.Publish(torrent.Event{Type: torrent.EventMetadata, Hash: job.Hash, Owner: ownerId.Hex(), Torrent: job.Torrent})
+	case torrent.JobCancelled:
+		err = server.torrentStore.DeleteTorrent(ownerId, job.Hash)
+	default:
+		err = server.torrentStore.UpdateTorrentState(ownerId, job.Hash, job.State, job.Error)
+		// Раздача из ленты будет добавлена повторно, а другие варианты серии больше не пропускаются
+		if err := server.feedStore.FailMatches(ownerId, job.Hash, job.Error); err != nil {
+			log.Printf("Failed to mark feed matches for %s: %v", job.Hash, err)
+		}
+		server.torrentManager.Publish(torrent.Event{Type: torrent.EventError, Hash: job.Hash, Owner: ownerId.Hex(), Error: job.Error})
+	}
+
+	if err != nil {
+		log.Printf("Failed to save job %s result: %v", job.Id, err)
+	}
 }
@@ -0,0 +1,57 @@
+package server
+
+import (
+	"net/http"
+
+	"retreat-backend/internal/database"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type MatchesResponse struct {
+	Message string                `json:"message,omitempty"`
+	Matches []*database.FeedMatch `json:"matches,omitempty"`
+	Total   int64                 `json:"total"`
+	Offset  int64                 `json:"offset"`
+	Limit   int64                 `json:"limit"`
+}
+
+// feedMatches возвращает страницу истории раздач, подошедших под правила лент
+// пользователя, недавние первыми. Параметр id ограничивает историю одной лентой.
+func (server *Server) feedMatches(w http.ResponseWriter, r *http.Request) {
+	email, _ := r.Context().Value(userEmailKey).(string)
+	user, err := server.userStore.GetUserByEmail(email)
+	if err != nil {
+		server.respond(w, MatchesResponse{Message: "unauthorized"}, http.StatusUnauthorized)
+		return
+	}
+
+	var feedId primitive.ObjectID
+	if id := r.URL.Query().Get("id"); id != "" {
+		feedId, err = primitive.ObjectIDFromHex(id)
+		if err != nil {
+			server.respond(w, MatchesResponse{Message: "invalid id"}, http.StatusBadRequest)
+			return
+		}
+	}
+
+	offset, ok := queryInt(r, "offset", 0)
+	if !ok || offset < 0 {
+		server.respond(w, MatchesResponse{Message: "invalid offset"}, http.StatusBadRequest)
+		return
+	}
+	limit, ok := queryInt(r, "limit", defaultHistoryLimit)
+	if !ok || limit <= 0 {
+		server.respond(w, MatchesResponse{Message: "invalid limit"}, http.StatusBadRequest)
+		return
+	}
+	limit = min(limit, maxHistoryLimit)
+
+	matches, total, err := server.feedStore.GetMatches(user.ID, feedId, offset, limit)
+	if err != nil {
+		server.respond(w, MatchesResponse{Message: err.Error()}, http.StatusInternalServerError)
+		return
+	}
+
+	server.respond(w, MatchesResponse{Matches: matches, Total: total, Offset: offset, Limit: limit}, http.StatusOK)
+}
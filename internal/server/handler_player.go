@@ -0,0 +1,163 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"retreat-backend/internal/database"
+	"retreat-backend/internal/player"
+)
+
+// Действия с плеером
+const (
+	playerPlay     = "play"
+	playerPause    = "pause"
+	playerResume   = "resume"
+	playerSeek     = "seek"
+	playerVolume   = "volume"
+	playerAudio    = "audio"
+	playerSubtitle = "subtitle"
+	playerStop     = "stop"
+)
+
+type PlayerRequest struct {
+	Action string  `json:"action"`
+	Id     string  `json:"id,omitempty"`      // Торрент для play
+	FileId string  `json:"file_id,omitempty"` // Файл для play
+	Value  float64 `json:"value,omitempty"`   // Позиция в секундах, громкость или номер дорожки
+}
+
+type PlayerResponse struct {
+	Message string        `json:"message,omitempty"`
+	State   *player.State `json:"state,omitempty"`
+}
+
+// player возвращает состояние плеера на сервере (GET) или выполняет
+// действие с ним (POST): воспроизведение файла торрента, пауза, перемотка,
+// громкость, выбор дорожек и остановка
+func (server *Server) player(w http.ResponseWriter, r *http.Request) {
+	email, _ := r.Context().Value(userEmailKey).(string)
+	user, err := server.userStore.GetUserByEmail(email)
+	if err != nil {
+		server.respond(w, PlayerResponse{Message: "unauthorized"}, http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		state, err := server.mediaPlayer.State(r.Context())
+		if err != nil {
+			server.respond(w, PlayerResponse{Message: err.Error()}, http.StatusInternalServerError)
+			return
+		}
+		server.respond(w, PlayerResponse{State: state}, http.StatusOK)
+		return
+	case http.MethodPost:
+	default:
+		server.respond(w, PlayerResponse{Message: "Method not allowed"}, http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req PlayerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		server.respond(w, PlayerResponse{Message: "Invalid JSON"}, http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	switch req.Action {
+	case playerPlay:
+		t, err := server.torrentStore.GetTorrent(user.ID, req.Id)
+		if err != nil {
+			server.respond(w, PlayerResponse{Message: "torrent not found"}, http.StatusNotFound)
+			return
+		}
+		if err := server.restoreTorrent(t); err != nil {
+			server.respond(w, PlayerResponse{Message: "torrent not found"}, http.StatusNotFound)
+			return
+		}
+
+		media, ok := server.playerMedia(t, req.FileId)
+		if !ok {
+			server.respond(w, PlayerResponse{Message: "file not found"}, http.StatusNotFound)
+			return
+		}
+
+		// Плеер получает файл через поток сервера, поэтому нужные части загружаются в приоритете
+		token, err := server.generateJWT(email)
+		if err != nil {
+			server.respond(w, PlayerResponse{Message: "Failed to issue token"}, http.StatusInternalServerError)
+			return
+		}
+		query := url.Values{"id": {t.Hash}, "fileId": {req.FileId}, "token": {token}}
+		streamURL := server.url + "/api/stream?" + query.Encode()
+
+		err = server.mediaPlayer.Play(ctx, streamURL, media, seconds(req.Value))
+	case playerPause:
+		err = server.mediaPlayer.Pause(ctx, true)
+	case playerResume:
+		err = server.mediaPlayer.Pause(ctx, false)
+	case playerSeek:
+		err = server.mediaPlayer.Seek(ctx, seconds(req.Value))
+	case playerVolume:
+		if req.Value < 0 {
+			server.respond(w, PlayerResponse{Message: "invalid volume"}, http.StatusBadRequest)
+			return
+		}
+		err = server.mediaPlayer.SetVolume(ctx, req.Value)
+	case playerAudio:
+		err = server.mediaPlayer.SetAudio(ctx, int(req.Value))
+	case playerSubtitle:
+		err = server.mediaPlayer.SetSubtitle(ctx, int(req.Value))
+	case playerStop:
+		err = server.mediaPlayer.Stop(ctx)
+	default:
+		server.respond(w, PlayerResponse{Message: "unknown action"}, http.StatusBadRequest)
+		return
+	}
+
+	switch {
+	case err == nil:
+	case errors.Is(err, player.ErrNotRunning):
+		server.respond(w, PlayerResponse{Message: err.Error()}, http.StatusConflict)
+		return
+	default:
+		server.respond(w, PlayerResponse{Message: err.Error()}, http.StatusBadGateway)
+		return
+	}
+
+	state, err := server.mediaPlayer.State(ctx)
+	if err != nil {
+		server.respond(w, PlayerResponse{Message: err.Error()}, http.StatusInternalServerError)
+		return
+	}
+	server.respond(w, PlayerResponse{State: state}, http.StatusOK)
+}
+
+// playerMedia описывает файл торрента для плеера. Файлы, не выбранные
+// пользователем, не воспроизводятся, как и в /api/stream.
+func (server *Server) playerMedia(t *database.Torrent, fileId string) (player.Media, bool) {
+	if !fileSelected(t, fileId) {
+		return player.Media{}, false
+	}
+
+	info, ok := server.torrentManager.GetTorrent(t.Hash)
+	if !ok {
+		return player.Media{}, false
+	}
+
+	for _, f := range info.Files {
+		if f.Id == fileId {
+			return player.Media{TorrentId: t.Hash, FileId: fileId, Title: f.Name}, true
+		}
+	}
+
+	return player.Media{}, false
+}
+
+func seconds(value float64) time.Duration {
+	return time.Duration(max(value, 0) * float64(time.Second))
+}
@@ -0,0 +1,85 @@
+package server
+
+import (
+	"log"
+	"net/http"
+
+	"retreat-backend/internal/probe"
+	"retreat-backend/internal/torrent"
+)
+
+type ProbeResponse struct {
+	Message string `json:"message,omitempty"`
+}
+
+// probe возвращает сведения о медиафайле: длительность, кодеки и дорожки.
+// Если файл еще не разобран, заголовки читаются через торрент.
+func (server *Server) probe(w http.ResponseWriter, r *http.Request) {
+	email, _ := r.Context().Value(userEmailKey).(string)
+	user, err := server.userStore.GetUserByEmail(email)
+	if err != nil {
+		server.respond(w, ProbeResponse{Message: "unauthorized"}, http.StatusUnauthorized)
+		return
+	}
+
+	id := r.URL.Query().Get("id")
+	fileId := r.URL.Query().Get("fileId")
+
+	t, err := server.torrentStore.GetTorrent(user.ID, id)
+	if err != nil {
+		server.respond(w, ProbeResponse{Message: "torrent not found"}, http.StatusNotFound)
+		return
+	}
+	if !fileSelected(t, fileId) {
+		server.respond(w, ProbeResponse{Message: "file not found"}, http.StatusNotFound)
+		return
+	}
+
+	if info, ok := t.Media[fileId]; ok {
+		server.respond(w, info, http.StatusOK)
+		return
+	}
+
+	if err := server.restoreTorrent(t); err != nil {
+		server.respond(w, ProbeResponse{Message: "Error restoring torrent: " + err.Error()}, http.StatusInternalServerError)
+		return
+	}
+
+	info, err := server.torrentManager.ProbeFile(t.Hash, fileId)
+	if err != nil {
+		server.respond(w, ProbeResponse{Message: err.Error()}, http.StatusUnprocessableEntity)
+		return
+	}
+
+	if err := server.torrentStore.SetMediaInfo(t.Hash, fileId, info); err != nil {
+		log.Printf("Failed to save media info for %s: %v", fileId, err)
+	}
+
+	server.respond(w, info, http.StatusOK)
+}
+
+// probeMedia разбирает в фоне заголовки видеофайлов торрента и сохраняет
+// результаты в библиотеке
+func (server *Server) probeMedia(hash string) {
+	for fileId, info := range server.torrentManager.ProbeTorrent(hash) {
+		if err := server.torrentStore.SetMediaInfo(hash, fileId, info); err != nil {
+			log.Printf("Failed to save media info for %s: %v", fileId, err)
+		}
+	}
+}
+
+// withMedia дополняет сохраненную информацию о торренте сведениями о файлах
+// из библиотеки, когда торрент не загружен в клиент
+func withMedia(info *torrent.TorrentInfo, media map[string]*probe.MediaInfo) *torrent.TorrentInfo {
+	if info == nil {
+		return nil
+	}
+
+	for _, f := range info.Files {
+		if m, ok := media[f.Id]; ok {
+			f.Media = m
+		}
+	}
+
+	return info
+}
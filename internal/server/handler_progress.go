@@ -0,0 +1,170 @@
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+
+	"retreat-backend/internal/database"
+	"retreat-backend/internal/torrent"
+)
+
+type ProgressRequest struct {
+	Id       string  `json:"id"`
+	FileId   string  `json:"file_id"`
+	Position float64 `json:"position"`
+	Duration float64 `json:"duration"`
+	Watched  *bool   `json:"watched,omitempty"` // Явная отметка; без нее файл отмечается, когда досмотрен
+}
+
+type ProgressResponse struct {
+	Message    string                            `json:"message,omitempty"`
+	LastFileId string                            `json:"last_file_id,omitempty"`
+	Progress   map[string]*torrent.WatchProgress `json:"progress,omitempty"`
+}
+
+// progress возвращает (GET) прогресс просмотра файлов торрента или сохраняет (POST)
+// позицию просмотра файла. Сохраненный файл становится последним просмотренным.
+func (server *Server) progress(w http.ResponseWriter, r *http.Request) {
+	email, _ := r.Context().Value(userEmailKey).(string)
+	user, err := server.userStore.GetUserByEmail(email)
+	if err != nil {
+		server.respond(w, ProgressResponse{Message: "unauthorized"}, http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		t, err := server.torrentStore.GetTorrent(user.ID, r.URL.Query().Get("id"))
+		if err != nil {
+			server.respond(w, ProgressResponse{Message: "torrent not found"}, http.StatusNotFound)
+			return
+		}
+		server.respond(w, ProgressResponse{LastFileId: t.LastFileId, Progress: t.Progress}, http.StatusOK)
+		return
+	case http.MethodPost:
+	default:
+		server.respond(w, ProgressResponse{Message: "Method not allowed"}, http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req ProgressRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		server.respond(w, ProgressResponse{Message: "Invalid JSON"}, http.StatusBadRequest)
+		return
+	}
+	if req.FileId == "" || req.Position < 0 || req.Duration < 0 {
+		server.respond(w, ProgressResponse{Message: "invalid progress"}, http.StatusBadRequest)
+		return
+	}
+
+	t, err := server.torrentStore.GetTorrent(user.ID, req.Id)
+	if err != nil {
+		server.respond(w, ProgressResponse{Message: "torrent not found"}, http.StatusNotFound)
+		return
+	}
+	if !hasFile(t, req.FileId) || !fileSelected(t, req.FileId) {
+		server.respond(w, ProgressResponse{Message: "file not found"}, http.StatusNotFound)
+		return
+	}
+
+	progress := &torrent.WatchProgress{
+		Position:  req.Position,
+		Duration:  req.Duration,
+		UpdatedAt: time.Now(),
+	}
+
+	// Отметка о просмотре сохраняется при повторном просмотре, пока ее не снимут явно
+	switch {
+	case req.Watched != nil:
+		progress.Watched = *req.Watched
+	case progress.Finished():
+		progress.Watched = true
+	default:
+		if prev, ok := t.Progress[req.FileId]; ok {
+			progress.Watched = prev.Watched
+		}
+	}
+
+	if err := server.torrentStore.SetProgress(user.ID, t.Hash, req.FileId, progress); err != nil {
+		server.respond(w, ProgressResponse{Message: err.Error()}, http.StatusInternalServerError)
+		return
+	}
+
+	entry := &database.HistoryEntry{
+		UserId:    user.ID,
+		Hash:      t.Hash,
+		FileId:    req.FileId,
+		Position:  progress.Position,
+		Duration:  progress.Duration,
+		Watched:   progress.Watched,
+		WatchedAt: progress.UpdatedAt,
+	}
+	entry.TorrentName, entry.FileName = fileNames(t, req.FileId)
+	if err := server.historyStore.RecordView(entry); err != nil {
+		log.Printf("Failed to record history for %s: %v", t.Hash, err)
+	}
+
+	server.respond(w, ProgressResponse{
+		Message:    "Progress saved",
+		LastFileId: req.FileId,
+		Progress:   map[string]*torrent.WatchProgress{req.FileId: progress},
+	}, http.StatusOK)
+}
+
+// hasFile проверяет, что файл относится к торренту. Пока метаданные
+// не получены, список файлов неизвестен и файл не принимается: идентификатор
+// становится частью пути в документе и не может быть произвольным.
+func hasFile(t *database.Torrent, fileId string) bool {
+	if t.TorrentInfo == nil {
+		return false
+	}
+
+	for _, f := range t.TorrentInfo.Files {
+		if f.Id == fileId {
+			return true
+		}
+	}
+
+	return false
+}
+
+// fileNames возвращает названия торрента и файла из записи библиотеки
+func fileNames(t *database.Torrent, fileId string) (string, string) {
+	if t.TorrentInfo == nil {
+		return "", ""
+	}
+
+	for _, f := range t.TorrentInfo.Files {
+		if f.Id == fileId {
+			return t.TorrentInfo.Name, f.Name
+		}
+	}
+
+	return t.TorrentInfo.Name, ""
+}
+
+// withProgress дополняет информацию о торренте прогрессом просмотра и закреплением
+// файлов пользователя и скрывает файлы, не выбранные пользователем
+func withProgress(info *torrent.TorrentInfo, t *database.Torrent) *torrent.TorrentInfo {
+	if info == nil {
+		return nil
+	}
+
+	if selected := selectedSet(info, t); selected != nil {
+		info.Files = slices.DeleteFunc(info.Files, func(f *torrent.FileInfo) bool {
+			return !selected[f.Id]
+		})
+	}
+	info.LastFileId = t.LastFileId
+	for _, f := range info.Files {
+		if p, ok := t.Progress[f.Id]; ok {
+			f.Watch = p
+		}
+		f.Pinned = slices.Contains(t.PinnedFiles, f.Id)
+	}
+
+	return info
+}
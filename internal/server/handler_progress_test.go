@@ -0,0 +1,34 @@
+package server
+
+import (
+	"testing"
+
+	"retreat-backend/internal/database"
+	"retreat-backend/internal/torrent"
+)
+
+func TestHasFile(t *testing.T) {
+	const fileId = "0123456789abcdef0123456789abcdef"
+	loaded := &database.Torrent{TorrentInfo: &torrent.TorrentInfo{Files: []*torrent.FileInfo{{Id: fileId}}}}
+
+	tests := []struct {
+		name    string
+		torrent *database.Torrent
+		fileId  string
+		want    bool
+	}{
+		{"file of torrent", loaded, fileId, true},
+		{"unknown file", loaded, "fedcba9876543210fedcba9876543210", false},
+		{"field path", loaded, "a.b", false},
+		{"metadata not loaded", &database.Torrent{}, fileId, false},
+		{"no files yet", &database.Torrent{TorrentInfo: &torrent.TorrentInfo{}}, "$set", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hasFile(tt.torrent, tt.fileId); got != tt.want {
+				t.Errorf("hasFile(%q) = %v, want %v", tt.fileId, got, tt.want)
+			}
+		})
+	}
+}
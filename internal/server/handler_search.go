@@ -0,0 +1,109 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"retreat-backend/internal/search"
+)
+
+const (
+	defaultSearchLimit = 50
+	maxSearchLimit     = 200
+)
+
+type SearchResponse struct {
+	Message string            `json:"message,omitempty"`
+	Results []search.Result   `json:"results,omitempty"`
+	Errors  map[string]string `json:"errors,omitempty"`
+}
+
+// SearchAddRequest содержит поля найденного результата, достаточные для добавления
+type SearchAddRequest struct {
+	Title    string   `json:"title"`
+	InfoHash string   `json:"info_hash"`
+	Magnet   string   `json:"magnet"`
+	Link     string   `json:"link"`
+	Files    []string `json:"files,omitempty"` // Выбранные файлы из /api/inspect, без них выбираются все
+}
+
+// search ищет раздачи во всех подключенных источниках (параметры q, category, limit).
+// Результаты одной раздачи из разных источников объединяются.
+func (server *Server) search(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		server.respond(w, SearchResponse{Message: "Missing query"}, http.StatusBadRequest)
+		return
+	}
+
+	limit, ok := queryInt(r, "limit", defaultSearchLimit)
+	if !ok || limit <= 0 {
+		server.respond(w, SearchResponse{Message: "invalid limit"}, http.StatusBadRequest)
+		return
+	}
+
+	res, err := server.searcher.Search(r.Context(), search.Query{
+		Text:     query,
+		Category: r.URL.Query().Get("category"),
+		Limit:    int(min(limit, maxSearchLimit)),
+	})
+	if errors.Is(err, search.ErrNoProviders) {
+		server.respond(w, SearchResponse{Message: err.Error()}, http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		server.respond(w, SearchResponse{Message: err.Error()}, http.StatusBadGateway)
+		return
+	}
+
+	server.respond(w, SearchResponse{Results: res.Results, Errors: res.Errors}, http.StatusOK)
+}
+
+// searchAdd добавляет найденный результат в библиотеку одним запросом.
+// Магнет-ссылка берется из результата или собирается по info hash,
+// без нее загружается .torrent файл по ссылке подключенного индексатора.
+func (server *Server) searchAdd(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		server.respond(w, MagnetResponse{Message: "Method not allowed"}, http.StatusMethodNotAllowed)
+		return
+	}
+
+	email, _ := r.Context().Value(userEmailKey).(string)
+	user, err := server.userStore.GetUserByEmail(email)
+	if err != nil {
+		server.respond(w, MagnetResponse{Message: "unauthorized"}, http.StatusUnauthorized)
+		return
+	}
+
+	var req SearchAddRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		server.respond(w, MagnetResponse{Message: "Invalid JSON"}, http.StatusBadRequest)
+		return
+	}
+
+	result := search.Result{Title: req.Title, InfoHash: req.InfoHash, Magnet: req.Magnet}
+	uri := result.MagnetURI()
+	if !strings.HasPrefix(uri, "magnet:") {
+		if !isHTTPURL(req.Link) {
+			server.respond(w, MagnetResponse{Message: "result has no magnet link or torrent link"}, http.StatusUnprocessableEntity)
+			return
+		}
+		if _, ok := server.searcher.Resolve(req.Link); !ok {
+			server.respond(w, MagnetResponse{Message: "link is not from a configured indexer"}, http.StatusBadRequest)
+			return
+		}
+
+		server.addLink(w, r, user.ID, req.Link, req.Files)
+		return
+	}
+
+	job, err := server.addMagnet(user.ID, uri, req.Files)
+	if err != nil {
+		server.respond(w, MagnetResponse{Message: "Error adding torrent: " + err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	server.respond(w, MagnetResponse{Message: "Loading torrent info", JobId: job.Id}, http.StatusAccepted)
+}
@@ -0,0 +1,102 @@
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"retreat-backend/internal/torrent"
+)
+
+type SeedingResponse struct {
+	Message string              `json:"message,omitempty"`
+	Policy  *torrent.SeedPolicy `json:"policy,omitempty"`
+	Custom  bool                `json:"custom"`
+	State   torrent.SeedState   `json:"state,omitempty"`
+}
+
+// seeding возвращает (GET), переопределяет (POST) или сбрасывает к общей (DELETE)
+// политику раздачи торрента
+func (server *Server) seeding(w http.ResponseWriter, r *http.Request) {
+	email, _ := r.Context().Value(userEmailKey).(string)
+	user, err := server.userStore.GetUserByEmail(email)
+	if err != nil {
+		server.respond(w, SeedingResponse{Message: "unauthorized"}, http.StatusUnauthorized)
+		return
+	}
+
+	id := r.URL.Query().Get("id")
+
+	t, err := server.torrentStore.GetTorrent(user.ID, id)
+	if err != nil {
+		server.respond(w, SeedingResponse{Message: "torrent not found"}, http.StatusNotFound)
+		return
+	}
+
+	var policy *torrent.SeedPolicy
+	switch r.Method {
+	case http.MethodGet:
+		effective := server.torrentManager.SeedPolicyFor(t.Hash)
+		server.respond(w, SeedingResponse{
+			Policy: &effective,
+			Custom: t.SeedPolicy != nil,
+			State:  server.torrentManager.SeedStateFor(t.Hash),
+		}, http.StatusOK)
+		return
+	case http.MethodPost:
+		policy = &torrent.SeedPolicy{}
+		if err := json.NewDecoder(r.Body).Decode(policy); err != nil {
+			server.respond(w, SeedingResponse{Message: "Invalid JSON"}, http.StatusBadRequest)
+			return
+		}
+	case http.MethodDelete:
+	default:
+		server.respond(w, SeedingResponse{Message: "Method not allowed"}, http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := server.torrentStore.SetSeedPolicy(user.ID, t.Hash, policy); err != nil {
+		server.respond(w, SeedingResponse{Message: err.Error()}, http.StatusInternalServerError)
+		return
+	}
+
+	if err := server.applySeedPolicy(t.Hash); err != nil {
+		server.respond(w, SeedingResponse{Message: err.Error()}, http.StatusInternalServerError)
+		return
+	}
+
+	server.respond(w, SeedingResponse{Message: "Seeding policy updated"}, http.StatusOK)
+}
+
+// seedingFinished сохраняет итог раздачи в записях библиотеки
+func (server *Server) seedingFinished(result torrent.SeedResult) {
+	if err := server.torrentStore.UpdateSeedState(result.Hash, result.State, result.Ratio); err != nil {
+		log.Printf("Failed to save seeding result for %s: %v", result.Hash, err)
+	}
+}
+
+// seedingStarted сохраняет начало раздачи, чтобы отсчет продолжался после перезапуска
+func (server *Server) seedingStarted(hash string, started time.Time) {
+	if err := server.torrentStore.SetSeedStarted(hash, started); err != nil {
+		log.Printf("Failed to save seeding start for %s: %v", hash, err)
+	}
+}
+
+// seedUploaded сохраняет объем отданных данных, чтобы рейтинг учитывал прошлые сеансы
+func (server *Server) seedUploaded(hash string, uploaded int64) {
+	if err := server.torrentStore.SetSeedUploaded(hash, uploaded); err != nil {
+		log.Printf("Failed to save uploaded bytes for %s: %v", hash, err)
+	}
+}
+
+// applySeedPolicy задает в клиенте политику раздачи, объединенную по всем пользователям торрента
+func (server *Server) applySeedPolicy(hash string) error {
+	policies, err := server.torrentStore.GetSeedPolicies(hash)
+	if err != nil {
+		return err
+	}
+
+	server.torrentManager.SetSeedPolicy(hash, policies)
+	return nil
+}
@@ -1,7 +1,23 @@
 package server
 
 import (
+	"context"
+	"errors"
 	"net/http"
+	"strconv"
+	"time"
+
+	"retreat-backend/internal/mkv"
+	"retreat-backend/internal/remux"
+	"retreat-backend/internal/torrent"
+	"retreat-backend/internal/transcode"
+)
+
+const (
+	// streamModeRemux включает перепаковку Matroska во фрагментированный MP4
+	streamModeRemux = "remux"
+	// streamModeTranscode включает перекодирование внешним перекодировщиком
+	streamModeTranscode = "transcode"
 )
 
 type StreamResponse struct {
@@ -24,23 +40,98 @@ func (server *Server) stream(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, isHave := server.torrentManager.GetTorrent(torrent.Hash)
-	if !isHave {
-		if torrent.IsMagnet {
-			_, err := server.torrentManager.AddMagnet(torrent.TorrentFile)
-			if err != nil {
-				server.respond(w, StreamResponse{Message: "torrent not found"}, http.StatusNotFound)
-				return
-			}
-		} else {
-			server.respond(w, StreamResponse{Message: "torrent not found"}, http.StatusNotFound)
-			return
-		}
+	if !fileSelected(torrent, fileId) {
+		server.respond(w, StreamResponse{Message: "file not found"}, http.StatusNotFound)
+		return
+	}
+
+	if err := server.restoreTorrent(torrent); err != nil {
+		server.respond(w, StreamResponse{Message: "torrent not found"}, http.StatusNotFound)
+		return
 	}
 
-	info, ok := server.torrentManager.Stream(w, r, id, fileId)
+	switch r.URL.Query().Get("mode") {
+	case streamModeRemux:
+		server.streamRemux(w, r, email, id, fileId)
+		return
+	case streamModeTranscode:
+		server.streamTranscode(w, r, email, id, fileId)
+		return
+	}
+
+	info, ok := server.torrentManager.Stream(server.limitWriter(w, r, email), r, id, fileId)
 	if !ok {
 		server.respond(w, StreamResponse{Message: info}, http.StatusNotFound)
 		return
 	}
 }
+
+// streamRemux отдает MKV как фрагментированный MP4. Параметры: audio — номер
+// аудиодорожки среди аудиодорожек файла, start — время начала в секундах.
+func (server *Server) streamRemux(w http.ResponseWriter, r *http.Request, email string, id string, fileId string) {
+	audio, start, ok := server.streamParams(w, r)
+	if !ok {
+		return
+	}
+	opts := remux.Options{Audio: audio, Start: start}
+
+	err := server.torrentManager.StreamRemux(server.limitWriter(w, r, email), r, id, fileId, opts)
+	switch {
+	case err == nil:
+	case errors.Is(err, remux.ErrUnsupportedCodec), errors.Is(err, remux.ErrTrackNotFound), errors.Is(err, mkv.ErrInvalidElement):
+		server.respond(w, StreamResponse{Message: err.Error()}, http.StatusUnprocessableEntity)
+	default:
+		server.respond(w, StreamResponse{Message: err.Error()}, http.StatusNotFound)
+	}
+}
+
+// streamTranscode отдает файл, перекодированный во фрагментированный MP4.
+// Параметры: profile — профиль перекодирования, audio и start — как в режиме remux.
+func (server *Server) streamTranscode(w http.ResponseWriter, r *http.Request, email string, id string, fileId string) {
+	audio, start, ok := server.streamParams(w, r)
+	if !ok {
+		return
+	}
+	opts := transcode.Options{
+		Profile: r.URL.Query().Get("profile"),
+		Audio:   audio,
+		Start:   start,
+	}
+
+	err := server.torrentManager.StreamTranscode(server.limitWriter(w, r, email), r, id, fileId, opts)
+	switch {
+	case err == nil:
+	case errors.Is(err, transcode.ErrUnknownProfile):
+		server.respond(w, StreamResponse{Message: err.Error()}, http.StatusBadRequest)
+	case errors.Is(err, transcode.ErrBusy), errors.Is(err, torrent.ErrTranscoderDisabled):
+		server.respond(w, StreamResponse{Message: err.Error()}, http.StatusServiceUnavailable)
+	case errors.Is(err, context.Canceled):
+	default:
+		server.respond(w, StreamResponse{Message: err.Error()}, http.StatusNotFound)
+	}
+}
+
+// streamParams разбирает номер аудиодорожки (-1, если не задан) и время начала
+func (server *Server) streamParams(w http.ResponseWriter, r *http.Request) (int, time.Duration, bool) {
+	audio := -1
+	if value := r.URL.Query().Get("audio"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			server.respond(w, StreamResponse{Message: "invalid audio"}, http.StatusBadRequest)
+			return 0, 0, false
+		}
+		audio = n
+	}
+
+	var start time.Duration
+	if value := r.URL.Query().Get("start"); value != "" {
+		seconds, err := strconv.ParseFloat(value, 64)
+		if err != nil || seconds < 0 {
+			server.respond(w, StreamResponse{Message: "invalid start"}, http.StatusBadRequest)
+			return 0, 0, false
+		}
+		start = time.Duration(seconds * float64(time.Second))
+	}
+
+	return audio, start, true
+}
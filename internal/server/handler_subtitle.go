@@ -0,0 +1,79 @@
+package server
+
+import (
+	"net/http"
+	"path"
+	"strconv"
+	"time"
+
+	"retreat-backend/internal/subtitles"
+)
+
+type SubtitleResponse struct {
+	Message string `json:"message,omitempty"`
+}
+
+func (server *Server) subtitle(w http.ResponseWriter, r *http.Request) {
+	email, _ := r.Context().Value(userEmailKey).(string)
+	user, err := server.userStore.GetUserByEmail(email)
+	if err != nil {
+		server.respond(w, SubtitleResponse{Message: "unauthorized"}, http.StatusUnauthorized)
+		return
+	}
+
+	id := r.URL.Query().Get("id")
+	fileId := r.URL.Query().Get("fileId")
+
+	// Смещение в секундах для рассинхронизированных субтитров, может быть отрицательным
+	var offset time.Duration
+	if v := r.URL.Query().Get("offset"); v != "" {
+		seconds, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			server.respond(w, SubtitleResponse{Message: "invalid offset"}, http.StatusBadRequest)
+			return
+		}
+		offset = time.Duration(seconds * float64(time.Second))
+	}
+
+	t, err := server.torrentStore.GetTorrent(user.ID, id)
+	if err != nil {
+		server.respond(w, SubtitleResponse{Message: "torrent not found"}, http.StatusNotFound)
+		return
+	}
+
+	if err := server.restoreTorrent(t); err != nil {
+		server.respond(w, SubtitleResponse{Message: "torrent not found"}, http.StatusNotFound)
+		return
+	}
+
+	// Субтитры доступны, если выбраны они сами или видео, к которому они относятся
+	if info, ok := server.torrentManager.GetTorrent(t.Hash); ok {
+		if selected := selectedSet(info, t); selected != nil && !selected[fileId] {
+			server.respond(w, SubtitleResponse{Message: "subtitle not found"}, http.StatusNotFound)
+			return
+		}
+	}
+
+	data, name, err := server.torrentManager.ReadSubtitle(t.Hash, fileId)
+	if err != nil {
+		server.respond(w, SubtitleResponse{Message: err.Error()}, http.StatusNotFound)
+		return
+	}
+
+	format, ok := subtitles.FormatFromExt(path.Ext(name))
+	if !ok {
+		server.respond(w, SubtitleResponse{Message: "unsupported subtitle format"}, http.StatusBadRequest)
+		return
+	}
+
+	vtt, err := subtitles.ToWebVTT(data, format, offset)
+	if err != nil {
+		server.respond(w, SubtitleResponse{Message: err.Error()}, http.StatusUnprocessableEntity)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/vtt; charset=utf-8")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte(vtt))
+}
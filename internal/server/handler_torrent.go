@@ -0,0 +1,50 @@
+package server
+
+import (
+	"net/http"
+
+	"retreat-backend/internal/database"
+	"retreat-backend/internal/torrent"
+)
+
+type TorrentResponse struct {
+	Message string `json:"message,omitempty"`
+}
+
+// torrent возвращает подробную информацию о торренте пользователя, включая статистику передачи
+func (server *Server) torrent(w http.ResponseWriter, r *http.Request) {
+	email, _ := r.Context().Value(userEmailKey).(string)
+	user, err := server.userStore.GetUserByEmail(email)
+	if err != nil {
+		server.respond(w, TorrentResponse{Message: "unauthorized"}, http.StatusUnauthorized)
+		return
+	}
+
+	id := r.URL.Query().Get("id")
+
+	t, err := server.torrentStore.GetTorrent(user.ID, id)
+	if err != nil {
+		server.respond(w, TorrentResponse{Message: "torrent not found"}, http.StatusNotFound)
+		return
+	}
+
+	info, ok := server.torrentManager.GetTorrentDetails(t.Hash)
+	if !ok {
+		info = storedInfo(t)
+	}
+
+	server.respond(w, withProgress(info, t), http.StatusOK)
+}
+
+// storedInfo возвращает информацию о торренте, сохраненную в библиотеке.
+// У старых записей ее может не быть, тогда известен только hash.
+func storedInfo(t *database.Torrent) *torrent.TorrentInfo {
+	info := withMedia(t.TorrentInfo, t.Media)
+	if info == nil {
+		info = &torrent.TorrentInfo{Id: t.Hash, Files: []*torrent.FileInfo{}}
+	}
+	info.State = t.State
+	info.Error = t.Error
+
+	return info
+}
@@ -0,0 +1,24 @@
+package server
+
+import (
+	"testing"
+
+	"retreat-backend/internal/database"
+	"retreat-backend/internal/torrent"
+)
+
+func TestStoredInfo(t *testing.T) {
+	const hash = "0123456789abcdef0123456789abcdef01234567"
+
+	// Записи, сохраненные до появления torrent_info, не содержат информации о торренте
+	legacy := storedInfo(&database.Torrent{Hash: hash, State: torrent.JobFailed, Error: "metadata timeout"})
+	if legacy.Id != hash || legacy.Files == nil || legacy.State != torrent.JobFailed || legacy.Error != "metadata timeout" {
+		t.Errorf("storedInfo() = %+v", legacy)
+	}
+
+	stored := &torrent.TorrentInfo{Id: hash, Name: "Movie", Files: []*torrent.FileInfo{{Id: "file"}}}
+	info := storedInfo(&database.Torrent{Hash: hash, State: torrent.JobPendingMetadata, TorrentInfo: stored})
+	if info != stored || info.State != torrent.JobPendingMetadata {
+		t.Errorf("storedInfo() = %+v, want the stored info", info)
+	}
+}
@@ -25,12 +25,12 @@ func (server *Server) torrents(w http.ResponseWriter, r *http.Request) {
 	torrentInfos = make([]*torrent.TorrentInfo, 0, len(torrents))
 	for _, t := range torrents {
 		ti, isHave := server.torrentManager.GetTorrent(t.Hash)
-		if !isHave {
-			torrentInfos = append(torrentInfos, t.TorrentInfo)
+		if !isHave || t.State == torrent.JobPendingMetadata {
+			torrentInfos = append(torrentInfos, withProgress(storedInfo(t), t))
 			continue
 		}
 
-		torrentInfos = append(torrentInfos, ti)
+		torrentInfos = append(torrentInfos, withProgress(ti, t))
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -38,5 +38,5 @@ func (server *Server) torrents(w http.ResponseWriter, r *http.Request) {
 	if err := json.NewEncoder(w).Encode(torrentInfos); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 	}
-	log.Printf("%s: %s", http.StatusText(http.StatusOK), torrentInfos)
+	log.Printf("%s: %v", http.StatusText(http.StatusOK), torrentInfos)
 }
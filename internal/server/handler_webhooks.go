@@ -0,0 +1,124 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"slices"
+
+	"retreat-backend/internal/database"
+	"retreat-backend/internal/torrent"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// maxWebhooks ограничивает число вебхуков одного пользователя
+const maxWebhooks = 20
+
+type WebhookRequest struct {
+	URL    string              `json:"url"`
+	Secret string              `json:"secret,omitempty"` // Без секрета он генерируется и возвращается в ответе
+	Events []torrent.EventType `json:"events"`
+}
+
+type WebhooksResponse struct {
+	Message  string              `json:"message,omitempty"`
+	Webhook  *database.Webhook   `json:"webhook,omitempty"`
+	Webhooks []*database.Webhook `json:"webhooks,omitempty"`
+}
+
+// webhooks возвращает вебхуки пользователя (GET), регистрирует новый (POST)
+// или удаляет вебхук по параметру id (DELETE). Секрет возвращается только
+// при регистрации.
+func (server *Server) webhooks(w http.ResponseWriter, r *http.Request) {
+	email, _ := r.Context().Value(userEmailKey).(string)
+	user, err := server.userStore.GetUserByEmail(email)
+	if err != nil {
+		server.respond(w, WebhooksResponse{Message: "unauthorized"}, http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		hooks, err := server.webhookStore.GetWebhooks(user.ID)
+		if err != nil {
+			server.respond(w, WebhooksResponse{Message: err.Error()}, http.StatusInternalServerError)
+			return
+		}
+		for _, hook := range hooks {
+			hook.Secret = ""
+		}
+		server.respond(w, WebhooksResponse{Webhooks: hooks}, http.StatusOK)
+		return
+	case http.MethodDelete:
+		id, err := primitive.ObjectIDFromHex(r.URL.Query().Get("id"))
+		if err != nil {
+			server.respond(w, WebhooksResponse{Message: "invalid id"}, http.StatusBadRequest)
+			return
+		}
+		if err := server.webhookStore.DeleteWebhook(user.ID, id); err != nil {
+			server.respond(w, WebhooksResponse{Message: err.Error()}, http.StatusNotFound)
+			return
+		}
+		server.respond(w, WebhooksResponse{Message: "Webhook deleted"}, http.StatusOK)
+		return
+	case http.MethodPost:
+	default:
+		server.respond(w, WebhooksResponse{Message: "Method not allowed"}, http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req WebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		server.respond(w, WebhooksResponse{Message: "Invalid JSON"}, http.StatusBadRequest)
+		return
+	}
+
+	target, err := url.Parse(req.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		server.respond(w, WebhooksResponse{Message: "invalid url"}, http.StatusBadRequest)
+		return
+	}
+
+	events := make([]torrent.EventType, 0, len(req.Events))
+	for _, event := range req.Events {
+		if !webhookEvents[event] {
+			server.respond(w, WebhooksResponse{Message: "unknown event: " + string(event)}, http.StatusBadRequest)
+			return
+		}
+		if !slices.Contains(events, event) {
+			events = append(events, event)
+		}
+	}
+	if len(events) == 0 {
+		server.respond(w, WebhooksResponse{Message: "no events"}, http.StatusBadRequest)
+		return
+	}
+
+	hooks, err := server.webhookStore.GetWebhooks(user.ID)
+	if err != nil {
+		server.respond(w, WebhooksResponse{Message: err.Error()}, http.StatusInternalServerError)
+		return
+	}
+	if len(hooks) >= maxWebhooks {
+		server.respond(w, WebhooksResponse{Message: "too many webhooks"}, http.StatusConflict)
+		return
+	}
+
+	hook := &database.Webhook{
+		OwnerId: user.ID,
+		URL:     target.String(),
+		Secret:  req.Secret,
+		Events:  events,
+	}
+	if hook.Secret == "" {
+		hook.Secret = generateRandomHex(32)
+	}
+
+	if err := server.webhookStore.CreateWebhook(hook); err != nil {
+		server.respond(w, WebhooksResponse{Message: err.Error()}, http.StatusInternalServerError)
+		return
+	}
+
+	server.respond(w, WebhooksResponse{Message: "Webhook created", Webhook: hook}, http.StatusCreated)
+}
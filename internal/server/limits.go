@@ -0,0 +1,114 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+
+	"golang.org/x/time/rate"
+)
+
+// writeChunk ограничивает размер одной записи при ограничении скорости
+const writeChunk = 64 << 10
+
+// UserLimits содержит ограничения скорости отдачи данных пользователю в байтах в секунду
+type UserLimits struct {
+	StreamRate   int64 `json:"stream_rate"`   // Воспроизведение (запросы с Range, перепакованные и перекодированные потоки, HLS)
+	DownloadRate int64 `json:"download_rate"` // Скачивание файла целиком
+}
+
+// userLimiters хранит ограничители скорости пользователей,
+// общие для всех их одновременных потоков
+type userLimiters struct {
+	mu       sync.Mutex
+	limiters map[string]*userLimiter
+}
+
+type userLimiter struct {
+	stream   *rate.Limiter
+	download *rate.Limiter
+}
+
+func newUserLimiters() *userLimiters {
+	return &userLimiters{limiters: make(map[string]*userLimiter)}
+}
+
+func rateLimit(bytesPerSecond int64) rate.Limit {
+	if bytesPerSecond <= 0 {
+		return rate.Inf
+	}
+	return rate.Limit(bytesPerSecond)
+}
+
+// set применяет ограничения пользователя, в том числе к уже идущим потокам
+func (ul *userLimiters) set(email string, limits UserLimits) {
+	ul.mu.Lock()
+	defer ul.mu.Unlock()
+
+	l, ok := ul.limiters[email]
+	if !ok {
+		ul.limiters[email] = &userLimiter{
+			stream:   rate.NewLimiter(rateLimit(limits.StreamRate), writeChunk),
+			download: rate.NewLimiter(rateLimit(limits.DownloadRate), writeChunk),
+		}
+		return
+	}
+
+	l.stream.SetLimit(rateLimit(limits.StreamRate))
+	l.download.SetLimit(rateLimit(limits.DownloadRate))
+}
+
+// get возвращает ограничитель для запроса пользователя или nil, если ограничений нет
+func (ul *userLimiters) get(email string, r *http.Request) *rate.Limiter {
+	ul.mu.Lock()
+	defer ul.mu.Unlock()
+
+	l, ok := ul.limiters[email]
+	if !ok {
+		return nil
+	}
+
+	// Перепакованные и перекодированные потоки и сегменты HLS отдаются без Range,
+	// но это тоже воспроизведение
+	mode := r.URL.Query().Get("mode")
+	if r.Header.Get("Range") != "" || mode == streamModeRemux || mode == streamModeTranscode || strings.HasPrefix(r.URL.Path, "/api/hls/") {
+		return l.stream
+	}
+	return l.download
+}
+
+// limitedWriter ограничивает скорость записи ответа
+type limitedWriter struct {
+	http.ResponseWriter
+	ctx     context.Context
+	limiter *rate.Limiter
+}
+
+func (w *limitedWriter) Write(p []byte) (int, error) {
+	written := 0
+	for written < len(p) {
+		chunk := min(len(p)-written, writeChunk)
+		if err := w.limiter.WaitN(w.ctx, chunk); err != nil {
+			return written, err
+		}
+
+		n, err := w.ResponseWriter.Write(p[written : written+chunk])
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+
+	return written, nil
+}
+
+// limitWriter оборачивает ответ ограничителем скорости пользователя, если он задан
+func (server *Server) limitWriter(w http.ResponseWriter, r *http.Request, email string) http.ResponseWriter {
+	limiter := server.userLimiters.get(strings.ToLower(strings.TrimSpace(email)), r)
+	if limiter == nil {
+		return w
+	}
+
+	return &limitedWriter{ResponseWriter: w, ctx: r.Context(), limiter: limiter}
+}
@@ -1,7 +1,9 @@
 package server
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net"
@@ -9,11 +11,17 @@ import (
 	"os"
 	"os/signal"
 	"retreat-backend/internal/database"
+	"strings"
 	"sync"
 	"syscall"
+	"time"
 
+	"retreat-backend/internal/player"
+	"retreat-backend/internal/search"
 	"retreat-backend/internal/torrent"
+	"retreat-backend/internal/transcode"
 	"retreat-backend/internal/utils"
+	"retreat-backend/internal/webhook"
 )
 
 type Server struct {
@@ -24,7 +32,17 @@ type Server struct {
 	config         *Config
 	userStore      *database.UserStore
 	torrentStore   *database.TorrentStore
+	historyStore   *database.HistoryStore
+	webhookStore   *database.WebhookStore
+	feedStore      *database.FeedStore
+	feedChecks     chan *database.Feed
+	httpClient     *http.Client
+	linkClient     *http.Client // Загружает ссылки пользователей только с публичных адресов
+	webhookSender  *webhook.Sender
 	torrentManager *torrent.TorrentManager
+	userLimiters   *userLimiters
+	mediaPlayer    *player.Player
+	searcher       *search.Searcher
 	mongodb        *database.MongoDB
 }
 
@@ -32,15 +50,25 @@ func CreateServer(config *Config) *Server {
 	port := config.Port
 
 	server := Server{
-		srv:            &http.Server{Addr: ":" + fmt.Sprint(port)},
-		stopChan:       make(chan os.Signal, 1),
-		config:         config,
-		torrentManager: torrent.NewTorrentManager(config.Filetypes, config.DownloadPath),
+		srv:           &http.Server{Addr: ":" + fmt.Sprint(port)},
+		stopChan:      make(chan os.Signal, 1),
+		config:        config,
+		userLimiters:  newUserLimiters(),
+		webhookSender: webhook.NewSender(),
+		feedChecks:    make(chan *database.Feed, feedQueue),
+		httpClient:    &http.Client{},
+		linkClient:    &http.Client{Transport: publicTransport()},
+		mediaPlayer:   player.New(config.Playback, config.PlaybackSocket),
 	}
 
+	providers := make([]search.Provider, 0, len(config.Torznab))
+	for _, indexer := range config.Torznab {
+		providers = append(providers, search.NewTorznab(indexer))
+	}
+	server.searcher = search.NewSearcher(time.Duration(config.SearchTimeout)*time.Second, providers...)
+
 	signal.Notify(server.stopChan, os.Interrupt, syscall.SIGTERM)
 
-	os.RemoveAll(config.DownloadPath)
 	err := os.MkdirAll(config.DownloadPath, os.ModePerm)
 	utils.Expect(err, "Failed to create downloads directory")
 
@@ -51,6 +79,39 @@ func CreateServer(config *Config) *Server {
 	// Initialize user store
 	server.userStore = database.NewUserStore(mongodb)
 	server.torrentStore = database.NewTorrentStore(mongodb)
+	server.historyStore = database.NewHistoryStore(mongodb)
+	server.webhookStore = database.NewWebhookStore(mongodb)
+	server.feedStore = database.NewFeedStore(mongodb)
+
+	err = server.webhookStore.CreateIndexes()
+	utils.Expect(err, "Failed to create webhook indexes")
+	err = server.historyStore.CreateIndexes()
+	utils.Expect(err, "Failed to create history indexes")
+
+	server.torrentManager = torrent.NewTorrentManager(torrent.Config{
+		Filetypes:     config.Filetypes,
+		SubtitleTypes: config.SubtitleTypes,
+		DownloadPath:  config.DownloadPath,
+		CacheQuota:    config.CacheQuota,
+
+		MetadataTimeout: time.Duration(config.MetadataTimeout) * time.Second,
+
+		DownloadRateLimit: config.DownloadRateLimit,
+		UploadRateLimit:   config.UploadRateLimit,
+
+		SeedPolicy: config.SeedPolicy,
+
+		Transcoder: transcode.NewCommandTranscoder(config.Transcoder, config.TranscodeProfiles, config.TranscodeJobs),
+	})
+	server.torrentManager.OnSeedingStarted(server.seedingStarted)
+	server.torrentManager.OnSeedingFinished(server.seedingFinished)
+	server.torrentManager.OnSeedUploaded(server.seedUploaded)
+	server.subscribeWebhooks()
+	for email, limits := range config.UserLimits {
+		server.userLimiters.set(strings.ToLower(email), limits)
+	}
+	go server.restoreLibrary()
+	go server.runFeeds()
 
 	// Public auth endpoints
 	http.HandleFunc("/api/register", server.cors(server.register))
@@ -59,14 +120,136 @@ func CreateServer(config *Config) *Server {
 
 	// Protected endpoints
 	http.HandleFunc("/api/torrents", server.cors(server.auth(server.torrents)))
+	http.HandleFunc("/api/torrent", server.cors(server.auth(server.torrent)))
 	http.HandleFunc("/api/delete", server.cors(server.auth(server.delete)))
 	http.HandleFunc("/api/stream", server.cors(server.auth(server.stream)))
+	http.HandleFunc("/api/hls/{torrent}/{file}/{segment}", server.cors(server.auth(server.hls)))
+	http.HandleFunc("/api/probe", server.cors(server.auth(server.probe)))
+	http.HandleFunc("/api/subtitle", server.cors(server.auth(server.subtitle)))
 	http.HandleFunc("/api/magnet", server.cors(server.auth(server.magnet)))
 	http.HandleFunc("/api/file", server.cors(server.auth(server.file)))
+	http.HandleFunc("/api/inspect", server.cors(server.auth(server.inspect)))
+	http.HandleFunc("/api/search", server.cors(server.auth(server.search)))
+	http.HandleFunc("/api/search/add", server.cors(server.auth(server.searchAdd)))
+	http.HandleFunc("/api/feeds", server.cors(server.auth(server.feeds)))
+	http.HandleFunc("/api/feeds/matches", server.cors(server.auth(server.feedMatches)))
+	http.HandleFunc("/api/job", server.cors(server.auth(server.job)))
+	http.HandleFunc("/api/files", server.cors(server.auth(server.files)))
+	http.HandleFunc("/api/download", server.cors(server.auth(server.download)))
+	http.HandleFunc("/api/seeding", server.cors(server.auth(server.seeding)))
+	http.HandleFunc("/api/player", server.cors(server.auth(server.player)))
+	http.HandleFunc("/api/progress", server.cors(server.auth(server.progress)))
+	http.HandleFunc("/api/history", server.cors(server.auth(server.history)))
+	http.HandleFunc("/api/continue", server.cors(server.auth(server.continueWatching)))
+	http.HandleFunc("/api/events", server.cors(server.auth(server.events)))
+	http.HandleFunc("/api/webhooks", server.cors(server.auth(server.webhooks)))
+	http.HandleFunc("/api/webhooks/deliveries", server.cors(server.auth(server.deliveries)))
+
+	// Admin endpoints
+	http.HandleFunc("/api/admin/limits", server.cors(server.auth(server.admin(server.limits))))
 
 	return &server
 }
 
+// restoreTorrent добавляет торрент из библиотеки в клиент, если его там еще нет
+func (server *Server) restoreTorrent(t *database.Torrent) error {
+	if _, isHave := server.torrentManager.GetTorrent(t.Hash); isHave {
+		return nil
+	}
+
+	// Выбор файлов задается до добавления, чтобы невыбранные файлы не получили приоритет
+	if err := server.applySelection(t.Hash); err != nil {
+		log.Printf("Failed to restore file selection for %s: %v", t.Hash, err)
+	}
+
+	var err error
+	if t.IsMagnet {
+		_, err = server.torrentManager.AddMagnet(t.TorrentFile)
+	} else if len(t.Metainfo) > 0 {
+		_, err = server.torrentManager.AddTorrentFromFile(bytes.NewReader(t.Metainfo), t.TorrentFile)
+	} else {
+		err = errors.New("torrent file is missing")
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := server.applyPins(t.Hash); err != nil {
+		log.Printf("Failed to restore pins for %s: %v", t.Hash, err)
+	}
+
+	for fileId, info := range t.Media {
+		server.torrentManager.SetMediaInfo(fileId, info)
+	}
+	go server.probeMedia(t.Hash)
+
+	if started, uploaded, err := server.torrentStore.GetSeedProgress(t.Hash); err == nil {
+		if started != nil {
+			server.torrentManager.SetSeedStarted(t.Hash, *started)
+		}
+		server.torrentManager.SetSeedUploaded(t.Hash, uploaded)
+	}
+	if err := server.applySeedPolicy(t.Hash); err != nil {
+		log.Printf("Failed to restore seeding policy for %s: %v", t.Hash, err)
+	}
+	if t.SeedState != "" && t.SeedState != torrent.SeedSeeding {
+		server.torrentManager.StopSeeding(t.Hash, t.SeedState)
+	}
+
+	return nil
+}
+
+// restoreLibrary возвращает в клиент все торренты, на которые ссылается библиотека
+func (server *Server) restoreLibrary() {
+	torrents, err := server.torrentStore.GetAllTorrents()
+	if err != nil {
+		log.Printf("Failed to load library: %v", err)
+		return
+	}
+
+	restored := make(map[string]bool)
+	for _, t := range torrents {
+		if restored[t.Hash] {
+			continue
+		}
+		restored[t.Hash] = true
+
+		go func(t *database.Torrent) {
+			if err := server.restoreTorrent(t); err != nil {
+				log.Printf("Failed to restore torrent %s: %v", t.Hash, err)
+				return
+			}
+
+			// Метаданные могли не успеть загрузиться до перезапуска
+			if t.State == torrent.JobPendingMetadata {
+				if ti, ok := server.torrentManager.GetTorrent(t.Hash); ok {
+					_ = server.torrentStore.UpdateTorrentInfo(t.Hash, ti, torrent.JobReady)
+				}
+			}
+		}(t)
+	}
+}
+
+// applyPins закрепляет в клиенте файлы, закрепленные пользователями в библиотеке
+func (server *Server) applyPins(hash string) error {
+	pinned, err := server.torrentStore.GetPinnedFiles(hash)
+	if err != nil {
+		return err
+	}
+
+	return server.torrentManager.SetPinnedFiles(hash, pinned)
+}
+
+// applySelection оставляет приоритет в клиенте только файлам, выбранным пользователями в библиотеке
+func (server *Server) applySelection(hash string) error {
+	files, err := server.torrentStore.GetSelectedFiles(hash)
+	if err != nil {
+		return err
+	}
+
+	return server.torrentManager.SetSelectedFiles(hash, files)
+}
+
 func (server *Server) respond(w http.ResponseWriter, res any, code int) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(code)
@@ -105,18 +288,12 @@ func (server *Server) Serve(config *Config) {
 	<-server.stopChan
 
 	utils.Expect(server.srv.Close(), "Error closing server")
+	if err := server.mediaPlayer.Close(); err != nil {
+		log.Printf("Error closing player: %v", err)
+	}
 	server.torrentManager.Close()
 
 	if err := server.mongodb.Close(); err != nil {
 		log.Printf("Error closing MongoDB connection: %v", err)
 	}
-
-	err = os.RemoveAll(config.DownloadPath)
-	if err != nil {
-		return
-	}
-	err = os.MkdirAll(config.DownloadPath, os.ModePerm)
-	if err != nil {
-		return
-	}
 }
@@ -0,0 +1,144 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"retreat-backend/internal/database"
+	"retreat-backend/internal/torrent"
+	"retreat-backend/internal/webhook"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// webhookTimeout ограничивает доставку события вместе со всеми повторами
+const webhookTimeout = 5 * time.Minute
+
+// webhookEvents перечисляет события, на которые можно подписать вебхук
+var webhookEvents = map[torrent.EventType]bool{
+	torrent.EventAdded:     true,
+	torrent.EventMetadata:  true,
+	torrent.EventCompleted: true,
+	torrent.EventRemoved:   true,
+	torrent.EventError:     true,
+}
+
+// WebhookPayload - тело запроса вебхука. Подпись тела передается
+// в заголовке X-Retreat-Signature.
+type WebhookPayload struct {
+	Id      string               `json:"id"`
+	Event   torrent.EventType    `json:"event"`
+	Hash    string               `json:"hash"`
+	FileId  string               `json:"file_id,omitempty"`
+	Torrent *torrent.TorrentInfo `json:"torrent,omitempty"`
+	Error   string               `json:"error,omitempty"`
+	Time    time.Time            `json:"time"`
+}
+
+// subscribeWebhooks подписывает вебхуки на события библиотеки. Менеджер вызывает
+// обработчик для каждого события, поэтому события не теряются при всплеске.
+func (server *Server) subscribeWebhooks() {
+	types := make([]torrent.EventType, 0, len(webhookEvents))
+	for t := range webhookEvents {
+		types = append(types, t)
+	}
+
+	server.torrentManager.OnEvents(server.webhookEvent, types...)
+}
+
+// webhookEvent отправляет вебхуки по событию библиотеки. События, адресованные
+// пользователю, уходят только ему, о загрузке файла сообщается всем владельцам
+// торрента.
+func (server *Server) webhookEvent(e torrent.Event) {
+	switch {
+	case e.Owner != "":
+		owner, err := primitive.ObjectIDFromHex(e.Owner)
+		if err != nil {
+			return
+		}
+		server.notifyWebhooks([]primitive.ObjectID{owner}, e)
+	case e.Type == torrent.EventCompleted:
+		owners, err := server.torrentStore.GetOwners(e.Hash)
+		if err != nil {
+			log.Printf("Failed to get owners of %s for webhooks: %v", e.Hash, err)
+			return
+		}
+		server.notifyWebhooks(owners, e)
+	}
+}
+
+// notifyWebhooks отправляет событие на вебхуки пользователей, подписанные на него
+func (server *Server) notifyWebhooks(owners []primitive.ObjectID, e torrent.Event) {
+	if len(owners) == 0 || !webhookEvents[e.Type] {
+		return
+	}
+
+	hooks, err := server.webhookStore.GetSubscribedWebhooks(owners, e.Type)
+	if err != nil {
+		log.Printf("Failed to get webhooks for %s: %v", e.Type, err)
+		return
+	}
+	if len(hooks) == 0 {
+		return
+	}
+
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	if e.Torrent == nil && e.Type != torrent.EventRemoved {
+		if info, ok := server.torrentManager.GetTorrent(e.Hash); ok {
+			e.Torrent = info
+		}
+	}
+
+	for _, hook := range hooks {
+		go server.deliverWebhook(hook, e)
+	}
+}
+
+// deliverWebhook доставляет событие на вебхук и записывает каждую попытку в журнал
+func (server *Server) deliverWebhook(hook *database.Webhook, e torrent.Event) {
+	delivery := generateRandomHex(16)
+
+	body, err := json.Marshal(WebhookPayload{
+		Id:      delivery,
+		Event:   e.Type,
+		Hash:    e.Hash,
+		FileId:  e.FileId,
+		Torrent: e.Torrent,
+		Error:   e.Error,
+		Time:    e.Time,
+	})
+	if err != nil {
+		log.Printf("Failed to encode webhook payload: %v", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+	defer cancel()
+
+	err = server.webhookSender.Send(ctx, hook.URL, hook.Secret, string(e.Type), delivery, body, func(a webhook.Attempt) {
+		err := server.webhookStore.AddDelivery(&database.WebhookDelivery{
+			WebhookId:  hook.ID,
+			OwnerId:    hook.OwnerId,
+			Delivery:   delivery,
+			Event:      e.Type,
+			Hash:       e.Hash,
+			URL:        hook.URL,
+			Attempt:    a.Number,
+			Status:     a.Status,
+			Error:      a.Error,
+			Success:    a.Success(),
+			DurationMs: a.Duration.Milliseconds(),
+			CreatedAt:  time.Now(),
+		})
+		if err != nil {
+			log.Printf("Failed to save webhook delivery %s: %v", delivery, err)
+		}
+	})
+	if err != nil {
+		log.Printf("Webhook %s delivery %s failed: %v", hook.ID.Hex(), delivery, err)
+	}
+}
@@ -0,0 +1,148 @@
+package subtitles
+
+import (
+	"regexp"
+	"strings"
+)
+
+// assStyle содержит оформление стиля ASS, которое можно передать в WebVTT
+type assStyle struct {
+	bold      bool
+	italic    bool
+	underline bool
+}
+
+// assOverrideRegex находит блоки переопределения оформления ASS: {\i1\b1}
+var assOverrideRegex = regexp.MustCompile(`\{([^}]*)\}`)
+
+// parseASS разбирает секции [V4+ Styles] и [Events] файла ASS/SSA
+func parseASS(text string) []Cue {
+	var (
+		cues        []Cue
+		section     string
+		styleFormat []string
+		eventFormat []string
+	)
+	styles := make(map[string]assStyle)
+
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.ToLower(line)
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+
+		switch {
+		case strings.Contains(section, "styles") && key == "Format":
+			styleFormat = splitFields(value, 0)
+		case strings.Contains(section, "styles") && key == "Style":
+			fields := fieldMap(styleFormat, splitFields(value, len(styleFormat)))
+			styles[fields["name"]] = assStyle{
+				bold:      assFlag(fields["bold"]),
+				italic:    assFlag(fields["italic"]),
+				underline: assFlag(fields["underline"]),
+			}
+		case section == "[events]" && key == "Format":
+			eventFormat = splitFields(value, 0)
+		case section == "[events]" && key == "Dialogue":
+			if eventFormat == nil {
+				continue
+			}
+
+			fields := fieldMap(eventFormat, splitFields(value, len(eventFormat)))
+			start, err1 := parseTimestamp(fields["start"])
+			end, err2 := parseTimestamp(fields["end"])
+			if err1 != nil || err2 != nil {
+				continue
+			}
+
+			body := assText(fields["text"], styles[strings.TrimPrefix(fields["style"], "*")])
+			if strings.TrimSpace(body) == "" {
+				continue
+			}
+
+			cues = append(cues, Cue{Start: start, End: end, Text: body})
+		}
+	}
+
+	return cues
+}
+
+// splitFields разделяет значение по запятым; последнее поле (текст реплики)
+// может содержать запятые, поэтому число полей ограничивается n
+func splitFields(value string, n int) []string {
+	var parts []string
+	if n > 0 {
+		parts = strings.SplitN(value, ",", n)
+	} else {
+		parts = strings.Split(value, ",")
+	}
+
+	for i := range parts {
+		parts[i] = strings.TrimSpace(parts[i])
+	}
+	return parts
+}
+
+func fieldMap(format []string, values []string) map[string]string {
+	fields := make(map[string]string, len(format))
+	for i, name := range format {
+		if i < len(values) {
+			fields[strings.ToLower(name)] = values[i]
+		}
+	}
+	return fields
+}
+
+// assFlag разбирает логическое значение ASS: -1 или 1 означает "включено"
+func assFlag(v string) bool {
+	return v == "-1" || v == "1"
+}
+
+// assText преобразует текст реплики ASS в разметку WebVTT
+func assText(text string, style assStyle) string {
+	// Рисунки (\p1) не отображаются как текст
+	if strings.Contains(text, `\p1`) {
+		return ""
+	}
+
+	text = strings.NewReplacer(`\N`, "\n", `\n`, "\n", `\h`, " ").Replace(text)
+	text = sanitize(text)
+
+	var opening, closing string
+	if style.bold {
+		opening, closing = opening+"<b>", "</b>"+closing
+	}
+	if style.italic {
+		opening, closing = opening+"<i>", "</i>"+closing
+	}
+	if style.underline {
+		opening, closing = opening+"<u>", "</u>"+closing
+	}
+
+	return balanceTags(opening + text + closing)
+}
+
+// convertASSTags заменяет теги оформления ASS ({\i1}, {\b0}) на теги WebVTT,
+// остальные блоки переопределения удаляются
+func convertASSTags(text string) string {
+	return assOverrideRegex.ReplaceAllStringFunc(text, func(block string) string {
+		var sb strings.Builder
+		for _, tag := range strings.Split(strings.Trim(block, "{}"), `\`) {
+			switch tag {
+			case "b1", "i1", "u1":
+				sb.WriteString("<" + tag[:1] + ">")
+			case "b0", "i0", "u0":
+				sb.WriteString("</" + tag[:1] + ">")
+			}
+		}
+		return sb.String()
+	})
+}
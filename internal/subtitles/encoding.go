@@ -0,0 +1,79 @@
+package subtitles
+
+import (
+	"bytes"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+)
+
+var (
+	bomUTF8    = []byte{0xEF, 0xBB, 0xBF}
+	bomUTF16LE = []byte{0xFF, 0xFE}
+	bomUTF16BE = []byte{0xFE, 0xFF}
+)
+
+// Decode определяет кодировку субтитров и возвращает текст в UTF-8.
+// Поддерживаются UTF-8 и UTF-16 (с BOM или без), остальное считается CP1251.
+func Decode(data []byte) (string, error) {
+	switch {
+	case bytes.HasPrefix(data, bomUTF8):
+		return string(data[len(bomUTF8):]), nil
+	case bytes.HasPrefix(data, bomUTF16LE):
+		return decodeWith(unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM), data[len(bomUTF16LE):])
+	case bytes.HasPrefix(data, bomUTF16BE):
+		return decodeWith(unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM), data[len(bomUTF16BE):])
+	}
+
+	if order, ok := guessUTF16(data); ok {
+		return decodeWith(unicode.UTF16(order, unicode.IgnoreBOM), data)
+	}
+
+	if utf8.Valid(data) {
+		return string(data), nil
+	}
+
+	return decodeWith(charmap.Windows1251, data)
+}
+
+func decodeWith(enc encoding.Encoding, data []byte) (string, error) {
+	decoded, err := enc.NewDecoder().Bytes(data)
+	if err != nil {
+		return "", err
+	}
+	return string(decoded), nil
+}
+
+// guessUTF16 распознает UTF-16 без BOM по нулевым байтам: в тексте субтитров
+// большинство символов ASCII (цифры таймингов, разделители), у которых
+// старший байт равен нулю
+func guessUTF16(data []byte) (unicode.Endianness, bool) {
+	sample := data[:min(len(data), 4096)]
+	if len(sample) < 4 {
+		return unicode.LittleEndian, false
+	}
+
+	var evenZeros, oddZeros int
+	for i, b := range sample {
+		if b != 0 {
+			continue
+		}
+		if i%2 == 0 {
+			evenZeros++
+		} else {
+			oddZeros++
+		}
+	}
+
+	half := len(sample) / 2
+	switch {
+	case oddZeros > half/2 && evenZeros < half/10:
+		return unicode.LittleEndian, true
+	case evenZeros > half/2 && oddZeros < half/10:
+		return unicode.BigEndian, true
+	}
+
+	return unicode.LittleEndian, false
+}
@@ -0,0 +1,48 @@
+package subtitles
+
+import (
+	"testing"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+)
+
+const sampleText = "1\n00:00:01,000 --> 00:00:02,000\nПривет, мир!\n"
+
+func encode(t *testing.T, enc encoding.Encoding, s string) []byte {
+	t.Helper()
+
+	data, err := enc.NewEncoder().Bytes([]byte(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"utf-8", []byte(sampleText)},
+		{"utf-8 with bom", append([]byte{0xEF, 0xBB, 0xBF}, sampleText...)},
+		{"utf-16le with bom", encode(t, unicode.UTF16(unicode.LittleEndian, unicode.UseBOM), sampleText)},
+		{"utf-16be with bom", encode(t, unicode.UTF16(unicode.BigEndian, unicode.UseBOM), sampleText)},
+		{"utf-16le without bom", encode(t, unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM), sampleText)},
+		{"utf-16be without bom", encode(t, unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM), sampleText)},
+		{"cp1251", encode(t, charmap.Windows1251, sampleText)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Decode(tt.data)
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			if got != sampleText {
+				t.Errorf("Decode() = %q, want %q", got, sampleText)
+			}
+		})
+	}
+}
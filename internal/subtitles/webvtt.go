@@ -0,0 +1,253 @@
+package subtitles
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Format описывает формат файла субтитров
+type Format string
+
+const (
+	FormatSRT    Format = "srt"
+	FormatASS    Format = "ass"
+	FormatWebVTT Format = "vtt"
+)
+
+// Cue описывает одну реплику субтитров
+type Cue struct {
+	Start time.Duration
+	End   time.Duration
+	Text  string // Текст с разметкой WebVTT (<b>, <i>, <u>)
+}
+
+// FormatFromExt определяет формат субтитров по расширению файла
+func FormatFromExt(ext string) (Format, bool) {
+	switch strings.ToLower(ext) {
+	case ".srt":
+		return FormatSRT, true
+	case ".ass", ".ssa":
+		return FormatASS, true
+	case ".vtt":
+		return FormatWebVTT, true
+	}
+	return "", false
+}
+
+// ToWebVTT декодирует субтитры и преобразует их в WebVTT в UTF-8,
+// сдвигая все реплики на offset
+func ToWebVTT(data []byte, format Format, offset time.Duration) (string, error) {
+	text, err := Decode(data)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode subtitles: %w", err)
+	}
+
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\r", "\n")
+
+	var cues []Cue
+	switch format {
+	case FormatSRT, FormatWebVTT:
+		cues = parseTimedBlocks(text)
+	case FormatASS:
+		cues = parseASS(text)
+	default:
+		return "", fmt.Errorf("unsupported subtitle format: %s", format)
+	}
+
+	return WriteWebVTT(shift(cues, offset)), nil
+}
+
+// WriteWebVTT формирует документ WebVTT из реплик
+func WriteWebVTT(cues []Cue) string {
+	var sb strings.Builder
+	sb.WriteString("WEBVTT\n\n")
+
+	for _, c := range cues {
+		sb.WriteString(formatTimestamp(c.Start))
+		sb.WriteString(" --> ")
+		sb.WriteString(formatTimestamp(c.End))
+		sb.WriteString("\n")
+		sb.WriteString(c.Text)
+		sb.WriteString("\n\n")
+	}
+
+	return sb.String()
+}
+
+// shift сдвигает реплики, отбрасывая те, что целиком оказались до начала
+func shift(cues []Cue, offset time.Duration) []Cue {
+	if offset == 0 {
+		return cues
+	}
+
+	shifted := make([]Cue, 0, len(cues))
+	for _, c := range cues {
+		c.Start += offset
+		c.End += offset
+		if c.End <= 0 {
+			continue
+		}
+		c.Start = max(c.Start, 0)
+		shifted = append(shifted, c)
+	}
+
+	return shifted
+}
+
+func formatTimestamp(d time.Duration) string {
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
+
+// timingRegex разбирает строку тайминга SRT ("00:01:02,345 --> 00:01:04,000")
+// и WebVTT ("01:02.345 --> 01:04.000 align:start")
+var timingRegex = regexp.MustCompile(`^\s*((?:\d+:)?\d{1,2}:\d{1,2}[,.]\d{1,3})\s*-->\s*((?:\d+:)?\d{1,2}:\d{1,2}[,.]\d{1,3})`)
+
+// parseTimedBlocks разбирает SRT и WebVTT: блоки, разделенные пустыми строками,
+// в которых за строкой тайминга следует текст
+func parseTimedBlocks(text string) []Cue {
+	var cues []Cue
+
+	for _, block := range strings.Split(text, "\n\n") {
+		lines := strings.Split(strings.Trim(block, "\n"), "\n")
+
+		for i, line := range lines {
+			m := timingRegex.FindStringSubmatch(line)
+			if m == nil {
+				continue
+			}
+
+			start, err1 := parseTimestamp(m[1])
+			end, err2 := parseTimestamp(m[2])
+			body := strings.TrimSpace(strings.Join(lines[i+1:], "\n"))
+			if err1 != nil || err2 != nil || body == "" {
+				break
+			}
+
+			cues = append(cues, Cue{Start: start, End: end, Text: sanitize(body)})
+			break
+		}
+	}
+
+	return cues
+}
+
+// parseTimestamp разбирает время вида "[hh:]mm:ss,mmm" или "[hh:]mm:ss.mmm"
+func parseTimestamp(s string) (time.Duration, error) {
+	s = strings.Replace(s, ",", ".", 1)
+
+	parts := strings.Split(s, ":")
+	var h, m int
+	var sec float64
+	var err error
+
+	switch len(parts) {
+	case 3:
+		if h, err = strconv.Atoi(parts[0]); err != nil {
+			return 0, err
+		}
+		parts = parts[1:]
+		fallthrough
+	case 2:
+		if m, err = strconv.Atoi(parts[0]); err != nil {
+			return 0, err
+		}
+		if sec, err = strconv.ParseFloat(parts[1], 64); err != nil {
+			return 0, err
+		}
+	default:
+		return 0, fmt.Errorf("invalid timestamp: %s", s)
+	}
+
+	return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute +
+		time.Duration(sec*float64(time.Second)).Round(time.Millisecond), nil
+}
+
+var (
+	// htmlTagRegex находит теги HTML в тексте SRT
+	htmlTagRegex = regexp.MustCompile(`<\s*(/?)\s*([a-zA-Z]+)[^>]*>`)
+	// vttTagRegex находит теги разметки WebVTT, оставшиеся после очистки
+	vttTagRegex = regexp.MustCompile(`</?[biu]>`)
+)
+
+// sanitize оставляет в тексте только разметку, поддерживаемую WebVTT
+func sanitize(text string) string {
+	text = convertASSTags(text)
+
+	var sb strings.Builder
+	last := 0
+	for _, m := range htmlTagRegex.FindAllStringSubmatchIndex(text, -1) {
+		sb.WriteString(escape(text[last:m[0]]))
+		last = m[1]
+
+		closing := text[m[2]:m[3]]
+		tag := strings.ToLower(text[m[4]:m[5]])
+		if tag == "b" || tag == "i" || tag == "u" {
+			sb.WriteString("<" + closing + tag + ">")
+		}
+	}
+	sb.WriteString(escape(text[last:]))
+
+	return balanceTags(sb.String())
+}
+
+// escape экранирует символы, имеющие особое значение в WebVTT
+func escape(s string) string {
+	s = strings.ReplaceAll(s, "&", "&amp;")
+	s = strings.ReplaceAll(s, "<", "&lt;")
+	return strings.ReplaceAll(s, ">", "&gt;")
+}
+
+// balanceTags закрывает незакрытые теги и удаляет лишние закрывающие
+func balanceTags(s string) string {
+	var sb strings.Builder
+	var open []string
+
+	last := 0
+	for _, m := range vttTagRegex.FindAllStringIndex(s, -1) {
+		sb.WriteString(s[last:m[0]])
+		last = m[1]
+
+		tag := s[m[0]:m[1]]
+		name := strings.Trim(tag, "</>")
+		if !strings.HasPrefix(tag, "</") {
+			open = append(open, name)
+			sb.WriteString(tag)
+			continue
+		}
+
+		idx := -1
+		for i := len(open) - 1; i >= 0; i-- {
+			if open[i] == name {
+				idx = i
+				break
+			}
+		}
+		if idx < 0 {
+			continue
+		}
+
+		// Закрываем вложенные теги, чтобы не нарушить вложенность
+		for i := len(open) - 1; i >= idx; i-- {
+			sb.WriteString("</" + open[i] + ">")
+		}
+		reopen := slices.Clone(open[idx+1:])
+		open = open[:idx]
+		for _, t := range reopen {
+			sb.WriteString("<" + t + ">")
+			open = append(open, t)
+		}
+	}
+	sb.WriteString(s[last:])
+
+	for i := len(open) - 1; i >= 0; i-- {
+		sb.WriteString("</" + open[i] + ">")
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,125 @@
+package subtitles
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestToWebVTT(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   string
+		format Format
+		offset time.Duration
+		want   string
+	}{
+		{
+			name:   "srt",
+			data:   "1\r\n00:00:01,500 --> 00:00:03,000\r\n<i>Hello</i> & <font color=\"red\">world</font>\r\n\r\n2\r\n00:01:02,345 --> 00:01:04,000\r\nSecond <b>line\r\n",
+			format: FormatSRT,
+			want:   "WEBVTT\n\n00:00:01.500 --> 00:00:03.000\n<i>Hello</i> &amp; world\n\n00:01:02.345 --> 00:01:04.000\nSecond <b>line</b>\n\n",
+		},
+		{
+			name:   "webvtt with settings and short timestamps",
+			data:   "WEBVTT\n\nNOTE comment\n\nintro\n01:02.345 --> 01:04.000 align:start\nFirst\nline\n\n01:05.000 --> 01:06.000\n\n",
+			format: FormatWebVTT,
+			want:   "WEBVTT\n\n00:01:02.345 --> 00:01:04.000\nFirst\nline\n\n",
+		},
+		{
+			name: "ass",
+			data: "[Script Info]\nTitle: Movie\n\n[V4+ Styles]\nFormat: Name, Fontname, Bold, Italic, Underline\nStyle: Default,Arial,0,0,0\nStyle: Sign,Arial,-1,0,1\n\n" +
+				"[Events]\nFormat: Layer, Start, End, Style, Text\n" +
+				"Dialogue: 0,0:00:01.00,0:00:02.50,Default,{\\i1}Hi{\\i0}, there\\Nnext\n" +
+				"Comment: 0,0:00:02.00,0:00:03.00,Default,hidden\n" +
+				"Dialogue: 0,0:00:03.00,0:00:04.00,*Sign,{\\pos(10,20)}Sign text\n" +
+				"Dialogue: 0,0:00:05.00,0:00:06.00,Default,{\\p1}m 0 0 l 100 0{\\p0}\n",
+			format: FormatASS,
+			want:   "WEBVTT\n\n00:00:01.000 --> 00:00:02.500\n<i>Hi</i>, there\nnext\n\n00:00:03.000 --> 00:00:04.000\n<b><u>Sign text</u></b>\n\n",
+		},
+		{
+			name:   "offset",
+			data:   "1\n00:00:01,000 --> 00:00:02,000\nGone\n\n2\n00:00:02,500 --> 00:00:04,000\nCut\n\n3\n00:00:05,000 --> 00:00:06,000\nMoved\n",
+			format: FormatSRT,
+			offset: -3 * time.Second,
+			want:   "WEBVTT\n\n00:00:00.000 --> 00:00:01.000\nCut\n\n00:00:02.000 --> 00:00:03.000\nMoved\n\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ToWebVTT([]byte(tt.data), tt.format, tt.offset)
+			if err != nil {
+				t.Fatalf("ToWebVTT() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("ToWebVTT() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := ToWebVTT([]byte("text"), Format("sub"), 0); err == nil {
+		t.Error("ToWebVTT() accepted an unsupported format")
+	}
+}
+
+func TestSanitize(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"plain", "plain"},
+		{"<I>upper</I>", "<i>upper</i>"},
+		{"1 < 2 && 3 > 2", "1 &lt; 2 &amp;&amp; 3 &gt; 2"},
+		{"<b>bold <i>both</b> italic</i>", "<b>bold <i>both</i></b><i> italic</i>"},
+		{"stray</i> close", "stray close"},
+		{"<script>alert(1)</script>", "alert(1)"},
+		{"{\\b1}ass{\\b0} {\\an8}tags", "<b>ass</b> tags"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			if got := sanitize(tt.text); got != tt.want {
+				t.Errorf("sanitize() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTimestamp(t *testing.T) {
+	tests := []struct {
+		s    string
+		want time.Duration
+		err  bool
+	}{
+		{"00:01:02,345", time.Minute + 2345*time.Millisecond, false},
+		{"1:02:03.5", time.Hour + 2*time.Minute + 3500*time.Millisecond, false},
+		{"02:03.040", 2*time.Minute + 3040*time.Millisecond, false},
+		{"0:00:01.00", time.Second, false},
+		{"12.5", 0, true},
+		{"aa:01.000", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			got, err := parseTimestamp(tt.s)
+			if (err != nil) != tt.err || got != tt.want {
+				t.Errorf("parseTimestamp() = %s, %v; want %s", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatFromExt(t *testing.T) {
+	got := make(map[string]Format)
+	for _, ext := range []string{".srt", ".SSA", ".ass", ".vtt", ".sub"} {
+		if format, ok := FormatFromExt(ext); ok {
+			got[ext] = format
+		}
+	}
+
+	want := map[string]Format{".srt": FormatSRT, ".SSA": FormatASS, ".ass": FormatASS, ".vtt": FormatWebVTT}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("formats = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,215 @@
+package torrent
+
+import (
+	"encoding/json"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"retreat-backend/internal/utils"
+
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// cacheIndexFile хранит время последнего доступа к торрентам в каталоге загрузок
+const cacheIndexFile = ".access.json"
+
+// cacheEvictionInterval определяет, как часто проверяется квота кэша
+const cacheEvictionInterval = time.Minute
+
+// cacheIndex отслеживает последний доступ к данным каждого торрента
+type cacheIndex struct {
+	mu     sync.Mutex
+	file   string
+	access map[string]time.Time
+}
+
+// cacheEntry описывает каталог торрента в кэше
+type cacheEntry struct {
+	hash       string
+	path       string
+	size       int64
+	lastAccess time.Time
+}
+
+func newCacheIndex(downloadPath string) *cacheIndex {
+	c := &cacheIndex{
+		file:   filepath.Join(downloadPath, cacheIndexFile),
+		access: make(map[string]time.Time),
+	}
+
+	err := utils.LoadJSON(c.file, &c.access)
+	if err != nil && !os.IsNotExist(err) {
+		log.Printf("Failed to load cache index: %v", err)
+	}
+
+	return c
+}
+
+// touch обновляет время последнего доступа к торренту
+func (c *cacheIndex) touch(hash string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.access[hash] = time.Now()
+	c.save()
+}
+
+// forget удаляет торрент из индекса
+func (c *cacheIndex) forget(hash string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.access, hash)
+	c.save()
+}
+
+func (c *cacheIndex) lastAccess(hash string) time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.access[hash]
+}
+
+func (c *cacheIndex) save() {
+	data, err := json.Marshal(c.access)
+	if err != nil {
+		log.Printf("Failed to encode cache index: %v", err)
+		return
+	}
+
+	if err := os.WriteFile(c.file, data, 0644); err != nil {
+		log.Printf("Failed to save cache index: %v", err)
+	}
+}
+
+// entries возвращает каталоги торрентов в кэше, начиная с давно не использованных
+func (c *cacheIndex) entries(downloadPath string) ([]*cacheEntry, error) {
+	dirs, err := os.ReadDir(downloadPath)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]*cacheEntry, 0, len(dirs))
+	for _, d := range dirs {
+		if !d.IsDir() {
+			continue
+		}
+
+		var hash metainfo.Hash
+		if err := hash.FromHexString(d.Name()); err != nil {
+			continue
+		}
+
+		path := filepath.Join(downloadPath, d.Name())
+		entries = append(entries, &cacheEntry{
+			hash:       d.Name(),
+			path:       path,
+			size:       dirSize(path),
+			lastAccess: c.lastAccess(d.Name()),
+		})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].lastAccess.Before(entries[j].lastAccess)
+	})
+
+	return entries, nil
+}
+
+// dirSize вычисляет место, занятое файлами каталога на диске
+func dirSize(path string) int64 {
+	var size int64
+	_ = filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
+
+// runCacheEviction периодически освобождает место, если кэш превышает квоту
+func (tm *TorrentManager) runCacheEviction() {
+	ticker := time.NewTicker(cacheEvictionInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-tm.closed:
+			return
+		case <-ticker.C:
+			tm.evictCache()
+		}
+	}
+}
+
+// evictCache удаляет данные давно не использованных торрентов (LRU),
+// пока общий размер кэша не станет меньше квоты. Торренты с закрепленными
+// файлами не учитываются в квоте и не удаляются.
+func (tm *TorrentManager) evictCache() {
+	if tm.cacheQuota <= 0 {
+		return
+	}
+
+	entries, err := tm.cache.entries(tm.downloadPath)
+	if err != nil {
+		log.Printf("Failed to read download cache: %v", err)
+		return
+	}
+
+	var total int64
+	entries = slices.DeleteFunc(entries, func(e *cacheEntry) bool {
+		return tm.hasPins(e.hash)
+	})
+	for _, e := range entries {
+		total += e.size
+	}
+
+	for _, e := range entries {
+		if total <= tm.cacheQuota {
+			break
+		}
+		if tm.isStreaming(e.hash) {
+			continue
+		}
+
+		var hash metainfo.Hash
+		_ = hash.FromHexString(e.hash)
+		if t, ok := tm.client.Torrent(hash); ok {
+			t.Drop()
+		}
+
+		if err := os.RemoveAll(e.path); err != nil {
+			log.Printf("Failed to evict %s from cache: %v", e.hash, err)
+			continue
+		}
+
+		tm.cache.forget(e.hash)
+		total -= e.size
+
+		log.Printf("Evicted %s from cache (%d bytes)", e.hash, e.size)
+	}
+}
+
+// isStreaming сообщает, читаются ли сейчас данные торрента
+func (tm *TorrentManager) isStreaming(hash string) bool {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	return tm.streams[hash] > 0
+}
+
+// Touch отмечает обращение пользователя к торренту, например его добавление в библиотеку.
+// Восстановление торрентов при запуске не считается обращением.
+func (tm *TorrentManager) Touch(id string) {
+	tm.cache.touch(id)
+}
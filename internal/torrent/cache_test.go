@@ -0,0 +1,190 @@
+package torrent
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/storage"
+)
+
+// newTestClient создает клиент без сети, хранящий данные в dir
+func newTestClient(t *testing.T, dir string) *torrent.Client {
+	t.Helper()
+
+	cfg := torrent.NewDefaultClientConfig()
+	cfg.DataDir = dir
+	cfg.DefaultStorage = storage.NewFileByInfoHash(dir)
+	cfg.ListenPort = 0
+	cfg.NoDHT = true
+	cfg.DisableTrackers = true
+	cfg.NoDefaultPortForwarding = true
+
+	client, err := torrent.NewClient(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	return client
+}
+
+// addTestTorrent добавляет в клиент торрент с одним файлом, метаданные которого уже известны
+func addTestTorrent(t *testing.T, client *torrent.Client, name string) *torrent.Torrent {
+	t.Helper()
+
+	info := metainfo.Info{Name: name, PieceLength: 16384, Length: 1024, Pieces: make([]byte, 20)}
+	infoBytes, err := bencode.Marshal(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tt, err := client.AddTorrent(&metainfo.MetaInfo{InfoBytes: infoBytes})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-tt.GotInfo()
+
+	return tt
+}
+
+// writeCacheDir создает каталог торрента в кэше с файлом заданного размера
+func writeCacheDir(t *testing.T, dir string, hash string, size int) {
+	t.Helper()
+
+	path := filepath.Join(dir, hash)
+	if err := os.MkdirAll(path, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(path, "data"), make([]byte, size), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEvictCache(t *testing.T) {
+	dir := t.TempDir()
+	client := newTestClient(t, t.TempDir())
+
+	pinned := addTestTorrent(t, client, "pinned.mkv")
+	pinnedHash := pinned.InfoHash().HexString()
+	streamed := strings.Repeat("1", 40)
+	oldest := strings.Repeat("2", 40)
+	newest := strings.Repeat("3", 40)
+
+	// Закрепленный торрент самый большой и самый давний, но не входит в квоту
+	writeCacheDir(t, dir, pinnedHash, 4000)
+	writeCacheDir(t, dir, streamed, 1000)
+	writeCacheDir(t, dir, oldest, 1000)
+	writeCacheDir(t, dir, newest, 1000)
+	writeCacheDir(t, dir, "not-a-torrent", 1000)
+
+	now := time.Now()
+	tm := &TorrentManager{
+		client:       client,
+		downloadPath: dir,
+		cacheQuota:   2000,
+		cache:        newCacheIndex(dir),
+		streams:      map[string]int{streamed: 1},
+		pinned:       map[string]bool{generateFileID(pinned.Files()[0]): true},
+	}
+	tm.cache.access = map[string]time.Time{
+		pinnedHash: now.Add(-4 * time.Hour),
+		streamed:   now.Add(-3 * time.Hour),
+		oldest:     now.Add(-2 * time.Hour),
+		newest:     now.Add(-time.Hour),
+	}
+
+	tm.evictCache()
+
+	for _, tt := range []struct {
+		hash string
+		kept bool
+	}{
+		{pinnedHash, true},
+		{streamed, true},
+		{oldest, false},
+		{newest, true},
+		{"not-a-torrent", true},
+	} {
+		_, err := os.Stat(filepath.Join(dir, tt.hash))
+		if kept := err == nil; kept != tt.kept {
+			t.Errorf("%s kept = %v, want %v", tt.hash, kept, tt.kept)
+		}
+	}
+
+	// Удаленный торрент пропадает из сохраненного индекса
+	index := newCacheIndex(dir)
+	if _, ok := index.access[oldest]; ok {
+		t.Errorf("evicted %s is still in the cache index", oldest)
+	}
+	if !index.lastAccess(newest).Equal(now.Add(-time.Hour)) {
+		t.Errorf("lastAccess(%s) = %v, want %v", newest, index.lastAccess(newest), now.Add(-time.Hour))
+	}
+
+	// Без квоты кэш не очищается
+	tm.cacheQuota = 0
+	tm.streams = map[string]int{}
+	tm.evictCache()
+	if _, err := os.Stat(filepath.Join(dir, streamed)); err != nil {
+		t.Errorf("evictCache() without quota removed %s", streamed)
+	}
+}
+
+func TestCacheIndex(t *testing.T) {
+	dir := t.TempDir()
+	first := strings.Repeat("a", 40)
+	second := strings.Repeat("b", 40)
+	unknown := strings.Repeat("c", 40)
+
+	writeCacheDir(t, dir, first, 10)
+	writeCacheDir(t, dir, second, 20)
+	writeCacheDir(t, dir, unknown, 30)
+	writeCacheDir(t, dir, "incomplete", 40)
+
+	index := newCacheIndex(dir)
+	index.touch(first)
+	time.Sleep(time.Millisecond)
+	index.touch(second)
+
+	// Индекс сохраняется в каталоге загрузок и загружается при запуске
+	index = newCacheIndex(dir)
+	if index.lastAccess(first).IsZero() || !index.lastAccess(first).Before(index.lastAccess(second)) {
+		t.Fatalf("access = %v, want %s before %s", index.access, first, second)
+	}
+
+	entries, err := index.entries(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Торрент без записи в индексе считается самым давним
+	var got []string
+	for _, e := range entries {
+		got = append(got, e.hash)
+	}
+	if want := []string{unknown, first, second}; !reflect.DeepEqual(got, want) {
+		t.Errorf("entries = %v, want %v", got, want)
+	}
+	if entries[2].size != 20 {
+		t.Errorf("entries[2].size = %d, want 20", entries[2].size)
+	}
+
+	index.forget(first)
+	if index = newCacheIndex(dir); !index.lastAccess(first).IsZero() {
+		t.Errorf("forgotten %s is still in the cache index", first)
+	}
+
+	// Поврежденный индекс не мешает запуску
+	if err := os.WriteFile(filepath.Join(dir, cacheIndexFile), []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if index = newCacheIndex(dir); len(index.access) != 0 {
+		t.Errorf("access = %v, want empty index", index.access)
+	}
+}
@@ -0,0 +1,220 @@
+package torrent
+
+import (
+	"sync"
+	"time"
+
+	"github.com/anacrolix/torrent"
+)
+
+const (
+	// eventInterval определяет период проверки прогресса загрузки
+	eventInterval = 2 * time.Second
+	// eventBuffer задает размер очереди подписчика; при переполнении события отбрасываются
+	eventBuffer = 64
+)
+
+// EventType описывает вид события библиотеки
+type EventType string
+
+const (
+	EventAdded     EventType = "added"     // Торрент добавлен в библиотеку пользователя
+	EventMetadata  EventType = "metadata"  // Получены метаданные, торрент готов
+	EventProgress  EventType = "progress"  // Изменился объем загруженных данных
+	EventCompleted EventType = "completed" // Файл загружен полностью
+	EventError     EventType = "error"     // Добавление торрента завершилось ошибкой
+	EventRemoved   EventType = "removed"   // Торрент удален
+)
+
+// Event описывает изменение состояния торрента
+type Event struct {
+	Type    EventType     `json:"type"`
+	Hash    string        `json:"hash"`
+	FileId  string        `json:"file_id,omitempty"`
+	Torrent *TorrentInfo  `json:"torrent,omitempty"`
+	Stats   *TorrentStats `json:"stats,omitempty"`
+	Error   string        `json:"error,omitempty"`
+	Time    time.Time     `json:"time"`
+
+	// Owner ограничивает получателей события одним пользователем,
+	// например при удалении торрента из его библиотеки
+	Owner string `json:"-"`
+}
+
+// eventHandler получает события перечисленных видов
+type eventHandler struct {
+	types map[EventType]bool
+	fn    func(Event)
+}
+
+// eventHub рассылает события подписчикам
+type eventHub struct {
+	mu          sync.Mutex
+	subscribers map[chan Event]struct{}
+	handlers    []eventHandler
+
+	// Последнее известное состояние загрузки для обнаружения изменений
+	completed map[string]int64
+	files     map[string]bool
+}
+
+func newEventHub() *eventHub {
+	return &eventHub{
+		subscribers: make(map[chan Event]struct{}),
+		completed:   make(map[string]int64),
+		files:       make(map[string]bool),
+	}
+}
+
+// Subscribe возвращает канал событий и функцию отписки.
+// Медленный подписчик пропускает события, а не задерживает остальных.
+func (tm *TorrentManager) Subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, eventBuffer)
+
+	tm.events.mu.Lock()
+	tm.events.subscribers[ch] = struct{}{}
+	tm.events.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			tm.events.mu.Lock()
+			delete(tm.events.subscribers, ch)
+			tm.events.mu.Unlock()
+		})
+	}
+}
+
+// OnEvents задает обработчик событий перечисленных видов. В отличие от Subscribe
+// события не пропускаются: обработчик вызывается для каждого в отдельной горутине.
+func (tm *TorrentManager) OnEvents(handler func(Event), types ...EventType) {
+	h := eventHandler{types: make(map[EventType]bool, len(types)), fn: handler}
+	for _, t := range types {
+		h.types[t] = true
+	}
+
+	tm.events.mu.Lock()
+	defer tm.events.mu.Unlock()
+
+	tm.events.handlers = append(tm.events.handlers, h)
+}
+
+// Publish рассылает событие всем подписчикам
+func (tm *TorrentManager) Publish(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	tm.events.mu.Lock()
+	defer tm.events.mu.Unlock()
+
+	for ch := range tm.events.subscribers {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+	for _, h := range tm.events.handlers {
+		if h.types[e.Type] {
+			go h.fn(e)
+		}
+	}
+}
+
+// hasListeners сообщает, ждет ли кто-нибудь событий данного вида
+func (tm *TorrentManager) hasListeners(eventType EventType) bool {
+	tm.events.mu.Lock()
+	defer tm.events.mu.Unlock()
+
+	if len(tm.events.subscribers) > 0 {
+		return true
+	}
+	for _, h := range tm.events.handlers {
+		if h.types[eventType] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// runEvents периодически сравнивает состояние загрузок с предыдущим
+// и публикует прогресс и завершение загрузки файлов
+func (tm *TorrentManager) runEvents() {
+	ticker := time.NewTicker(eventInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-tm.closed:
+			return
+		case <-ticker.C:
+			tm.checkProgress()
+		}
+	}
+}
+
+func (tm *TorrentManager) checkProgress() {
+	notify := tm.hasListeners(EventProgress)
+	notifyFiles := tm.hasListeners(EventCompleted)
+	seen := make(map[string]bool)
+	seenFiles := make(map[string]bool)
+
+	for _, t := range tm.client.Torrents() {
+		if t.Info() == nil {
+			continue
+		}
+
+		hash := t.InfoHash().String()
+		seen[hash] = true
+
+		completed := t.BytesCompleted()
+		tm.events.mu.Lock()
+		prev, known := tm.events.completed[hash]
+		tm.events.completed[hash] = completed
+		tm.events.mu.Unlock()
+
+		if notify && known && completed != prev {
+			tm.Publish(Event{Type: EventProgress, Hash: hash, Stats: tm.torrentStats(t, false)})
+		}
+
+		for _, f := range t.Files() {
+			if !tm.isValidFile(f) {
+				continue
+			}
+
+			fileId := generateFileID(f)
+			seenFiles[fileId] = true
+			tm.checkFile(hash, fileId, f, known && notifyFiles)
+		}
+	}
+
+	// Забываем удаленные торренты
+	tm.events.mu.Lock()
+	for hash := range tm.events.completed {
+		if !seen[hash] {
+			delete(tm.events.completed, hash)
+		}
+	}
+	for fileId := range tm.events.files {
+		if !seenFiles[fileId] {
+			delete(tm.events.files, fileId)
+		}
+	}
+	tm.events.mu.Unlock()
+}
+
+// checkFile публикует завершение загрузки файла. При первой проверке
+// состояние только запоминается, чтобы не сообщать о давно загруженных файлах.
+func (tm *TorrentManager) checkFile(hash string, fileId string, f *torrent.File, notify bool) {
+	done := f.Length() > 0 && f.BytesCompleted() == f.Length()
+
+	tm.events.mu.Lock()
+	prev, known := tm.events.files[fileId]
+	tm.events.files[fileId] = done
+	tm.events.mu.Unlock()
+
+	if notify && known && done && !prev {
+		tm.Publish(Event{Type: EventCompleted, Hash: hash, FileId: fileId})
+	}
+}
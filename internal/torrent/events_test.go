@@ -0,0 +1,43 @@
+package torrent
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestOnEventsDeliversEveryEvent(t *testing.T) {
+	tm := &TorrentManager{events: newEventHub()}
+
+	var (
+		mu       sync.Mutex
+		received []EventType
+		wg       sync.WaitGroup
+	)
+	tm.OnEvents(func(e Event) {
+		mu.Lock()
+		received = append(received, e.Type)
+		mu.Unlock()
+		wg.Done()
+	}, EventCompleted)
+
+	// Больше событий, чем вмещает буфер подписчика
+	const count = eventBuffer * 4
+	wg.Add(count)
+	for range count {
+		tm.Publish(Event{Type: EventCompleted})
+		tm.Publish(Event{Type: EventProgress})
+	}
+	wg.Wait()
+
+	if len(received) != count {
+		t.Fatalf("received %d events, want %d", len(received), count)
+	}
+	for _, e := range received {
+		if e != EventCompleted {
+			t.Fatalf("received %s event, want only %s", e, EventCompleted)
+		}
+	}
+	if tm.hasListeners(EventProgress) {
+		t.Error("progress events have no listeners")
+	}
+}
@@ -0,0 +1,68 @@
+package torrent
+
+import (
+	"context"
+	"io"
+	"log"
+	"path"
+	"slices"
+	"strings"
+
+	"retreat-backend/internal/mp4"
+	"retreat-backend/internal/reader"
+
+	"github.com/anacrolix/torrent"
+)
+
+// faststartTypes содержит расширения файлов с разметкой атомов MP4
+var faststartTypes = []string{".mp4", ".m4v", ".mov"}
+
+// faststartLayout хранит разметку "виртуального" файла с moov в начале.
+// Пустой список сегментов означает, что перестановка не нужна.
+type faststartLayout struct {
+	segments []reader.Segment
+}
+
+// faststartView возвращает view файла, в котором атом moov перенесен в начало,
+// чтобы браузер мог начать воспроизведение, не дожидаясь конца файла.
+// Если перестановка не нужна или невозможна, возвращается исходный reader.
+func (tm *TorrentManager) faststartView(ctx context.Context, file *torrent.File, fileId string, rs io.ReadSeeker) io.ReadSeeker {
+	ext := strings.ToLower(path.Ext(file.Path()))
+	if !slices.Contains(faststartTypes, ext) {
+		return rs
+	}
+
+	tm.mu.Lock()
+	layout, ok := tm.faststart[fileId]
+	tm.mu.Unlock()
+
+	if !ok {
+		// Разметка читается отдельным reader, чтобы не сбивать упреждающее чтение потока
+		r := file.NewReader()
+		defer r.Close()
+		r.SetResponsive()
+
+		segments, needed, err := mp4.Faststart(readerWithContext{ctx: ctx, reader: r}, file.Length())
+		if err != nil {
+			log.Printf("Faststart is not available for %s: %v", file.DisplayPath(), err)
+			if ctx.Err() != nil {
+				return rs
+			}
+		}
+
+		layout = &faststartLayout{}
+		if needed {
+			layout.segments = segments
+		}
+
+		tm.mu.Lock()
+		tm.faststart[fileId] = layout
+		tm.mu.Unlock()
+	}
+
+	if len(layout.segments) == 0 {
+		return rs
+	}
+
+	return reader.NewSegmentReader(rs, layout.segments)
+}
@@ -0,0 +1,194 @@
+package torrent
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+
+	"retreat-backend/internal/hls"
+	"retreat-backend/internal/remux"
+
+	"github.com/anacrolix/torrent"
+)
+
+// hlsTypes содержит расширения Matroska, которые нарезаются по индексу Cues
+var hlsTypes = []string{".mkv", ".webm"}
+
+// hlsKey определяет источник HLS: индекс зависит от выбранной аудиодорожки
+type hlsKey struct {
+	fileId string
+	audio  int
+}
+
+// hlsEntry хранит индекс, который строится или уже построен. done
+// закрывается, когда source и err заполнены.
+type hlsEntry struct {
+	done   chan struct{}
+	source hls.Source
+	err    error
+}
+
+// HLSPlaylist отдает медиаплейлист файла. query добавляется к адресам
+// сегментов, чтобы передать токен и выбранную дорожку.
+func (tm *TorrentManager) HLSPlaylist(w http.ResponseWriter, r *http.Request, id string, fileId string, audio int, query string) error {
+	_, source, err := tm.hlsSource(r.Context(), id, fileId, audio)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	if r.Method == http.MethodHead {
+		return nil
+	}
+
+	return hls.WritePlaylist(w, source.Segments(), query)
+}
+
+// HLSInit отдает сегмент инициализации фрагментированного MP4
+func (tm *TorrentManager) HLSInit(w http.ResponseWriter, r *http.Request, id string, fileId string, audio int) error {
+	_, source, err := tm.hlsSource(r.Context(), id, fileId, audio)
+	if err != nil {
+		return err
+	}
+
+	return writeHLS(w, r, source.WriteInit)
+}
+
+// HLSSegment собирает сегмент из диапазона файла между ключевыми кадрами.
+// Данные читаются потоковым reader, поэтому нужные части загружаются в приоритете.
+func (tm *TorrentManager) HLSSegment(w http.ResponseWriter, r *http.Request, id string, fileId string, audio int, index int) error {
+	file, source, err := tm.hlsSource(r.Context(), id, fileId, audio)
+	if err != nil {
+		return err
+	}
+	if index < 0 || index >= len(source.Segments()) {
+		return fmt.Errorf("segment not found: %d", index)
+	}
+
+	hash := file.Torrent().InfoHash().String()
+	tm.cache.touch(hash)
+	tm.beginStream(hash)
+	defer tm.endStream(hash)
+
+	reader := tm.newStreamReader(r.Context(), file, tm.mediaDuration(fileId))
+	defer reader.Close()
+	reader.SetResponsive()
+
+	return writeHLS(w, r, func(w io.Writer) error {
+		return source.WriteSegment(w, reader, index)
+	})
+}
+
+// writeHLS собирает ответ в памяти, чтобы ошибка чтения вернулась
+// клиенту кодом ответа, а не оборванным сегментом
+func writeHLS(w http.ResponseWriter, r *http.Request, write func(io.Writer) error) error {
+	var buf bytes.Buffer
+	if err := write(&buf); err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "video/mp4")
+	w.Header().Set("Content-Length", fmt.Sprint(buf.Len()))
+	w.Header().Set("Cache-Control", "max-age=3600")
+	w.WriteHeader(http.StatusOK)
+
+	if r.Method == http.MethodHead {
+		return nil
+	}
+
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// hlsSource возвращает индекс сегментов файла, строя его при первом обращении
+func (tm *TorrentManager) hlsSource(ctx context.Context, id string, fileId string, audio int) (*torrent.File, hls.Source, error) {
+	t, ok := tm.torrent(id)
+	if !ok {
+		return nil, nil, fmt.Errorf("torrent not found: %s", id)
+	}
+
+	for _, file := range t.Files() {
+		if generateFileID(file) != fileId || !tm.isValidFile(file) {
+			continue
+		}
+
+		key := hlsKey{fileId: fileId, audio: audio}
+
+		// Индекс строит первый запрос, остальные дожидаются его результата
+		tm.mu.Lock()
+		entry, ok := tm.hls[key]
+		if !ok {
+			entry = &hlsEntry{done: make(chan struct{})}
+			tm.hls[key] = entry
+		}
+		tm.mu.Unlock()
+
+		if !ok {
+			// Построение не прерывается уходом первого клиента, его
+			// результат нужен остальным; время ограничено probeTimeout
+			entry.source, entry.err = newHLSSource(context.WithoutCancel(ctx), file, audio)
+			if entry.err != nil {
+				// Ошибку не кэшируем: следующий запрос построит индекс заново
+				tm.mu.Lock()
+				if tm.hls[key] == entry {
+					delete(tm.hls, key)
+				}
+				tm.mu.Unlock()
+			}
+			close(entry.done)
+		}
+
+		select {
+		case <-entry.done:
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		}
+		if entry.err != nil {
+			return nil, nil, entry.err
+		}
+
+		return file, entry.source, nil
+	}
+
+	return nil, nil, fmt.Errorf("file not found: %s", fileId)
+}
+
+// newHLSSource читает заголовки и индекс контейнера. Индекс читается
+// отдельным reader с небольшим упреждением, как при разборе заголовков.
+func newHLSSource(ctx context.Context, file *torrent.File, audio int) (hls.Source, error) {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	reader := file.NewReader()
+	defer reader.Close()
+	reader.SetResponsive()
+	reader.SetReadahead(probeReadahead)
+	rs := readerWithContext{ctx: ctx, reader: reader}
+
+	ext := strings.ToLower(path.Ext(file.Path()))
+	switch {
+	case slices.Contains(faststartTypes, ext):
+		return hls.NewMP4Source(rs, file.Length(), audio)
+	case slices.Contains(hlsTypes, ext):
+		return remux.NewSegmenter(rs, file.Length(), audio)
+	default:
+		return nil, fmt.Errorf("%w: %s", hls.ErrUnsupported, ext)
+	}
+}
+
+// dropHLS удаляет индексы файла. Вызывается под tm.mu.
+func (tm *TorrentManager) dropHLS(fileId string) {
+	for key := range tm.hls {
+		if key.fileId == fileId {
+			delete(tm.hls, key)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package torrent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// inspectPeerWait задает время сбора пиров для оценки числа сидов
+const inspectPeerWait = 5 * time.Second
+
+// Preview описывает торрент до добавления в библиотеку
+type Preview struct {
+	Id       string         `json:"id"`
+	Name     string         `json:"name"`
+	Size     int64          `json:"size"`
+	Files    []*PreviewFile `json:"files"`
+	Playable int            `json:"playable"` // Число файлов, которые можно воспроизвести
+	Trackers []string       `json:"trackers"`
+	Seeders  int            `json:"seeders"` // Сиды, к которым удалось подключиться за время осмотра
+	Peers    int            `json:"peers"`   // Все известные пиры
+}
+
+// PreviewFile описывает файл торрента до добавления в библиотеку.
+// Id совпадает с ID файла после добавления.
+type PreviewFile struct {
+	Id       string `json:"id"`
+	Name     string `json:"name"`
+	Size     int64  `json:"size"`
+	Playable bool   `json:"playable"`
+	Subtitle bool   `json:"subtitle"`
+}
+
+// InspectMagnet получает метаданные магнет-ссылки и описывает торрент.
+// Торрент не загружается и удаляется из клиента после осмотра.
+func (tm *TorrentManager) InspectMagnet(ctx context.Context, uri string) (*Preview, error) {
+	m, err := metainfo.ParseMagnetUri(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	return tm.inspect(ctx, m.InfoHash, func() (*torrent.Torrent, error) {
+		return tm.client.AddMagnet(uri)
+	})
+}
+
+// InspectFile описывает торрент из .torrent файла, не добавляя его в библиотеку
+func (tm *TorrentManager) InspectFile(ctx context.Context, torrentFile io.Reader) (*Preview, error) {
+	mi, err := metainfo.Load(torrentFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse torrent file: %w", err)
+	}
+	if _, err := mi.UnmarshalInfo(); err != nil {
+		return nil, fmt.Errorf("failed to parse torrent file: %w", err)
+	}
+
+	return tm.inspect(ctx, mi.HashInfoBytes(), func() (*torrent.Torrent, error) {
+		return tm.client.AddTorrent(mi)
+	})
+}
+
+// inspect временно добавляет торрент в клиент, чтобы получить метаданные
+// и оценить число сидов. Торрент, уже добавленный в клиент, не удаляется.
+func (tm *TorrentManager) inspect(ctx context.Context, hash metainfo.Hash, add func() (*torrent.Torrent, error)) (*Preview, error) {
+	id := hash.String()
+
+	tm.mu.Lock()
+	t, existing := tm.client.Torrent(hash)
+	if !existing {
+		var err error
+		if t, err = add(); err != nil {
+			tm.mu.Unlock()
+			return nil, err
+		}
+	}
+	n, preview := tm.previews[id]
+	if !existing || preview {
+		tm.previews[id] = n + 1
+	}
+	tm.mu.Unlock()
+
+	defer tm.releasePreview(id, t)
+
+	timeout := time.NewTimer(tm.metadataTimeout)
+	defer timeout.Stop()
+
+	select {
+	case <-t.GotInfo():
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-timeout.C:
+		return nil, errors.New("metadata timeout")
+	}
+
+	// Пиры торрента, уже добавленного в клиент, известны
+	if !existing {
+		select {
+		case <-time.After(inspectPeerWait):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	return tm.preview(t), nil
+}
+
+// releasePreview удаляет торрент из клиента после последнего осмотра,
+// если его не добавили в библиотеку за это время
+func (tm *TorrentManager) releasePreview(id string, t *torrent.Torrent) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	n, ok := tm.previews[id]
+	if !ok {
+		return
+	}
+
+	if n > 1 {
+		tm.previews[id] = n - 1
+		return
+	}
+
+	delete(tm.previews, id)
+	t.Drop()
+}
+
+// claimPreview оставляет в клиенте торрент, добавляемый в библиотеку во время осмотра.
+// Возвращает true, если торрент был добавлен только для осмотра.
+func (tm *TorrentManager) claimPreview(hash metainfo.Hash) bool {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	_, ok := tm.previews[hash.String()]
+	delete(tm.previews, hash.String())
+	return ok
+}
+
+func (tm *TorrentManager) preview(t *torrent.Torrent) *Preview {
+	stats := t.Stats()
+
+	p := &Preview{
+		Id:       t.InfoHash().String(),
+		Name:     t.Name(),
+		Size:     t.Length(),
+		Files:    make([]*PreviewFile, 0, len(t.Files())),
+		Trackers: []string{},
+		Seeders:  stats.ConnectedSeeders,
+		Peers:    stats.TotalPeers,
+	}
+
+	for _, f := range t.Files() {
+		file := &PreviewFile{
+			Id:       generateFileID(f),
+			Name:     f.DisplayPath(),
+			Size:     f.Length(),
+			Playable: tm.isValidFile(f),
+			Subtitle: tm.isSubtitleFile(f),
+		}
+		if file.Playable {
+			p.Playable++
+		}
+		p.Files = append(p.Files, file)
+	}
+
+	mi := t.Metainfo()
+	for _, tracker := range mi.UpvertedAnnounceList().DistinctValues() {
+		p.Trackers = append(p.Trackers, tracker)
+	}
+	sort.Strings(p.Trackers)
+
+	return p
+}
@@ -0,0 +1,173 @@
+package torrent
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// JobState описывает состояние задачи добавления торрента
+type JobState string
+
+const (
+	JobPendingMetadata JobState = "pending-metadata"
+	JobReady           JobState = "ready"
+	JobFailed          JobState = "failed"
+	JobCancelled       JobState = "cancelled"
+)
+
+var (
+	ErrJobNotFound = errors.New("job not found")
+	ErrJobFinished = errors.New("job already finished")
+)
+
+// jobRetention определяет, сколько завершенная задача остается доступной для опроса
+const jobRetention = time.Hour
+
+// Job содержит состояние асинхронного добавления магнет-ссылки
+type Job struct {
+	Id      string       `json:"id"`
+	Hash    string       `json:"hash"`
+	Name    string       `json:"name"`
+	State   JobState     `json:"state"`
+	Error   string       `json:"error,omitempty"`
+	Torrent *TorrentInfo `json:"torrent,omitempty"`
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// Done возвращает канал, который закрывается после завершения задачи
+func (j *Job) Done() <-chan struct{} {
+	return j.done
+}
+
+// AddMagnetAsync добавляет магнет-ссылку и сразу возвращает задачу,
+// метаданные загружаются в фоне с ограничением по времени
+func (tm *TorrentManager) AddMagnetAsync(uri string) (*Job, error) {
+	existing := false
+	if m, err := metainfo.ParseMagnetUri(uri); err == nil {
+		// Торрент, добавленный только для осмотра, удаляется при неудаче как новый
+		previewed := tm.claimPreview(m.InfoHash)
+		_, existing = tm.client.Torrent(m.InfoHash)
+		existing = existing && !previewed
+	}
+
+	t, err := tm.client.AddMagnet(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), tm.metadataTimeout)
+	job := &Job{
+		Id:     generateJobID(),
+		Hash:   t.InfoHash().String(),
+		Name:   t.Name(),
+		State:  JobPendingMetadata,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+
+	tm.jobsMu.Lock()
+	tm.jobs[job.Id] = job
+	tm.jobsMu.Unlock()
+
+	go func() {
+		defer cancel()
+
+		var (
+			info *TorrentInfo
+			err  error
+		)
+		select {
+		case <-t.GotInfo():
+			info, err = tm.addLoadedTorrent(t)
+		case <-ctx.Done():
+			err = ctx.Err()
+			if !existing {
+				t.Drop()
+			}
+		}
+
+		tm.jobsMu.Lock()
+		switch {
+		case err == nil:
+			job.State = JobReady
+			job.Torrent = info
+			job.Name = info.Name
+		case errors.Is(err, context.Canceled):
+			job.State = JobCancelled
+			job.Error = "cancelled"
+		case errors.Is(err, context.DeadlineExceeded):
+			job.State = JobFailed
+			job.Error = "metadata timeout"
+		default:
+			job.State = JobFailed
+			job.Error = err.Error()
+		}
+		tm.jobsMu.Unlock()
+
+		log.Printf("Magnet job %s finished: %s", job.Id, job.State)
+		close(job.done)
+
+		time.AfterFunc(jobRetention, func() {
+			tm.jobsMu.Lock()
+			delete(tm.jobs, job.Id)
+			tm.jobsMu.Unlock()
+		})
+	}()
+
+	return job, nil
+}
+
+// GetJob возвращает снимок состояния задачи по ID
+func (tm *TorrentManager) GetJob(id string) (*Job, bool) {
+	tm.jobsMu.Lock()
+	defer tm.jobsMu.Unlock()
+
+	job, ok := tm.jobs[id]
+	if !ok {
+		return nil, false
+	}
+
+	snapshot := *job
+	return &snapshot, true
+}
+
+// CancelJob отменяет ожидание метаданных для задачи. Завершенную задачу
+// отменить нельзя.
+func (tm *TorrentManager) CancelJob(id string) error {
+	tm.jobsMu.Lock()
+	job, ok := tm.jobs[id]
+	tm.jobsMu.Unlock()
+
+	if !ok {
+		return ErrJobNotFound
+	}
+
+	select {
+	case <-job.done:
+		return ErrJobFinished
+	default:
+	}
+
+	job.cancel()
+	<-job.done
+
+	return nil
+}
+
+// generateJobID генерирует случайный ID задачи
+func generateJobID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,35 @@
+package torrent
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestCancelJob(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	pending := &Job{Id: "pending", State: JobPendingMetadata, cancel: cancel, done: make(chan struct{})}
+	finished := &Job{Id: "finished", State: JobReady, cancel: func() {}, done: make(chan struct{})}
+	close(finished.done)
+
+	// Задача завершается, когда ожидание метаданных отменено
+	go func() {
+		<-ctx.Done()
+		close(pending.done)
+	}()
+
+	tm := &TorrentManager{jobs: map[string]*Job{pending.Id: pending, finished.Id: finished}}
+
+	if err := tm.CancelJob("pending"); err != nil {
+		t.Errorf("CancelJob(pending) error = %v", err)
+	}
+	if err := tm.CancelJob("finished"); !errors.Is(err, ErrJobFinished) {
+		t.Errorf("CancelJob(finished) error = %v, want %v", err, ErrJobFinished)
+	}
+	if err := tm.CancelJob("pending"); !errors.Is(err, ErrJobFinished) {
+		t.Errorf("second CancelJob(pending) error = %v, want %v", err, ErrJobFinished)
+	}
+	if err := tm.CancelJob("missing"); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("CancelJob(missing) error = %v, want %v", err, ErrJobNotFound)
+	}
+}
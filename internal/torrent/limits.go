@@ -0,0 +1,26 @@
+package torrent
+
+import (
+	"golang.org/x/time/rate"
+)
+
+// limiterBurst должен вмещать целый кусок данных (16 КиБ) и буфер чтения соединения
+const limiterBurst = 256 << 10
+
+// newRateLimiter создает ограничитель скорости в байтах в секунду, 0 - без ограничений
+func newRateLimiter(bytesPerSecond int64) *rate.Limiter {
+	return rate.NewLimiter(rateLimit(bytesPerSecond), limiterBurst)
+}
+
+func rateLimit(bytesPerSecond int64) rate.Limit {
+	if bytesPerSecond <= 0 {
+		return rate.Inf
+	}
+	return rate.Limit(bytesPerSecond)
+}
+
+// SetRateLimits изменяет общие ограничения скорости загрузки и отдачи клиента
+func (tm *TorrentManager) SetRateLimits(downloadRate, uploadRate int64) {
+	tm.downloadLimiter.SetLimit(rateLimit(downloadRate))
+	tm.uploadLimiter.SetLimit(rateLimit(uploadRate))
+}
@@ -0,0 +1,120 @@
+package torrent
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"retreat-backend/internal/probe"
+
+	"github.com/anacrolix/torrent"
+)
+
+const (
+	// probeTimeout ограничивает ожидание загрузки заголовков файла
+	probeTimeout = 2 * time.Minute
+	// probeReadahead ограничивает упреждающее чтение при разборе заголовков
+	probeReadahead = 256 << 10
+)
+
+// ProbeFile возвращает сведения о медиафайле торрента, читая заголовки контейнера.
+// Результат кэшируется в памяти до удаления торрента.
+func (tm *TorrentManager) ProbeFile(id string, fileId string) (*probe.MediaInfo, error) {
+	if info, ok := tm.MediaInfo(fileId); ok {
+		return info, nil
+	}
+
+	t, ok := tm.torrent(id)
+	if !ok {
+		return nil, fmt.Errorf("torrent not found: %s", id)
+	}
+
+	for _, f := range t.Files() {
+		if generateFileID(f) != fileId || !tm.isValidFile(f) {
+			continue
+		}
+		// Чтение заголовков загрузило бы файл, который никто не выбрал
+		if tm.fileExcluded(f) {
+			return nil, fmt.Errorf("file is not selected: %s", fileId)
+		}
+
+		info, err := probeFile(f)
+		if err != nil {
+			return nil, fmt.Errorf("failed to probe %s: %w", f.DisplayPath(), err)
+		}
+
+		tm.SetMediaInfo(fileId, info)
+		return info, nil
+	}
+
+	return nil, fmt.Errorf("file not found: %s", fileId)
+}
+
+func probeFile(f *torrent.File) (*probe.MediaInfo, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), probeTimeout)
+	defer cancel()
+
+	reader := f.NewReader()
+	defer reader.Close()
+	reader.SetResponsive()
+	reader.SetReadahead(probeReadahead)
+
+	return probe.Probe(readerWithContext{ctx: ctx, reader: reader}, f.Length())
+}
+
+// MediaInfo возвращает сохраненные сведения о медиафайле
+func (tm *TorrentManager) MediaInfo(fileId string) (*probe.MediaInfo, bool) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	info, ok := tm.media[fileId]
+	return info, ok
+}
+
+// SetMediaInfo сохраняет сведения о медиафайле, например восстановленные из библиотеки
+func (tm *TorrentManager) SetMediaInfo(fileId string, info *probe.MediaInfo) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	tm.media[fileId] = info
+}
+
+// mediaDuration возвращает длительность файла или 0, если она неизвестна
+func (tm *TorrentManager) mediaDuration(fileId string) time.Duration {
+	if info, ok := tm.MediaInfo(fileId); ok {
+		return info.DurationTime()
+	}
+	return 0
+}
+
+// ProbeTorrent разбирает заголовки всех выбранных видеофайлов торрента, сведения
+// о которых еще не получены, и возвращает новые результаты
+func (tm *TorrentManager) ProbeTorrent(id string) map[string]*probe.MediaInfo {
+	t, ok := tm.torrent(id)
+	if !ok {
+		return nil
+	}
+
+	result := make(map[string]*probe.MediaInfo)
+	for _, f := range t.Files() {
+		fileId := generateFileID(f)
+		if !tm.isValidFile(f) || tm.fileExcluded(f) {
+			continue
+		}
+		if _, ok := tm.MediaInfo(fileId); ok {
+			continue
+		}
+
+		info, err := probeFile(f)
+		if err != nil {
+			log.Printf("Failed to probe %s: %v", f.DisplayPath(), err)
+			continue
+		}
+
+		tm.SetMediaInfo(fileId, info)
+		result[fileId] = info
+	}
+
+	return result
+}
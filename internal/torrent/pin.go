@@ -0,0 +1,72 @@
+package torrent
+
+import (
+	"fmt"
+
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// SetPinnedFiles задает набор файлов торрента, которые загружаются полностью в фоне.
+// Файлы, не вошедшие в набор, снова скачиваются только при воспроизведении.
+func (tm *TorrentManager) SetPinnedFiles(id string, fileIds []string) error {
+	var hash metainfo.Hash
+	if err := hash.FromHexString(id); err != nil {
+		return fmt.Errorf("hash is not valid: %s", id)
+	}
+
+	t, ok := tm.client.Torrent(hash)
+	if !ok {
+		return fmt.Errorf("torrent not found: %s", id)
+	}
+
+	pins := make(map[string]bool, len(fileIds))
+	for _, fileId := range fileIds {
+		pins[fileId] = true
+	}
+
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	for _, f := range t.Files() {
+		fileId := generateFileID(f)
+		if pins[fileId] == tm.pinned[fileId] {
+			continue
+		}
+
+		if pins[fileId] {
+			tm.pinned[fileId] = true
+		} else {
+			delete(tm.pinned, fileId)
+		}
+		tm.setFilePriority(f)
+	}
+
+	return nil
+}
+
+// isPinned сообщает, закреплен ли файл для полной загрузки
+func (tm *TorrentManager) isPinned(fileId string) bool {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	return tm.pinned[fileId]
+}
+
+// hasPins сообщает, закреплены ли файлы торрента для полной загрузки
+func (tm *TorrentManager) hasPins(id string) bool {
+	t, ok := tm.torrent(id)
+	if !ok || t.Info() == nil {
+		return false
+	}
+
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	for _, f := range t.Files() {
+		if tm.pinned[generateFileID(f)] {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,19 @@
+package torrent
+
+import "time"
+
+// watchedRatio задает долю длительности, после просмотра которой файл считается просмотренным
+const watchedRatio = 0.9
+
+// WatchProgress описывает, докуда пользователь досмотрел файл
+type WatchProgress struct {
+	Position  float64   `json:"position" bson:"position"` // Позиция в секундах
+	Duration  float64   `json:"duration" bson:"duration"` // Длительность в секундах, 0 - неизвестна
+	Watched   bool      `json:"watched" bson:"watched"`
+	UpdatedAt time.Time `json:"updated_at" bson:"updated_at"`
+}
+
+// Finished сообщает, что позиция дошла до конца файла
+func (p *WatchProgress) Finished() bool {
+	return p.Duration > 0 && p.Position >= p.Duration*watchedRatio
+}
@@ -0,0 +1,202 @@
+package torrent
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/torrent"
+)
+
+const (
+	// readaheadDuration определяет, на сколько секунд воспроизведения вперед загружаются данные
+	readaheadDuration = 30 * time.Second
+	minReadahead      = 2 << 20
+	maxReadahead      = 256 << 20
+
+	// speedWindow определяет период, за который измеряется скорость чтения
+	speedWindow = time.Second
+)
+
+// readWindow описывает область файла, загружаемую с повышенным приоритетом
+type readWindow struct {
+	start int64
+	end   int64
+}
+
+// streamReader оборачивает reader торрента и подбирает упреждающее чтение
+// по оценке битрейта файла и наблюдаемой скорости чтения
+type streamReader struct {
+	torrent.Reader
+
+	ctx     context.Context
+	tm      *TorrentManager
+	file    *torrent.File
+	fileId  string
+	bitrate float64 // Оценка битрейта файла в байтах в секунду
+
+	pos       int64
+	readahead int64
+
+	speed       float64 // Скорость чтения клиентом в байтах в секунду
+	windowStart time.Time
+	windowBytes int64
+}
+
+func (tm *TorrentManager) newStreamReader(ctx context.Context, file *torrent.File, duration time.Duration) *streamReader {
+	r := &streamReader{
+		Reader:      file.NewReader(),
+		ctx:         ctx,
+		tm:          tm,
+		file:        file,
+		fileId:      generateFileID(file),
+		bitrate:     estimateBitrate(file.Length(), duration),
+		windowStart: time.Now(),
+	}
+	r.updateReadahead()
+
+	return r
+}
+
+// estimateBitrate оценивает битрейт файла. Если длительность неизвестна,
+// она предполагается по размеру файла: серия для небольших файлов, фильм для крупных.
+func estimateBitrate(length int64, duration time.Duration) float64 {
+	if duration <= 0 {
+		duration = 45 * time.Minute
+		if length > 2<<30 {
+			duration = 2 * time.Hour
+		}
+	}
+
+	return float64(length) / duration.Seconds()
+}
+
+func (r *streamReader) Read(p []byte) (int, error) {
+	r.tm.moveWindow(r, readWindow{start: r.pos, end: r.pos + r.readahead})
+
+	n, err := r.Reader.ReadContext(r.ctx, p)
+	r.pos += int64(n)
+	r.measure(n)
+	r.updateReadahead()
+
+	return n, err
+}
+
+func (r *streamReader) Seek(offset int64, whence int) (int64, error) {
+	pos, err := r.Reader.Seek(offset, whence)
+	if err == nil {
+		r.pos = pos
+	}
+
+	return pos, err
+}
+
+// Close закрывает reader торрента и забывает его область чтения
+func (r *streamReader) Close() error {
+	r.tm.forgetWindow(r)
+
+	return r.Reader.Close()
+}
+
+// measure обновляет оценку скорости чтения клиентом
+func (r *streamReader) measure(n int) {
+	r.windowBytes += int64(n)
+
+	elapsed := time.Since(r.windowStart)
+	if elapsed < speedWindow {
+		return
+	}
+
+	current := float64(r.windowBytes) / elapsed.Seconds()
+	if r.speed == 0 {
+		r.speed = current
+	} else {
+		r.speed = 0.7*r.speed + 0.3*current
+	}
+
+	r.windowStart = time.Now()
+	r.windowBytes = 0
+}
+
+// updateReadahead подбирает размер упреждающего чтения: не меньше, чем нужно
+// для readaheadDuration воспроизведения, и больше, если клиент читает быстрее битрейта
+func (r *streamReader) updateReadahead() {
+	rate := max(r.bitrate, r.speed)
+
+	readahead := int64(rate * readaheadDuration.Seconds())
+	readahead = min(max(readahead, minReadahead), maxReadahead, r.file.Length())
+
+	if readahead != r.readahead {
+		r.readahead = readahead
+		r.Reader.SetReadahead(readahead)
+	}
+}
+
+// playheads хранит последнюю область чтения каждого открытого reader
+type playheads struct {
+	mu      sync.Mutex
+	windows map[*streamReader]readWindow
+}
+
+// moveWindow запоминает текущую область чтения reader. Если чтение началось
+// за пределами предыдущей области (перемотка), приоритет старой области снижается,
+// чтобы канал использовался для данных рядом с новой позицией. Области других
+// reader того же файла при этом не затрагиваются.
+func (tm *TorrentManager) moveWindow(r *streamReader, window readWindow) {
+	tm.playheads.mu.Lock()
+	prev, ok := tm.playheads.windows[r]
+	tm.playheads.windows[r] = window
+
+	// Текущие области чтения файла, включая новую, сохраняют приоритет
+	active := []readWindow{window}
+	for other, w := range tm.playheads.windows {
+		if other != r && other.fileId == r.fileId {
+			active = append(active, w)
+		}
+	}
+	tm.playheads.mu.Unlock()
+
+	if !ok || (window.start >= prev.start && window.start <= prev.end) {
+		return
+	}
+
+	if tm.isPinned(r.fileId) {
+		return
+	}
+
+	file := r.file
+	t := file.Torrent()
+	pieceLength := t.Info().PieceLength
+	offset := file.Offset()
+	pieces := func(w readWindow) (int, int) {
+		return int((offset + w.start) / pieceLength), int((offset + w.end + pieceLength - 1) / pieceLength)
+	}
+
+	begin, end := pieces(prev)
+	for i := max(begin, file.BeginPieceIndex()); i < min(end, file.EndPieceIndex()); i++ {
+		// Первый и последний куски нужны плееру для чтения заголовков
+		if i == file.BeginPieceIndex() || i == file.EndPieceIndex()-1 {
+			continue
+		}
+		if slices.ContainsFunc(active, func(w readWindow) bool {
+			b, e := pieces(w)
+			return i >= b && i < e
+		}) {
+			continue
+		}
+
+		p := t.Piece(i)
+		if !p.State().Complete {
+			p.SetPriority(torrent.PiecePriorityNone)
+		}
+	}
+}
+
+// forgetWindow удаляет область чтения закрытого reader
+func (tm *TorrentManager) forgetWindow(r *streamReader) {
+	tm.playheads.mu.Lock()
+	defer tm.playheads.mu.Unlock()
+
+	delete(tm.playheads.windows, r)
+}
@@ -0,0 +1,62 @@
+package torrent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"retreat-backend/internal/remux"
+)
+
+// StreamRemux отдает файл Matroska, перепакованный во фрагментированный MP4,
+// чтобы браузер мог воспроизвести H.264/AAC без перекодирования.
+// Поток начинается с ближайшей точки индекса перед opts.Start, ее время
+// передается в заголовке X-Start-Time.
+func (tm *TorrentManager) StreamRemux(w http.ResponseWriter, r *http.Request, id string, fileId string, opts remux.Options) error {
+	t, ok := tm.torrent(id)
+	if !ok {
+		return fmt.Errorf("torrent not found: %s", id)
+	}
+
+	for _, file := range t.Files() {
+		if generateFileID(file) != fileId || !tm.isValidFile(file) {
+			continue
+		}
+
+		hash := t.InfoHash().String()
+		tm.cache.touch(hash)
+		tm.beginStream(hash)
+		defer tm.endStream(hash)
+
+		reader := tm.newStreamReader(r.Context(), file, tm.mediaDuration(fileId))
+		defer reader.Close()
+		reader.SetResponsive()
+
+		remuxer, err := remux.New(reader, file.Length(), opts)
+		if err != nil {
+			return err
+		}
+
+		w.Header().Set("Content-Type", "video/mp4")
+		w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate, max-age=0")
+		w.Header().Set("X-Start-Time", strconv.FormatFloat(remuxer.Start().Seconds(), 'f', 3, 64))
+		w.Header().Set("Access-Control-Expose-Headers", "X-Start-Time")
+		w.WriteHeader(http.StatusOK)
+
+		if r.Method == http.MethodHead {
+			return nil
+		}
+
+		// Ответ уже начат, поэтому ошибки только записываются в журнал
+		if _, err := remuxer.WriteTo(w); err != nil && !errors.Is(err, context.Canceled) {
+			log.Printf("Remux of %s stopped: %v", file.DisplayPath(), err)
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("file not found: %s", fileId)
+}
@@ -0,0 +1,300 @@
+package torrent
+
+import (
+	"log"
+	"slices"
+	"time"
+
+	"github.com/anacrolix/torrent"
+)
+
+// seedCheckInterval определяет, как часто проверяется политика раздачи
+const seedCheckInterval = 30 * time.Second
+
+// SeedPolicy описывает условия, при которых торрент перестает раздаваться
+type SeedPolicy struct {
+	Ratio    float64 `json:"ratio" bson:"ratio"`         // Целевой рейтинг (отдано / получено), 0 - без ограничений
+	SeedTime int64   `json:"seed_time" bson:"seed_time"` // Максимальное время раздачи в секундах, 0 - без ограничений
+	NoUpload bool    `json:"no_upload" bson:"no_upload"` // Никогда не отдавать данные
+}
+
+// SeedState описывает состояние раздачи торрента
+type SeedState string
+
+const (
+	SeedSeeding      SeedState = "seeding"
+	SeedRatioReached SeedState = "ratio-reached"
+	SeedTimeReached  SeedState = "time-reached"
+	SeedDisabled     SeedState = "disabled"
+)
+
+// SeedResult содержит итог применения политики раздачи к торренту
+type SeedResult struct {
+	Hash     string    `json:"hash"`
+	State    SeedState `json:"state"`
+	Ratio    float64   `json:"ratio"`
+	SeedTime int64     `json:"seed_time"`
+}
+
+// SetSeedPolicy задает политики раздачи пользователей торрента, nil в списке означает
+// общую политику. Действует самая мягкая из политик.
+func (tm *TorrentManager) SetSeedPolicy(id string, policies []*SeedPolicy) {
+	tm.seedMu.Lock()
+	if policy := tm.combineSeedPolicies(policies); policy == nil {
+		delete(tm.seedPolicies, id)
+	} else {
+		tm.seedPolicies[id] = policy
+	}
+	// Политика изменилась, поэтому раздача проверяется заново
+	delete(tm.seedStates, id)
+	tm.seedMu.Unlock()
+
+	if t, ok := tm.torrent(id); ok {
+		t.AllowDataUpload()
+		tm.enforceSeedPolicy(t)
+	}
+}
+
+// combineSeedPolicies объединяет политики пользователей: отдача запрещается, только если
+// ее запретили все, а ограничения рейтинга и времени берутся наибольшие (0 - без ограничений).
+// nil означает, что действует общая политика. Вызывается под tm.seedMu.
+func (tm *TorrentManager) combineSeedPolicies(policies []*SeedPolicy) *SeedPolicy {
+	if !slices.ContainsFunc(policies, func(p *SeedPolicy) bool { return p != nil }) {
+		return nil
+	}
+
+	var combined *SeedPolicy
+	for _, p := range policies {
+		if p == nil {
+			p = &tm.seedPolicy
+		}
+		// Ограничения политики, запрещающей отдачу, не действуют
+		if p.NoUpload {
+			continue
+		}
+		if combined == nil {
+			combined = &SeedPolicy{Ratio: p.Ratio, SeedTime: p.SeedTime}
+			continue
+		}
+
+		if combined.Ratio > 0 && (p.Ratio == 0 || p.Ratio > combined.Ratio) {
+			combined.Ratio = p.Ratio
+		}
+		if combined.SeedTime > 0 && (p.SeedTime == 0 || p.SeedTime > combined.SeedTime) {
+			combined.SeedTime = p.SeedTime
+		}
+	}
+	if combined == nil {
+		combined = &SeedPolicy{NoUpload: true}
+	}
+
+	return combined
+}
+
+// SetSeedStarted восстанавливает время завершения загрузки, с которого отсчитывается раздача
+func (tm *TorrentManager) SetSeedStarted(id string, started time.Time) {
+	tm.seedMu.Lock()
+	defer tm.seedMu.Unlock()
+
+	tm.seedStarted[id] = started
+}
+
+// SetSeedUploaded восстанавливает объем данных, отданных за прошлые сеансы.
+// Статистика клиента считает отданное только с запуска, и рейтинг складывается из обоих.
+func (tm *TorrentManager) SetSeedUploaded(id string, uploaded int64) {
+	tm.seedMu.Lock()
+	defer tm.seedMu.Unlock()
+
+	tm.seedUploaded[id] = uploaded
+	tm.seedSaved[id] = max(tm.seedSaved[id], uploaded)
+}
+
+// StopSeeding прекращает раздачу торрента, например после перезапуска,
+// если политика уже была выполнена ранее
+func (tm *TorrentManager) StopSeeding(id string, state SeedState) {
+	tm.seedMu.Lock()
+	tm.seedStates[id] = state
+	tm.seedMu.Unlock()
+
+	if t, ok := tm.torrent(id); ok {
+		t.DisallowDataUpload()
+	}
+}
+
+// SeedPolicyFor возвращает действующую политику раздачи торрента
+func (tm *TorrentManager) SeedPolicyFor(id string) SeedPolicy {
+	tm.seedMu.Lock()
+	defer tm.seedMu.Unlock()
+
+	if policy, ok := tm.seedPolicies[id]; ok {
+		return *policy
+	}
+	return tm.seedPolicy
+}
+
+// SeedStateFor возвращает состояние раздачи торрента
+func (tm *TorrentManager) SeedStateFor(id string) SeedState {
+	tm.seedMu.Lock()
+	defer tm.seedMu.Unlock()
+
+	if state, ok := tm.seedStates[id]; ok {
+		return state
+	}
+	return SeedSeeding
+}
+
+// OnSeedingFinished задает обработчик, вызываемый, когда торрент перестает раздаваться
+func (tm *TorrentManager) OnSeedingFinished(handler func(SeedResult)) {
+	tm.seedMu.Lock()
+	defer tm.seedMu.Unlock()
+
+	tm.onSeedingFinished = handler
+}
+
+// OnSeedingStarted задает обработчик, вызываемый, когда загрузка торрента завершается
+// и начинается отсчет времени раздачи
+func (tm *TorrentManager) OnSeedingStarted(handler func(id string, started time.Time)) {
+	tm.seedMu.Lock()
+	defer tm.seedMu.Unlock()
+
+	tm.onSeedingStarted = handler
+}
+
+// OnSeedUploaded задает обработчик, получающий объем данных, отданных за все сеансы,
+// когда он растет
+func (tm *TorrentManager) OnSeedUploaded(handler func(id string, uploaded int64)) {
+	tm.seedMu.Lock()
+	defer tm.seedMu.Unlock()
+
+	tm.onSeedUploaded = handler
+}
+
+// runSeeding периодически применяет политику раздачи ко всем торрентам
+func (tm *TorrentManager) runSeeding() {
+	ticker := time.NewTicker(seedCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-tm.closed:
+			return
+		case <-ticker.C:
+			for _, t := range tm.client.Torrents() {
+				tm.enforceSeedPolicy(t)
+			}
+		}
+	}
+}
+
+// enforceSeedPolicy прекращает раздачу торрента, если выполнено условие политики
+func (tm *TorrentManager) enforceSeedPolicy(t *torrent.Torrent) {
+	if t.Info() == nil {
+		return
+	}
+
+	id := t.InfoHash().String()
+	policy := tm.SeedPolicyFor(id)
+	uploaded := tm.uploadedTotal(t)
+
+	tm.seedMu.Lock()
+	_, finished := tm.seedStates[id]
+	started, ok := tm.seedStarted[id]
+	tm.seedMu.Unlock()
+
+	if finished {
+		return
+	}
+
+	// Время раздачи отсчитывается с завершения загрузки выбранных файлов
+	if !ok && tm.downloadComplete(t) {
+		started, ok = time.Now(), true
+
+		tm.seedMu.Lock()
+		tm.seedStarted[id] = started
+		handler := tm.onSeedingStarted
+		tm.seedMu.Unlock()
+
+		if handler != nil {
+			handler(id, started)
+		}
+	}
+
+	var seedTime time.Duration
+	if ok {
+		seedTime = time.Since(started)
+	}
+
+	var ratio float64
+	if completed := t.BytesCompleted(); completed > 0 {
+		ratio = float64(uploaded) / float64(completed)
+	}
+
+	var state SeedState
+	switch {
+	case policy.NoUpload:
+		state = SeedDisabled
+	// Пока загрузка идет, отдача нужна для обмена с пирами, поэтому рейтинг
+	// проверяется, как и время, только после ее завершения
+	case ok && policy.Ratio > 0 && ratio >= policy.Ratio:
+		state = SeedRatioReached
+	case ok && policy.SeedTime > 0 && seedTime >= time.Duration(policy.SeedTime)*time.Second:
+		state = SeedTimeReached
+	default:
+		return
+	}
+
+	t.DisallowDataUpload()
+
+	tm.seedMu.Lock()
+	tm.seedStates[id] = state
+	handler := tm.onSeedingFinished
+	tm.seedMu.Unlock()
+
+	log.Printf("Seeding of %s stopped: %s (ratio %.2f)", id, state, ratio)
+
+	if handler != nil {
+		handler(SeedResult{
+			Hash:     id,
+			State:    state,
+			Ratio:    ratio,
+			SeedTime: int64(seedTime.Seconds()),
+		})
+	}
+}
+
+// uploadedTotal возвращает объем данных торрента, отданных за все сеансы,
+// и сообщает обработчику, если он вырос
+func (tm *TorrentManager) uploadedTotal(t *torrent.Torrent) int64 {
+	id := t.InfoHash().String()
+	stats := t.Stats()
+	session := stats.BytesWrittenData.Int64()
+
+	tm.seedMu.Lock()
+	total := tm.seedUploaded[id] + session
+	grown := total > tm.seedSaved[id]
+	if grown {
+		tm.seedSaved[id] = total
+	}
+	handler := tm.onSeedUploaded
+	tm.seedMu.Unlock()
+
+	if grown && handler != nil {
+		handler(id, total)
+	}
+
+	return total
+}
+
+// downloadComplete сообщает, что все файлы торрента, выбранные пользователями, загружены
+func (tm *TorrentManager) downloadComplete(t *torrent.Torrent) bool {
+	for _, f := range t.Files() {
+		if tm.fileExcluded(f) {
+			continue
+		}
+		if f.BytesCompleted() < f.Length() {
+			return false
+		}
+	}
+
+	return true
+}
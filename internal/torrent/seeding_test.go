@@ -0,0 +1,33 @@
+package torrent
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCombineSeedPolicies(t *testing.T) {
+	tm := &TorrentManager{seedPolicy: SeedPolicy{Ratio: 2, SeedTime: 3600}}
+
+	tests := []struct {
+		name     string
+		policies []*SeedPolicy
+		want     *SeedPolicy
+	}{
+		{"no owners", nil, nil},
+		{"only global", []*SeedPolicy{nil, nil}, nil},
+		{"single custom", []*SeedPolicy{{Ratio: 1}}, &SeedPolicy{Ratio: 1}},
+		{"higher ratio wins", []*SeedPolicy{{Ratio: 1, SeedTime: 60}, {Ratio: 3, SeedTime: 30}}, &SeedPolicy{Ratio: 3, SeedTime: 60}},
+		{"unlimited wins", []*SeedPolicy{{Ratio: 1, SeedTime: 60}, {}}, &SeedPolicy{}},
+		{"upload allowed by one owner", []*SeedPolicy{{NoUpload: true}, {Ratio: 1}}, &SeedPolicy{Ratio: 1}},
+		{"upload disabled by all", []*SeedPolicy{{NoUpload: true}, {NoUpload: true}}, &SeedPolicy{NoUpload: true}},
+		{"global for owners without policy", []*SeedPolicy{{Ratio: 1, SeedTime: 60}, nil}, &SeedPolicy{Ratio: 2, SeedTime: 3600}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tm.combineSeedPolicies(tt.policies); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("combineSeedPolicies() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
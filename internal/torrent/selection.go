@@ -0,0 +1,92 @@
+package torrent
+
+import (
+	"fmt"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// SetSelectedFiles задает файлы торрента, выбранные хотя бы одним пользователем,
+// nil выбирает все файлы. Остальные файлы не получают приоритета. Выбор можно
+// задать до добавления торрента в клиент, тогда он применится при обработке файлов.
+func (tm *TorrentManager) SetSelectedFiles(id string, fileIds []string) error {
+	var hash metainfo.Hash
+	if err := hash.FromHexString(id); err != nil {
+		return fmt.Errorf("hash is not valid: %s", id)
+	}
+
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	if fileIds == nil {
+		delete(tm.selected, id)
+	} else {
+		selected := make(map[string]bool, len(fileIds))
+		for _, fileId := range fileIds {
+			selected[fileId] = true
+		}
+		tm.selected[id] = selected
+	}
+
+	t, ok := tm.client.Torrent(hash)
+	if !ok || t.Info() == nil {
+		return nil
+	}
+	tm.selectSubtitles(t)
+
+	// Крайние куски исключенного файла могут принадлежать соседнему,
+	// поэтому приоритеты выбранных файлов задаются заново после снятия
+	for _, f := range t.Files() {
+		if tm.isExcluded(f) {
+			clearStreamingPriorities(f)
+		}
+	}
+	for _, f := range t.Files() {
+		tm.setFilePriority(f)
+	}
+
+	return nil
+}
+
+// selectSubtitles добавляет к выбору субтитры, связанные с выбранными видео.
+// Вызывается под tm.mu после получения метаданных.
+func (tm *TorrentManager) selectSubtitles(t *torrent.Torrent) {
+	selected, ok := tm.selected[t.InfoHash().String()]
+	if !ok {
+		return
+	}
+
+	for video, subtitles := range tm.matchSubtitles(t.Files()) {
+		if !selected[generateFileID(video)] {
+			continue
+		}
+		for _, s := range subtitles {
+			selected[s.Id] = true
+		}
+	}
+}
+
+// isExcluded сообщает, что файл не выбран ни одним пользователем. Вызывается под tm.mu.
+func (tm *TorrentManager) isExcluded(f *torrent.File) bool {
+	selected, ok := tm.selected[f.Torrent().InfoHash().String()]
+	return ok && !selected[generateFileID(f)]
+}
+
+// fileExcluded сообщает, что файл не выбран ни одним пользователем
+func (tm *TorrentManager) fileExcluded(f *torrent.File) bool {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	return tm.isExcluded(f)
+}
+
+// clearStreamingPriorities снимает приоритет с крайних кусков файла
+func clearStreamingPriorities(f *torrent.File) {
+	t := f.Torrent()
+
+	if f.BeginPieceIndex() < f.EndPieceIndex() {
+		t.Piece(f.EndPieceIndex() - 1).SetPriority(torrent.PiecePriorityNone)
+		t.Piece(f.BeginPieceIndex()).SetPriority(torrent.PiecePriorityNone)
+	}
+}
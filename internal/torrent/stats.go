@@ -0,0 +1,149 @@
+package torrent
+
+import (
+	"sync"
+	"time"
+
+	"github.com/anacrolix/torrent"
+)
+
+// rateSampleInterval определяет минимальный интервал между замерами скорости
+const rateSampleInterval = time.Second
+
+// TorrentStats содержит текущее состояние передачи данных торрента
+type TorrentStats struct {
+	DownloadRate   int64   `json:"download_rate"` // Байт в секунду
+	UploadRate     int64   `json:"upload_rate"`   // Байт в секунду
+	Peers          int     `json:"peers"`
+	Seeds          int     `json:"seeds"`
+	BytesCompleted int64   `json:"bytes_completed"`
+	Length         int64   `json:"length"`
+	ETA            int64   `json:"eta"`          // Секунд до завершения, -1 если неизвестно
+	Availability   float64 `json:"availability"` // Количество распределенных копий у подключенных пиров
+
+	PieceAvailability []int `json:"piece_availability,omitempty"` // Количество пиров, имеющих каждый кусок
+}
+
+// rateSample хранит последний замер счетчиков торрента
+type rateSample struct {
+	time         time.Time
+	bytesRead    int64
+	bytesWritten int64
+	downloadRate int64
+	uploadRate   int64
+}
+
+// rateMeter вычисляет скорость загрузки и отдачи по счетчикам Torrent.Stats()
+type rateMeter struct {
+	mu      sync.Mutex
+	samples map[string]*rateSample
+}
+
+// rates возвращает скорость загрузки и отдачи торрента в байтах в секунду
+func (m *rateMeter) rates(hash string, stats *torrent.TorrentStats) (int64, int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	read := stats.BytesReadData.Int64()
+	written := stats.BytesWrittenData.Int64()
+
+	s, ok := m.samples[hash]
+	if !ok {
+		m.samples[hash] = &rateSample{time: now, bytesRead: read, bytesWritten: written}
+		return 0, 0
+	}
+
+	elapsed := now.Sub(s.time)
+	if elapsed >= rateSampleInterval {
+		s.downloadRate = int64(float64(read-s.bytesRead) / elapsed.Seconds())
+		s.uploadRate = int64(float64(written-s.bytesWritten) / elapsed.Seconds())
+		s.time = now
+		s.bytesRead = read
+		s.bytesWritten = written
+	}
+
+	return s.downloadRate, s.uploadRate
+}
+
+func (m *rateMeter) forget(hash string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.samples, hash)
+}
+
+// torrentStats собирает статистику передачи данных торрента
+func (tm *TorrentManager) torrentStats(t *torrent.Torrent, withPieces bool) *TorrentStats {
+	stats := t.Stats()
+	downloadRate, uploadRate := tm.rates.rates(t.InfoHash().String(), &stats)
+
+	result := &TorrentStats{
+		DownloadRate: downloadRate,
+		UploadRate:   uploadRate,
+		Peers:        stats.ActivePeers,
+		Seeds:        stats.ConnectedSeeders,
+		ETA:          -1,
+	}
+
+	if t.Info() == nil {
+		return result
+	}
+
+	result.BytesCompleted = t.BytesCompleted()
+	result.Length = t.Length()
+
+	remaining := result.Length - result.BytesCompleted
+	switch {
+	case remaining <= 0:
+		result.ETA = 0
+	case downloadRate > 0:
+		result.ETA = remaining / downloadRate
+	}
+
+	availability := pieceAvailability(t)
+	result.Availability = distributedCopies(availability)
+	if withPieces {
+		result.PieceAvailability = availability
+	}
+
+	return result
+}
+
+// pieceAvailability подсчитывает, у скольких подключенных пиров есть каждый кусок
+func pieceAvailability(t *torrent.Torrent) []int {
+	availability := make([]int, t.NumPieces())
+
+	for _, pc := range t.PeerConns() {
+		pieces := pc.PeerPieces()
+		for i := range availability {
+			if pieces.Contains(uint32(i)) {
+				availability[i]++
+			}
+		}
+	}
+
+	return availability
+}
+
+// distributedCopies вычисляет число полных копий торрента среди пиров:
+// целая часть - минимальная доступность кусков, дробная - доля кусков с большей доступностью
+func distributedCopies(availability []int) float64 {
+	if len(availability) == 0 {
+		return 0
+	}
+
+	lowest := availability[0]
+	for _, a := range availability {
+		lowest = min(lowest, a)
+	}
+
+	above := 0
+	for _, a := range availability {
+		if a > lowest {
+			above++
+		}
+	}
+
+	return float64(lowest) + float64(above)/float64(len(availability))
+}
@@ -0,0 +1,155 @@
+package torrent
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/anacrolix/torrent"
+)
+
+const (
+	// maxSubtitleSize ограничивает размер читаемого файла субтитров
+	maxSubtitleSize = 10 << 20
+	// subtitleReadTimeout ограничивает ожидание загрузки файла субтитров
+	subtitleReadTimeout = time.Minute
+)
+
+// SubtitleInfo описывает файл субтитров, связанный с видео
+type SubtitleInfo struct {
+	Id       string `json:"id"`
+	Name     string `json:"name"`
+	Language string `json:"language,omitempty"`
+}
+
+// isSubtitleFile проверяет, является ли файл субтитрами
+func (tm *TorrentManager) isSubtitleFile(f *torrent.File) bool {
+	ext := strings.ToLower(path.Ext(f.Path()))
+	return slices.Contains(tm.subtitleTypes, ext)
+}
+
+// fileStem возвращает имя файла без каталога и расширения в нижнем регистре
+func fileStem(p string) string {
+	base := strings.ToLower(path.Base(p))
+	return strings.TrimSuffix(base, path.Ext(base))
+}
+
+// matchSubtitles связывает файлы субтитров с видео по имени. Субтитры вида
+// "Movie.en.srt" или "Movie.rus.ass" относятся к "Movie.mkv", а если видео
+// в торренте одно, к нему относятся все субтитры (например, из папки Subs).
+func (tm *TorrentManager) matchSubtitles(files []*torrent.File) map[*torrent.File][]*SubtitleInfo {
+	var videos, subtitles []*torrent.File
+	for _, f := range files {
+		switch {
+		case tm.isValidFile(f):
+			videos = append(videos, f)
+		case tm.isSubtitleFile(f):
+			subtitles = append(subtitles, f)
+		}
+	}
+
+	result := make(map[*torrent.File][]*SubtitleInfo)
+	for _, s := range subtitles {
+		subStem := fileStem(s.Path())
+
+		matched := false
+		for _, v := range videos {
+			videoStem := fileStem(v.Path())
+
+			var language string
+			switch {
+			case subStem == videoStem:
+			case strings.HasPrefix(subStem, videoStem+"."):
+				language = subtitleLanguage(strings.TrimPrefix(subStem, videoStem+"."))
+			default:
+				continue
+			}
+
+			result[v] = append(result[v], newSubtitleInfo(s, language))
+			matched = true
+		}
+
+		if !matched && len(videos) == 1 {
+			result[videos[0]] = append(result[videos[0]], newSubtitleInfo(s, subtitleLanguage(subStem)))
+		}
+	}
+
+	return result
+}
+
+func newSubtitleInfo(f *torrent.File, language string) *SubtitleInfo {
+	return &SubtitleInfo{
+		Id:       generateFileID(f),
+		Name:     f.DisplayPath(),
+		Language: language,
+	}
+}
+
+// subtitleLanguage извлекает язык из суффикса имени: "en", "forced.rus", "2_English"
+func subtitleLanguage(suffix string) string {
+	parts := strings.FieldsFunc(suffix, func(r rune) bool {
+		return r == '.' || r == '_' || r == '-' || r == ' '
+	})
+	if len(parts) == 0 {
+		return ""
+	}
+
+	// Код языка обычно последний: "forced.en", "sdh.eng"
+	for i := len(parts) - 1; i >= 0; i-- {
+		if isLanguageCode(parts[i]) {
+			return parts[i]
+		}
+	}
+
+	return parts[len(parts)-1]
+}
+
+// isLanguageCode проверяет, похожа ли строка на код языка ISO 639-1 или 639-2
+func isLanguageCode(s string) bool {
+	if len(s) != 2 && len(s) != 3 {
+		return false
+	}
+	for _, r := range s {
+		if r < 'a' || r > 'z' {
+			return false
+		}
+	}
+	return s != "sdh"
+}
+
+// ReadSubtitle возвращает содержимое файла субтитров торрента и его имя
+func (tm *TorrentManager) ReadSubtitle(id string, fileId string) ([]byte, string, error) {
+	t, ok := tm.torrent(id)
+	if !ok {
+		return nil, "", fmt.Errorf("torrent not found: %s", id)
+	}
+
+	for _, f := range t.Files() {
+		if generateFileID(f) != fileId || !tm.isSubtitleFile(f) {
+			continue
+		}
+		if f.Length() > maxSubtitleSize {
+			return nil, "", fmt.Errorf("subtitle file is too large: %d bytes", f.Length())
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), subtitleReadTimeout)
+		defer cancel()
+
+		reader := f.NewReader()
+		defer reader.Close()
+		reader.SetReadahead(f.Length())
+
+		data, err := io.ReadAll(readerWithContext{ctx: ctx, reader: reader})
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to read subtitle: %w", err)
+		}
+
+		return data, f.DisplayPath(), nil
+	}
+
+	return nil, "", fmt.Errorf("subtitle not found: %s", fileId)
+}
@@ -1,7 +1,9 @@
 package torrent
 
 import (
+	"context"
 	"crypto/md5"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -15,23 +17,82 @@ import (
 	"sync"
 	"time"
 
+	"retreat-backend/internal/probe"
+	"retreat-backend/internal/transcode"
+
 	"github.com/anacrolix/torrent"
 	"github.com/anacrolix/torrent/metainfo"
 	"github.com/anacrolix/torrent/storage"
+	"golang.org/x/time/rate"
 )
 
 // TorrentManager управляет загрузкой и обработкой торрент-файлов
 type TorrentManager struct {
-	mu           sync.Mutex
-	filetypes    []string
-	client       *torrent.Client
-	downloadPath string
+	mu            sync.Mutex
+	filetypes     []string
+	subtitleTypes []string
+	client        *torrent.Client
+	downloadPath  string
+	cacheQuota    int64
+	cache         *cacheIndex
+	streams       map[string]int
+	pinned        map[string]bool
+	selected      map[string]map[string]bool // Файлы, выбранные пользователями, по торрентам; нет записи — выбраны все
+	faststart     map[string]*faststartLayout
+	media         map[string]*probe.MediaInfo
+	hls           map[hlsKey]*hlsEntry
+	previews      map[string]int // Торренты, добавленные только для осмотра, и число осмотров
+	transcoder    transcode.Transcoder
+	events        *eventHub
+	playheads     playheads
+	rates         rateMeter
+	closed        chan struct{}
+
+	downloadLimiter *rate.Limiter
+	uploadLimiter   *rate.Limiter
+
+	metadataTimeout time.Duration
+	jobsMu          sync.Mutex
+	jobs            map[string]*Job
+
+	seedMu            sync.Mutex
+	seedPolicy        SeedPolicy
+	seedPolicies      map[string]*SeedPolicy
+	seedStates        map[string]SeedState
+	seedStarted       map[string]time.Time
+	seedUploaded      map[string]int64 // Отдано данных за прошлые сеансы
+	seedSaved         map[string]int64 // Объем отданных данных, о котором уже сообщено
+	onSeedingStarted  func(string, time.Time)
+	onSeedingFinished func(SeedResult)
+	onSeedUploaded    func(string, int64)
+}
+
+// Config содержит настройки менеджера торрентов
+type Config struct {
+	Filetypes     []string
+	SubtitleTypes []string
+	DownloadPath  string
+	CacheQuota    int64 // Максимальный размер кэша загрузок в байтах, 0 - без ограничений
+
+	MetadataTimeout time.Duration // Время ожидания метаданных магнет-ссылки
+
+	DownloadRateLimit int64 // Общее ограничение скорости загрузки в байтах в секунду, 0 - без ограничений
+	UploadRateLimit   int64 // Общее ограничение скорости отдачи в байтах в секунду, 0 - без ограничений
+
+	SeedPolicy SeedPolicy // Общая политика раздачи
+
+	Transcoder transcode.Transcoder // Перекодировщик для кодеков, которые не воспроизводит браузер
 }
 
 type FileInfo struct {
 	Id       string `json:"id"`
 	Name     string `json:"name"`
 	Progress int    `json:"progress"`
+	Pinned   bool   `json:"pinned" bson:"-"` // Закреплен пользователем, заполняется для каждого пользователя
+
+	Subtitles []*SubtitleInfo  `json:"subtitles,omitempty"`
+	Media     *probe.MediaInfo `json:"media,omitempty" bson:"-"`
+	Watch     *WatchProgress   `json:"watch,omitempty" bson:"-"`
 }
 
 // TorrentInfo содержит информацию о загружаемом файле
@@ -40,44 +101,84 @@ type TorrentInfo struct {
 	Name  string      `json:"name"`
 	Time  time.Time   `json:"time"`
 	Files []*FileInfo `json:"files"`
+
+	State      JobState      `json:"state,omitempty" bson:"-"`
+	Error      string        `json:"error,omitempty" bson:"-"`
+	Stats      *TorrentStats `json:"stats,omitempty" bson:"-"`
+	LastFileId string        `json:"last_file_id,omitempty" bson:"-"`
 }
 
 // NewTorrentManager создает новый менеджер торрентов
-func NewTorrentManager(filetypes []string, downloadPath string) *TorrentManager {
+func NewTorrentManager(config Config) *TorrentManager {
 	cfg := torrent.NewDefaultClientConfig()
-	cfg.DefaultStorage = storage.NewFileByInfoHash(downloadPath)
+	cfg.DefaultStorage = storage.NewFileByInfoHash(config.DownloadPath)
 	cfg.EstablishedConnsPerTorrent = 55
 	cfg.HalfOpenConnsPerTorrent = 30
 
+	downloadLimiter := newRateLimiter(config.DownloadRateLimit)
+	uploadLimiter := newRateLimiter(config.UploadRateLimit)
+	cfg.DownloadRateLimiter = downloadLimiter
+	cfg.UploadRateLimiter = uploadLimiter
+
 	client, err := torrent.NewClient(cfg)
 	if err != nil {
 		log.Fatalf("Failed to create torrent client: %v", err)
 	}
 
-	return &TorrentManager{
-		filetypes:    filetypes,
-		client:       client,
-		downloadPath: downloadPath,
+	tm := &TorrentManager{
+		filetypes:     config.Filetypes,
+		subtitleTypes: config.SubtitleTypes,
+		client:        client,
+		downloadPath:  config.DownloadPath,
+		cacheQuota:    config.CacheQuota,
+		cache:         newCacheIndex(config.DownloadPath),
+		streams:       make(map[string]int),
+		pinned:        make(map[string]bool),
+		selected:      make(map[string]map[string]bool),
+		faststart:     make(map[string]*faststartLayout),
+		media:         make(map[string]*probe.MediaInfo),
+		hls:           make(map[hlsKey]*hlsEntry),
+		previews:      make(map[string]int),
+		transcoder:    config.Transcoder,
+		events:        newEventHub(),
+		playheads:     playheads{windows: make(map[*streamReader]readWindow)},
+		rates:         rateMeter{samples: make(map[string]*rateSample)},
+		closed:        make(chan struct{}),
+
+		metadataTimeout: config.MetadataTimeout,
+		jobs:            make(map[string]*Job),
+
+		downloadLimiter: downloadLimiter,
+		uploadLimiter:   uploadLimiter,
+
+		seedPolicy:   config.SeedPolicy,
+		seedPolicies: make(map[string]*SeedPolicy),
+		seedStates:   make(map[string]SeedState),
+		seedStarted:  make(map[string]time.Time),
+		seedUploaded: make(map[string]int64),
+		seedSaved:    make(map[string]int64),
+	}
+	if tm.metadataTimeout <= 0 {
+		tm.metadataTimeout = 2 * time.Minute
 	}
+
+	go tm.runCacheEviction()
+	go tm.runSeeding()
+	go tm.runEvents()
+
+	return tm
 }
 
 // AddTorrentFromFile добавляет торрент из файла
 func (tm *TorrentManager) AddTorrentFromFile(torrentFile io.Reader, filename string) (*TorrentInfo, error) {
-	// Создаем временный файл для торрента
-	tempFile, err := os.CreateTemp(tm.downloadPath, "upload-*.torrent")
+	mi, err := metainfo.Load(torrentFile)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create temp file: %w", err)
-	}
-	defer os.Remove(tempFile.Name())
-	defer tempFile.Close()
-
-	// Копируем содержимое торрент-файла во временный файл
-	if _, err := io.Copy(tempFile, torrentFile); err != nil {
-		return nil, fmt.Errorf("failed to write to temp file: %w", err)
+		return nil, fmt.Errorf("failed to parse torrent file: %w", err)
 	}
+	tm.claimPreview(mi.HashInfoBytes())
 
 	// Добавляем торрент в клиент
-	t, err := tm.client.AddTorrentFromFile(tempFile.Name())
+	t, err := tm.client.AddTorrent(mi)
 	if err != nil {
 		return nil, fmt.Errorf("error adding torrent: %w", err)
 	}
@@ -87,16 +188,21 @@ func (tm *TorrentManager) AddTorrentFromFile(torrentFile io.Reader, filename str
 	// Ждем получения информации о торренте
 	<-t.GotInfo()
 
+	return tm.addLoadedTorrent(t)
+}
+
+// addLoadedTorrent обрабатывает торрент, для которого уже получены метаданные
+func (tm *TorrentManager) addLoadedTorrent(t *torrent.Torrent) (*TorrentInfo, error) {
 	// Обрабатываем файлы торрента
-	_, err = tm.processTorrentFiles(t)
+	_, err := tm.processTorrentFiles(t)
 	if err != nil {
 		t.Drop()
 		return nil, err
 	}
 
-	torrentInfo := convertTorrent(t)
+	tm.enforceSeedPolicy(t)
 
-	return torrentInfo, nil
+	return tm.convertTorrent(t), nil
 }
 
 // processTorrentFiles обрабатывает файлы в добавленном торренте
@@ -104,18 +210,15 @@ func (tm *TorrentManager) processTorrentFiles(t *torrent.Torrent) (bool, error)
 	tm.mu.Lock()
 	defer tm.mu.Unlock()
 
+	tm.selectSubtitles(t)
+
 	anyValid := false
 	for _, f := range t.Files() {
-		f.SetPriority(torrent.PiecePriorityNone)
+		tm.setFilePriority(f)
 
-		if !tm.isValidFile(f) {
-			continue
+		if tm.isValidFile(f) {
+			anyValid = true
 		}
-
-		anyValid = true
-
-		// Устанавливаем приоритеты для быстрого старта потоковой передачи
-		tm.setStreamingPriorities(f)
 	}
 
 	if !anyValid {
@@ -125,6 +228,28 @@ func (tm *TorrentManager) processTorrentFiles(t *torrent.Torrent) (bool, error)
 	return true, nil
 }
 
+// setFilePriority задает приоритет файла по закреплению и выбору пользователей.
+// Вызывается под tm.mu.
+func (tm *TorrentManager) setFilePriority(f *torrent.File) {
+	// Файлы, не выбранные ни одним пользователем, не загружаются
+	if tm.isExcluded(f) {
+		f.SetPriority(torrent.PiecePriorityNone)
+		return
+	}
+
+	// Субтитры небольшие, поэтому загружаются сразу целиком
+	if tm.pinned[generateFileID(f)] || tm.isSubtitleFile(f) {
+		f.Download()
+	} else {
+		f.SetPriority(torrent.PiecePriorityNone)
+	}
+
+	// Устанавливаем приоритеты для быстрого старта потоковой передачи
+	if tm.isValidFile(f) {
+		tm.setStreamingPriorities(f)
+	}
+}
+
 // generateFileID генерирует уникальный ID для файла
 func generateFileID(f *torrent.File) string {
 	id := f.Torrent().InfoHash().String() + f.DisplayPath()
@@ -148,6 +273,16 @@ func (tm *TorrentManager) isValidFile(f *torrent.File) bool {
 	return slices.Contains(tm.filetypes, ext)
 }
 
+// torrent возвращает торрент клиента по ID
+func (tm *TorrentManager) torrent(id string) (*torrent.Torrent, bool) {
+	var hash metainfo.Hash
+	if err := hash.FromHexString(id); err != nil {
+		return nil, false
+	}
+
+	return tm.client.Torrent(hash)
+}
+
 // GetTorrent возвращает информацию о торренте по ID
 func (tm *TorrentManager) GetTorrent(id string) (*TorrentInfo, bool) {
 	var hash metainfo.Hash
@@ -161,7 +296,26 @@ func (tm *TorrentManager) GetTorrent(id string) (*TorrentInfo, bool) {
 		return nil, false
 	}
 
-	return convertTorrent(t), ok
+	return tm.convertTorrent(t), ok
+}
+
+// GetTorrentDetails возвращает информацию о торренте вместе с доступностью каждого куска
+func (tm *TorrentManager) GetTorrentDetails(id string) (*TorrentInfo, bool) {
+	var hash metainfo.Hash
+	err := hash.FromHexString(id)
+	if err != nil {
+		return nil, false
+	}
+
+	t, ok := tm.client.Torrent(hash)
+	if !ok {
+		return nil, false
+	}
+
+	info := tm.convertTorrent(t)
+	info.Stats = tm.torrentStats(t, true)
+
+	return info, true
 }
 
 func (tm *TorrentManager) Stream(w http.ResponseWriter, r *http.Request, id string, fileId string) (string, bool) {
@@ -185,11 +339,18 @@ func (tm *TorrentManager) Stream(w http.ResponseWriter, r *http.Request, id stri
 			w.Header().Set("Content-Disposition", "attachment; filename="+fn)
 			w.Header().Set("Access-Control-Allow-Origin", "*")
 
-			reader := file.NewReader()
-			reader.SetReadahead(file.Length() / 100)
+			hash := t.InfoHash().String()
+			tm.cache.touch(hash)
+			tm.beginStream(hash)
+			defer tm.endStream(hash)
+
+			reader := tm.newStreamReader(r.Context(), file, tm.mediaDuration(fileId))
+			defer reader.Close()
 			reader.SetResponsive()
 
-			http.ServeContent(w, r, fn, time.Now(), reader)
+			view := tm.faststartView(r.Context(), file, fileId, reader)
+
+			http.ServeContent(w, r, fn, time.Now(), view)
 
 			return "file found", true
 		}
@@ -198,12 +359,27 @@ func (tm *TorrentManager) Stream(w http.ResponseWriter, r *http.Request, id stri
 	return "file not found", false
 }
 
-// GetTorrents возвращает список всех торрентов
-func (tm *TorrentManager) GetTorrents() []*TorrentInfo {
+// beginStream отмечает, что данные торрента читаются и не должны вытесняться из кэша
+func (tm *TorrentManager) beginStream(hash string) {
 	tm.mu.Lock()
 	defer tm.mu.Unlock()
 
-	torrents := convertTorrentList(tm.client.Torrents())
+	tm.streams[hash]++
+}
+
+func (tm *TorrentManager) endStream(hash string) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	tm.streams[hash]--
+	if tm.streams[hash] <= 0 {
+		delete(tm.streams, hash)
+	}
+}
+
+// GetTorrents возвращает список всех торрентов
+func (tm *TorrentManager) GetTorrents() []*TorrentInfo {
+	torrents := tm.convertTorrentList(tm.client.Torrents())
 
 	// Сортируем по времени добавления (новые сначала)
 	sort.Slice(torrents, func(i, j int) bool {
@@ -238,6 +414,10 @@ func (tm *TorrentManager) RemoveTorrent(id string) (bool, string) {
 
 	for _, file := range t.Files() {
 		file.SetPriority(torrent.PiecePriorityNone)
+		delete(tm.pinned, generateFileID(file))
+		delete(tm.faststart, generateFileID(file))
+		delete(tm.media, generateFileID(file))
+		tm.dropHLS(generateFileID(file))
 
 		ih := file.Torrent().InfoHash().String()
 		rel := file.Path()
@@ -246,6 +426,20 @@ func (tm *TorrentManager) RemoveTorrent(id string) (bool, string) {
 		_ = os.Remove(filePath)
 	}
 
+	delete(tm.selected, id)
+	tm.cache.forget(id)
+	tm.rates.forget(id)
+
+	tm.seedMu.Lock()
+	delete(tm.seedPolicies, id)
+	delete(tm.seedStates, id)
+	delete(tm.seedStarted, id)
+	delete(tm.seedUploaded, id)
+	delete(tm.seedSaved, id)
+	tm.seedMu.Unlock()
+
+	tm.Publish(Event{Type: EventRemoved, Hash: id})
+
 	return true, "torrent removed"
 }
 
@@ -276,29 +470,42 @@ func (tm *TorrentManager) GetFilepath(id string, fileId string) (string, error)
 
 // Close закрывает торрент-клиент
 func (tm *TorrentManager) Close() {
+	close(tm.closed)
+
 	if tm.client != nil {
 		tm.client.Close()
 	}
 }
 
+// AddMagnet добавляет магнет-ссылку и ждет получения метаданных
 func (tm *TorrentManager) AddMagnet(uri string) (*TorrentInfo, error) {
-	t, err := tm.client.AddMagnet(uri)
+	job, err := tm.AddMagnetAsync(uri)
 	if err != nil {
 		return nil, err
 	}
 
-	<-t.GotInfo()
+	<-job.Done()
 
-	isValid, err := tm.processTorrentFiles(t)
-	if err != nil {
-		t.Drop()
+	job, _ = tm.GetJob(job.Id)
+	if job.State != JobReady {
+		return nil, errors.New(job.Error)
 	}
 
-	if !isValid {
-		return nil, err
-	}
+	return job.Torrent, nil
+}
+
+// readerWithContext прерывает чтение из торрента по истечении контекста
+type readerWithContext struct {
+	ctx    context.Context
+	reader torrent.Reader
+}
+
+func (r readerWithContext) Read(p []byte) (int, error) {
+	return r.reader.ReadContext(r.ctx, p)
+}
 
-	return convertTorrent(t), nil
+func (r readerWithContext) Seek(offset int64, whence int) (int64, error) {
+	return r.reader.Seek(offset, whence)
 }
 
 func (tm *TorrentManager) getId(f *torrent.File) string {
@@ -306,25 +513,30 @@ func (tm *TorrentManager) getId(f *torrent.File) string {
 	return fmt.Sprintf("%x", md5.Sum([]byte(id)))
 }
 
-func convertTorrentList(torrentList []*torrent.Torrent) []*TorrentInfo {
+func (tm *TorrentManager) convertTorrentList(torrentList []*torrent.Torrent) []*TorrentInfo {
 	torrents := make([]*TorrentInfo, 0, len(torrentList))
 	for _, t := range torrentList {
-		torrents = append(torrents, convertTorrent(t))
+		torrents = append(torrents, tm.convertTorrent(t))
 	}
 
 	return torrents
 }
 
-func convertTorrent(t *torrent.Torrent) *TorrentInfo {
+func (tm *TorrentManager) convertTorrent(t *torrent.Torrent) *TorrentInfo {
 	files := t.Files()
 
+	subtitles := tm.matchSubtitles(files)
+
 	fileInfos := make([]*FileInfo, 0, len(files))
 	for _, f := range files {
 		fileInfo := &FileInfo{
 			Id:       generateFileID(f),
 			Name:     f.DisplayPath(),
 			Progress: calculateProgress(f),
+
+			Subtitles: subtitles[f],
 		}
+		fileInfo.Media, _ = tm.MediaInfo(fileInfo.Id)
 
 		fileInfos = append(fileInfos, fileInfo)
 	}
@@ -334,6 +546,7 @@ func convertTorrent(t *torrent.Torrent) *TorrentInfo {
 		Name:  t.Name(),
 		Time:  time.Unix(0, t.Metainfo().CreationDate),
 		Files: fileInfos,
+		Stats: tm.torrentStats(t, false),
 	}
 
 	return torrentInfo
@@ -0,0 +1,145 @@
+package torrent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"retreat-backend/internal/mkv"
+	"retreat-backend/internal/transcode"
+
+	"github.com/anacrolix/torrent"
+)
+
+var ErrTranscoderDisabled = errors.New("transcoding is not configured")
+
+// matroskaTypes перечисляет файлы, которые перематываются для перекодирования по индексу Cues
+var matroskaTypes = []string{".mkv", ".webm"}
+
+// StreamTranscode отдает файл, перекодированный внешним перекодировщиком.
+// Используется для кодеков, которые браузер не воспроизводит ни в каком
+// контейнере (HEVC, AC3, DTS). Процесс останавливается при отключении клиента.
+func (tm *TorrentManager) StreamTranscode(w http.ResponseWriter, r *http.Request, id string, fileId string, opts transcode.Options) error {
+	if tm.transcoder == nil {
+		return ErrTranscoderDisabled
+	}
+
+	t, ok := tm.torrent(id)
+	if !ok {
+		return fmt.Errorf("torrent not found: %s", id)
+	}
+
+	for _, file := range t.Files() {
+		if generateFileID(file) != fileId || !tm.isValidFile(file) {
+			continue
+		}
+
+		hash := t.InfoHash().String()
+		tm.cache.touch(hash)
+		tm.beginStream(hash)
+		defer tm.endStream(hash)
+
+		reader := tm.newStreamReader(r.Context(), file, tm.mediaDuration(fileId))
+		defer reader.Close()
+		reader.SetResponsive()
+
+		w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate, max-age=0")
+		w.Header().Set("X-Start-Time", strconv.FormatFloat(opts.Start.Seconds(), 'f', 3, 64))
+		w.Header().Set("Access-Control-Expose-Headers", "X-Start-Time")
+
+		if r.Method == http.MethodHead {
+			w.Header().Set("Content-Type", "video/mp4")
+			w.WriteHeader(http.StatusOK)
+			return nil
+		}
+
+		input, start := tm.transcodeInput(r.Context(), file, fileId, reader, opts.Start)
+		opts.Start = start
+
+		out := &lazyWriter{w: w, contentType: "video/mp4"}
+		err := tm.transcoder.Transcode(r.Context(), out, input, opts)
+		if !out.started {
+			// Данные не отправлены: ошибку можно вернуть клиенту кодом ответа
+			return err
+		}
+
+		// Ответ уже начат, поэтому ошибки только записываются в журнал
+		if err != nil && !errors.Is(err, context.Canceled) {
+			log.Printf("Transcoding of %s stopped: %v", file.DisplayPath(), err)
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("file not found: %s", fileId)
+}
+
+// transcodeInput возвращает вход перекодировщика и время, с которого его нужно начать.
+// Matroska с индексом передается с кластера ближайшей точки не позже start, и время
+// уменьшается на время точки: при чтении из канала перекодировщик не перематывает
+// вход и отсчитывает начало от первой метки времени. Остальные файлы передаются
+// с начала, и до start их декодирует сам перекодировщик.
+func (tm *TorrentManager) transcodeInput(ctx context.Context, file *torrent.File, fileId string, reader io.ReadSeeker, start time.Duration) (io.Reader, time.Duration) {
+	ext := strings.ToLower(path.Ext(file.Path()))
+	if !slices.Contains(matroskaTypes, ext) {
+		// Перекодировщик читает поток последовательно, поэтому moov должен идти первым
+		return tm.faststartView(ctx, file, fileId, reader), start
+	}
+	if start <= 0 {
+		return reader, start
+	}
+
+	// Заголовки и индекс читаются отдельным reader, чтобы не сбивать упреждающее чтение потока
+	r := file.NewReader()
+	defer r.Close()
+	r.SetResponsive()
+	rs := readerWithContext{ctx: ctx, reader: r}
+
+	header, err := mkv.ReadHeader(rs, file.Length())
+	if err != nil {
+		return reader, start
+	}
+	cues, err := header.ReadCues(rs)
+	if err != nil {
+		log.Printf("Transcoding %s from the beginning: %v", file.DisplayPath(), err)
+		return reader, start
+	}
+	cue := mkv.FindCue(cues, start, 0)
+	if cue == nil {
+		return reader, start
+	}
+
+	input, err := header.StreamFrom(reader, cue.Cluster)
+	if err != nil {
+		log.Printf("Transcoding %s from the beginning: %v", file.DisplayPath(), err)
+		_, _ = reader.Seek(0, io.SeekStart)
+		return reader, start
+	}
+
+	return input, start - cue.Time
+}
+
+// lazyWriter отправляет заголовки ответа только при первой записи данных
+type lazyWriter struct {
+	w           http.ResponseWriter
+	contentType string
+	started     bool
+}
+
+func (lw *lazyWriter) Write(p []byte) (int, error) {
+	if !lw.started {
+		lw.w.Header().Set("Content-Type", lw.contentType)
+		lw.w.WriteHeader(http.StatusOK)
+		lw.started = true
+	}
+
+	return lw.w.Write(p)
+}
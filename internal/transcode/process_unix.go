@@ -0,0 +1,17 @@
+//go:build unix
+
+package transcode
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup запускает команду в отдельной группе процессов, чтобы при
+// отмене завершались и порожденные ею процессы (например, обертки над ffmpeg)
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
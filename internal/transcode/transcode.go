@@ -0,0 +1,192 @@
+package transcode
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultProfile используется, если профиль не указан в запросе
+	DefaultProfile = "default"
+	// waitDelay ограничивает ожидание завершения процесса после отмены
+	waitDelay = 5 * time.Second
+	// maxStderr ограничивает объем сохраняемого вывода ошибок процесса
+	maxStderr = 4 << 10
+)
+
+// Подстановки в команде и аргументах профиля
+const (
+	argProfile = "{profile}" // Заменяется аргументами профиля
+	argStart   = "{start}"   // Время начала в секундах
+	argAudio   = "{audio}"   // Номер аудиодорожки среди аудиодорожек файла
+)
+
+var (
+	ErrUnknownProfile = errors.New("unknown transcoding profile")
+	ErrBusy           = errors.New("too many transcoding jobs")
+)
+
+// DefaultCommand запускает ffmpeg, читающий файл из stdin и пишущий результат в stdout
+var DefaultCommand = []string{
+	"ffmpeg", "-hide_banner", "-loglevel", "error", "-nostdin",
+	"-ss", argStart, "-i", "pipe:0", argProfile, "pipe:1",
+}
+
+// DefaultProfiles содержит профили для ffmpeg. Все они выдают фрагментированный MP4,
+// который браузер может воспроизводить по мере получения.
+var DefaultProfiles = map[string][]string{
+	// Полное перекодирование в H.264/AAC
+	DefaultProfile: {
+		"-map", "0:v:0", "-map", "0:a:" + argAudio + "?",
+		"-c:v", "libx264", "-preset", "veryfast", "-crf", "23", "-pix_fmt", "yuv420p",
+		"-c:a", "aac", "-b:a", "192k", "-ac", "2",
+		"-movflags", "frag_keyframe+empty_moov+default_base_moof", "-f", "mp4",
+	},
+	// Уменьшенное до 720p видео для медленных соединений
+	"low": {
+		"-map", "0:v:0", "-map", "0:a:" + argAudio + "?",
+		"-vf", "scale=-2:'min(720,ih)'",
+		"-c:v", "libx264", "-preset", "veryfast", "-crf", "26", "-pix_fmt", "yuv420p",
+		"-c:a", "aac", "-b:a", "128k", "-ac", "2",
+		"-movflags", "frag_keyframe+empty_moov+default_base_moof", "-f", "mp4",
+	},
+	// Видео копируется, перекодируется только звук (например, AC3 или DTS)
+	"audio": {
+		"-map", "0:v:0", "-map", "0:a:" + argAudio + "?",
+		"-c:v", "copy", "-c:a", "aac", "-b:a", "192k", "-ac", "2",
+		"-movflags", "frag_keyframe+empty_moov+default_base_moof", "-f", "mp4",
+	},
+}
+
+// Options задает параметры перекодирования
+type Options struct {
+	Profile string        // Имя профиля; пустое значение выбирает DefaultProfile
+	Audio   int           // Номер аудиодорожки среди аудиодорожек файла
+	Start   time.Duration // Время от первой метки входа, с которого начинается поток
+}
+
+// Transcoder перекодирует медиаданные из r в w. Transcode возвращает
+// управление, когда поток закончился, произошла ошибка или отменен ctx.
+type Transcoder interface {
+	Transcode(ctx context.Context, w io.Writer, r io.Reader, opts Options) error
+}
+
+// CommandTranscoder перекодирует внешней командой, которая читает файл
+// из stdin и пишет результат в stdout
+type CommandTranscoder struct {
+	command  []string
+	profiles map[string][]string
+	jobs     chan struct{}
+}
+
+// NewCommandTranscoder создает перекодировщик. Пустая команда или профили заменяются
+// значениями по умолчанию, maxJobs <= 0 снимает ограничение на число процессов.
+func NewCommandTranscoder(command []string, profiles map[string][]string, maxJobs int) *CommandTranscoder {
+	if len(command) == 0 {
+		command = DefaultCommand
+	}
+	if len(profiles) == 0 {
+		profiles = DefaultProfiles
+	}
+
+	t := &CommandTranscoder{
+		command:  command,
+		profiles: profiles,
+	}
+	if maxJobs > 0 {
+		t.jobs = make(chan struct{}, maxJobs)
+	}
+
+	return t
+}
+
+func (t *CommandTranscoder) Transcode(ctx context.Context, w io.Writer, r io.Reader, opts Options) error {
+	args, err := t.args(opts)
+	if err != nil {
+		return err
+	}
+
+	if t.jobs != nil {
+		select {
+		case t.jobs <- struct{}{}:
+			defer func() { <-t.jobs }()
+		default:
+			return ErrBusy
+		}
+	}
+
+	// Процесс завершается при отключении клиента или выходе из Transcode
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stderr := &limitedBuffer{limit: maxStderr}
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdin = r
+	cmd.Stdout = w
+	cmd.Stderr = stderr
+	cmd.WaitDelay = waitDelay
+	setProcessGroup(cmd)
+
+	err = cmd.Run()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("%s: %w: %s", args[0], err, msg)
+		}
+		return fmt.Errorf("%s: %w", args[0], err)
+	}
+
+	return nil
+}
+
+// args собирает аргументы команды с подстановками профиля и параметров
+func (t *CommandTranscoder) args(opts Options) ([]string, error) {
+	name := opts.Profile
+	if name == "" {
+		name = DefaultProfile
+	}
+	profile, ok := t.profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownProfile, name)
+	}
+
+	replacer := strings.NewReplacer(
+		argStart, strconv.FormatFloat(opts.Start.Seconds(), 'f', 3, 64),
+		argAudio, strconv.Itoa(max(opts.Audio, 0)),
+	)
+
+	var args []string
+	for _, arg := range t.command {
+		if arg == argProfile {
+			for _, p := range profile {
+				args = append(args, replacer.Replace(p))
+			}
+			continue
+		}
+		args = append(args, replacer.Replace(arg))
+	}
+
+	return args, nil
+}
+
+// limitedBuffer сохраняет начало вывода и отбрасывает остальное
+type limitedBuffer struct {
+	bytes.Buffer
+	limit int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if rest := b.limit - b.Len(); rest > 0 {
+		b.Buffer.Write(p[:min(len(p), rest)])
+	}
+	return len(p), nil
+}
@@ -0,0 +1,140 @@
+package transcode
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Тестовый бинарник сам выступает командой перекодирования, если задана переменная
+// окружения: режим выбирается первым аргументом после "--".
+func TestMain(m *testing.M) {
+	if os.Getenv("TRANSCODE_FAKE_COMMAND") == "1" {
+		os.Exit(fakeCommand(os.Args))
+	}
+	os.Exit(m.Run())
+}
+
+func fakeCommand(args []string) int {
+	for len(args) > 0 && args[0] != "--" {
+		args = args[1:]
+	}
+	if len(args) < 2 {
+		return 2
+	}
+
+	switch mode, rest := args[1], args[2:]; mode {
+	case "echo":
+		// Аргументы, затем вход без изменений
+		fmt.Fprintln(os.Stdout, strings.Join(rest, " "))
+		io.Copy(os.Stdout, os.Stdin)
+		return 0
+	case "fail":
+		fmt.Fprintln(os.Stderr, "unsupported codec")
+		return 1
+	case "hang":
+		time.Sleep(time.Minute)
+		return 0
+	}
+	return 2
+}
+
+func fakeTranscoder(t *testing.T, mode string, maxJobs int) *CommandTranscoder {
+	t.Setenv("TRANSCODE_FAKE_COMMAND", "1")
+
+	command := []string{os.Args[0], "-test.run=^$", "--", mode, "-ss", argStart, argProfile}
+	profiles := map[string][]string{
+		DefaultProfile: {"-a", argAudio},
+		"copy":         {"-c", "copy"},
+	}
+	return NewCommandTranscoder(command, profiles, maxJobs)
+}
+
+func TestTranscode(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+		want string
+	}{
+		{"default profile", Options{}, "-ss 0.000 -a 0\ninput"},
+		{"start and audio", Options{Start: 90500 * time.Millisecond, Audio: 2}, "-ss 90.500 -a 2\ninput"},
+		{"negative audio", Options{Audio: -1}, "-ss 0.000 -a 0\ninput"},
+		{"named profile", Options{Profile: "copy"}, "-ss 0.000 -c copy\ninput"},
+	}
+
+	tr := fakeTranscoder(t, "echo", 0)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := tr.Transcode(context.Background(), &out, strings.NewReader("input"), tt.opts); err != nil {
+				t.Fatalf("Transcode() error = %v", err)
+			}
+			if out.String() != tt.want {
+				t.Errorf("output = %q, want %q", out.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestTranscodeUnknownProfile(t *testing.T) {
+	tr := fakeTranscoder(t, "echo", 0)
+
+	err := tr.Transcode(context.Background(), io.Discard, strings.NewReader(""), Options{Profile: "missing"})
+	if !errors.Is(err, ErrUnknownProfile) {
+		t.Errorf("error = %v, want %v", err, ErrUnknownProfile)
+	}
+}
+
+func TestTranscodeFailure(t *testing.T) {
+	tr := fakeTranscoder(t, "fail", 0)
+
+	err := tr.Transcode(context.Background(), io.Discard, strings.NewReader(""), Options{})
+	if err == nil || !strings.Contains(err.Error(), "unsupported codec") {
+		t.Errorf("error = %v, want stderr of the command", err)
+	}
+}
+
+func TestTranscodeCancel(t *testing.T) {
+	tr := fakeTranscoder(t, "hang", 0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	started := time.Now()
+	err := tr.Transcode(ctx, io.Discard, strings.NewReader(""), Options{})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(started); elapsed > waitDelay {
+		t.Errorf("process stopped after %s", elapsed)
+	}
+}
+
+func TestTranscodeBusy(t *testing.T) {
+	tr := fakeTranscoder(t, "hang", 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- tr.Transcode(ctx, io.Discard, strings.NewReader(""), Options{})
+	}()
+
+	// Ждем, пока первый процесс займет единственное место
+	for len(tr.jobs) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	err := tr.Transcode(context.Background(), io.Discard, strings.NewReader(""), Options{})
+	if !errors.Is(err, ErrBusy) {
+		t.Errorf("error = %v, want %v", err, ErrBusy)
+	}
+
+	cancel()
+	<-done
+}
@@ -0,0 +1,135 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+const (
+	// SignatureHeader содержит подпись тела запроса: "sha256=<hex HMAC-SHA256>"
+	SignatureHeader = "X-Retreat-Signature"
+	// EventHeader содержит название события
+	EventHeader = "X-Retreat-Event"
+	// DeliveryHeader содержит ID доставки, одинаковый для всех попыток
+	DeliveryHeader = "X-Retreat-Delivery"
+
+	defaultAttempts = 5
+	defaultBackoff  = 2 * time.Second
+	requestTimeout  = 10 * time.Second
+)
+
+// Attempt описывает одну попытку доставки
+type Attempt struct {
+	Number   int
+	Status   int // Код ответа, 0 - ответ не получен
+	Error    string
+	Duration time.Duration
+}
+
+// Success сообщает, что получатель принял запрос
+func (a Attempt) Success() bool {
+	return a.Status >= 200 && a.Status < 300
+}
+
+// Sender отправляет подписанные запросы с повторами и экспоненциальной задержкой
+type Sender struct {
+	Client   *http.Client
+	Attempts int           // Максимальное число попыток
+	Backoff  time.Duration // Задержка перед второй попыткой, далее удваивается
+}
+
+// NewSender создает Sender с настройками по умолчанию
+func NewSender() *Sender {
+	return &Sender{
+		Client:   &http.Client{Timeout: requestTimeout},
+		Attempts: defaultAttempts,
+		Backoff:  defaultBackoff,
+	}
+}
+
+// Sign возвращает подпись тела запроса секретом получателя
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify проверяет подпись тела запроса
+func Verify(secret string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, body)), []byte(signature))
+}
+
+// Send доставляет body на url, повторяя попытку при сетевой ошибке, ответе 5xx
+// или 429. onAttempt вызывается после каждой попытки, например для журнала доставок.
+func (s *Sender) Send(ctx context.Context, url, secret, event, delivery string, body []byte, onAttempt func(Attempt)) error {
+	backoff := s.Backoff
+	attempts := max(s.Attempts, 1)
+
+	var last Attempt
+	for n := 1; n <= attempts; n++ {
+		last = s.attempt(ctx, url, secret, event, delivery, body)
+		last.Number = n
+		if onAttempt != nil {
+			onAttempt(last)
+		}
+
+		if last.Success() || !retryable(last.Status) || n == attempts {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+
+	if last.Success() {
+		return nil
+	}
+	if last.Error != "" {
+		return fmt.Errorf("webhook delivery failed: %s", last.Error)
+	}
+	return fmt.Errorf("webhook delivery failed: status %d", last.Status)
+}
+
+func (s *Sender) attempt(ctx context.Context, url, secret, event, delivery string, body []byte) Attempt {
+	start := time.Now()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return Attempt{Error: err.Error()}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Retreat-Webhook")
+	req.Header.Set(EventHeader, event)
+	req.Header.Set(DeliveryHeader, delivery)
+	req.Header.Set(SignatureHeader, Sign(secret, body))
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return Attempt{Error: err.Error(), Duration: time.Since(start)}
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	result := Attempt{Status: resp.StatusCode, Duration: time.Since(start)}
+	if !result.Success() {
+		result.Error = resp.Status
+	}
+
+	return result
+}
+
+// retryable сообщает, имеет ли смысл повторять запрос после ответа с кодом status
+func retryable(status int) bool {
+	return status == 0 || status == http.StatusTooManyRequests || status >= 500
+}
@@ -0,0 +1,155 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// receiver - получатель вебхуков, отвечающий кодами из statuses по очереди
+// и проверяющий подпись каждого запроса
+type receiver struct {
+	t        *testing.T
+	secret   string
+	statuses []int
+
+	mu         sync.Mutex
+	requests   int
+	deliveries map[string]bool
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	rc.mu.Lock()
+	status := rc.statuses[min(rc.requests, len(rc.statuses)-1)]
+	rc.requests++
+	rc.deliveries[r.Header.Get(DeliveryHeader)] = true
+	rc.mu.Unlock()
+
+	if r.Method != http.MethodPost || r.Header.Get(EventHeader) != "completed" {
+		rc.t.Errorf("unexpected request %s with event %q", r.Method, r.Header.Get(EventHeader))
+	}
+	if !Verify(rc.secret, body, r.Header.Get(SignatureHeader)) {
+		rc.t.Errorf("invalid signature %q", r.Header.Get(SignatureHeader))
+	}
+
+	w.WriteHeader(status)
+}
+
+func TestSend(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		attempts int
+		success  bool
+	}{
+		{"accepted", []int{http.StatusOK}, 1, true},
+		{"retried server errors", []int{http.StatusInternalServerError, http.StatusServiceUnavailable, http.StatusNoContent}, 3, true},
+		{"retried rate limit", []int{http.StatusTooManyRequests, http.StatusOK}, 2, true},
+		{"client error is final", []int{http.StatusNotFound}, 1, false},
+		{"attempts exhausted", []int{http.StatusBadGateway}, 4, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rc := &receiver{t: t, secret: "secret", statuses: tt.statuses, deliveries: make(map[string]bool)}
+			srv := httptest.NewServer(rc)
+			defer srv.Close()
+
+			sender := &Sender{Client: srv.Client(), Attempts: 4, Backoff: time.Millisecond}
+
+			var attempts []Attempt
+			err := sender.Send(context.Background(), srv.URL, "secret", "completed", "delivery-1", []byte(`{"event":"completed"}`), func(a Attempt) {
+				attempts = append(attempts, a)
+			})
+
+			if (err == nil) != tt.success {
+				t.Errorf("Send() error = %v, want success %v", err, tt.success)
+			}
+			if len(attempts) != tt.attempts || rc.requests != tt.attempts {
+				t.Fatalf("attempts = %d, requests = %d, want %d", len(attempts), rc.requests, tt.attempts)
+			}
+			for i, a := range attempts {
+				if a.Number != i+1 {
+					t.Errorf("attempt %d has number %d", i+1, a.Number)
+				}
+			}
+			if last := attempts[len(attempts)-1]; last.Success() != tt.success {
+				t.Errorf("last attempt = %+v", last)
+			}
+			if len(rc.deliveries) != 1 || !rc.deliveries["delivery-1"] {
+				t.Errorf("delivery ids = %v, want the same id on every attempt", rc.deliveries)
+			}
+		})
+	}
+}
+
+func TestSendUnreachable(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	url := srv.URL
+	srv.Close()
+
+	sender := &Sender{Client: &http.Client{}, Attempts: 2, Backoff: time.Millisecond}
+
+	var attempts []Attempt
+	err := sender.Send(context.Background(), url, "secret", "completed", "delivery-1", []byte("{}"), func(a Attempt) {
+		attempts = append(attempts, a)
+	})
+	if err == nil {
+		t.Fatal("Send() succeeded with a closed receiver")
+	}
+	if len(attempts) != 2 || attempts[0].Status != 0 || attempts[0].Error == "" {
+		t.Errorf("attempts = %+v, want two failed attempts without status", attempts)
+	}
+}
+
+func TestSendCancelledDuringBackoff(t *testing.T) {
+	rc := &receiver{t: t, secret: "secret", statuses: []int{http.StatusInternalServerError}, deliveries: make(map[string]bool)}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+
+	sender := &Sender{Client: srv.Client(), Attempts: 5, Backoff: time.Hour}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	err := sender.Send(ctx, srv.URL, "secret", "completed", "delivery-1", []byte("{}"), func(Attempt) {
+		cancel()
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Send() error = %v, want %v", err, context.Canceled)
+	}
+	if rc.requests != 1 {
+		t.Errorf("requests = %d, want 1", rc.requests)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	body := []byte(`{"event":"added"}`)
+	signature := Sign("secret", body)
+
+	tests := []struct {
+		name      string
+		secret    string
+		body      []byte
+		signature string
+		want      bool
+	}{
+		{"valid", "secret", body, signature, true},
+		{"wrong secret", "other", body, signature, false},
+		{"modified body", "secret", []byte(`{"event":"removed"}`), signature, false},
+		{"missing signature", "secret", body, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Verify(tt.secret, tt.body, tt.signature); got != tt.want {
+				t.Errorf("Verify() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}